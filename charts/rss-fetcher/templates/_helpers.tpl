@@ -71,3 +71,10 @@ Valkey Service Name
 {{- .Values.externalValkey.host }}
 {{- end }}
 {{- end }}
+
+{{/*
+Whether the fetcher stores state in Valkey (bundled or external)
+*/}}
+{{- define "rss-fetcher.useValkey" -}}
+{{- if or .Values.valkey.enabled .Values.externalValkey.host }}true{{- end }}
+{{- end }}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/feed"
+	"rss-fetcher/internal/netpolicy"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+const burstUsage = `Usage: rss-fetcher burst <command> [flags]
+
+Commands:
+  list     Print the bursts held by burst_policy: hold
+  approve  Notify the held burst of a feed
+  reject   Drop the held burst of a feed
+
+A Bolt store can only be opened while the server is stopped; use the
+server's /admin/bursts API otherwise.
+
+Run "rss-fetcher burst <command> -h" for command flags.`
+
+func runBurstCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, burstUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("burst "+args[0], flag.ContinueOnError)
+	feedsPath := fs.String("feeds", "config/feeds.yaml", "Path to feeds configuration file (selects the store)")
+	webhooksPath := fs.String("webhooks", "config/webhooks.yaml", "Path to webhooks configuration file")
+	var feedKey *string
+	switch args[0] {
+	case "list":
+	case "approve", "reject":
+		feedKey = fs.String("feed", "", "Key of the feed (its id, or its URL)")
+	default:
+		fmt.Fprintf(os.Stderr, "unknown burst command %q\n\n%s\n", args[0], burstUsage)
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if feedKey != nil && *feedKey == "" {
+		fmt.Fprintf(os.Stderr, "burst %s: -feed is required\n", args[0])
+		return 2
+	}
+
+	// Keep stdout for command output; logs go to stderr.
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	slog.SetDefault(logger)
+
+	cfg, err := config.Load(*feedsPath, *webhooksPath)
+	if err != nil {
+		logger.Error("Failed to load config", "error", err)
+		return 1
+	}
+	if cfg.Feeds.Store.Type == "memory" {
+		logger.Error("The memory store does not outlive the process; use the /admin/bursts API of the running server instead")
+		return 1
+	}
+
+	policy, err := netpolicy.New(cfg.Feeds.NetworkPolicy)
+	if err != nil {
+		logger.Error("Failed to initialize network policy", "error", err)
+		return 1
+	}
+
+	store, closeStore, err := openStore(cfg.Feeds.Store, logger)
+	if errors.Is(err, state.ErrStoreInUse) {
+		logger.Error("The Bolt store is held by the running server; stop it or use its /admin/bursts API instead", "error", err)
+		return 1
+	} else if err != nil {
+		logger.Error("Failed to initialize store", "error", err)
+		return 1
+	}
+	defer closeStore()
+	whClient := webhook.NewClient()
+	whClient.SetNetworkPolicy(policy)
+	fetcher := feed.NewFetcher(store, whClient, cfg.Webhooks.Webhooks, cfg.Feeds)
+	fetcher.SetNetworkPolicy(policy)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "list":
+		err = listBursts(ctx, fetcher)
+	case "approve":
+		_, err = fetcher.ApproveBurst(ctx, *feedKey)
+	case "reject":
+		_, err = fetcher.RejectBurst(ctx, *feedKey)
+	}
+	if err != nil {
+		logger.Error("Burst command failed", "command", args[0], "error", err)
+		return 1
+	}
+	return 0
+}
+
+func listBursts(ctx context.Context, fetcher *feed.Fetcher) error {
+	bursts, err := fetcher.HeldBursts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, burst := range bursts {
+		fmt.Printf("%s\t%d items held since %s\n", burst.Feed, len(burst.Items), burst.HeldAt.Format("2006-01-02 15:04:05Z07:00"))
+		for _, item := range burst.Items {
+			fmt.Printf("  %s\t%s\n", item.ItemTitle, item.ItemURL)
+		}
+	}
+	return nil
+}
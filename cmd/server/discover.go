@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/feed"
+	"rss-fetcher/internal/netpolicy"
+)
+
+const discoverUsage = `Usage: rss-fetcher discover [flags] <url>
+
+Print the feeds advertised by an HTML page, best first, as
+"<url>\t<type>\t<title>" lines. The first one is what the fetcher uses
+when the page URL is configured as a feed. The page is requested under the
+network_policy of the feeds configuration.`
+
+func runDiscoverCommand(args []string) int {
+	fs := flag.NewFlagSet("discover", flag.ContinueOnError)
+	feedsPath := fs.String("feeds", "config/feeds.yaml", "Path to feeds configuration file (selects the network policy)")
+	timeout := fs.Duration("timeout", 30*time.Second, "Request timeout")
+	maxBodySize := fs.Int64("max-body-size", 10<<20, "Maximum response size in bytes, before and after decompression")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), discoverUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	cfg, err := config.LoadFeeds(*feedsPath)
+	if err != nil {
+		logger.Error("Failed to load config", "error", err)
+		return 1
+	}
+	policy, err := netpolicy.New(cfg.NetworkPolicy)
+	if err != nil {
+		logger.Error("Failed to initialize network policy", "error", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	candidates, err := feed.DiscoverFeeds(ctx, config.FetchConfig{
+		Timeout:             *timeout,
+		MaxBodySize:         *maxBodySize,
+		MaxDecompressedSize: *maxBodySize,
+	}, policy, fs.Arg(0))
+	if err != nil {
+		logger.Error("Discovery failed", "url", fs.Arg(0), "error", err)
+		return 1
+	}
+	if len(candidates) == 0 {
+		logger.Error("No feeds advertised", "url", fs.Arg(0))
+		return 1
+	}
+	for _, c := range candidates {
+		fmt.Printf("%s\t%s\t%s\n", c.URL, c.Type, c.Title)
+	}
+	return 0
+}
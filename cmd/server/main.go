@@ -8,49 +8,87 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"rss-fetcher/internal/alert"
 	"rss-fetcher/internal/config"
 	"rss-fetcher/internal/feed"
-	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/logging"
+	"rss-fetcher/internal/netpolicy"
+	"rss-fetcher/internal/tracing"
 	"rss-fetcher/internal/webhook"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "state":
+			os.Exit(runStateCommand(os.Args[2:]))
+		case "discover":
+			os.Exit(runDiscoverCommand(os.Args[2:]))
+		case "opml":
+			os.Exit(runOPMLCommand(os.Args[2:]))
+		case "burst":
+			os.Exit(runBurstCommand(os.Args[2:]))
+		}
+	}
+
 	feedsPath := flag.String("feeds", "config/feeds.yaml", "Path to feeds configuration file")
 	webhooksPath := flag.String("webhooks", "config/webhooks.yaml", "Path to webhooks configuration file")
 	flag.Parse()
 
+	// Load Config
+	cfg, err := config.Load(*feedsPath, *webhooksPath)
+	if err != nil {
+		slog.New(slog.NewJSONHandler(os.Stdout, nil)).Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
 	// Setup Logger
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	serverLogger, err := logging.New(cfg.Feeds.Log, os.Stdout)
+	if err != nil {
+		slog.New(slog.NewJSONHandler(os.Stdout, nil)).Error("Failed to initialize logging", "error", err)
+		os.Exit(1)
+	}
+	logger := serverLogger.Logger
 	slog.SetDefault(logger)
 
-	// Load Config
-	cfg, err := config.Load(*feedsPath, *webhooksPath)
+	// Tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Feeds.Tracing)
 	if err != nil {
-		logger.Error("Failed to load config", "error", err)
+		logger.Error("Failed to initialize tracing", "error", err)
 		os.Exit(1)
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("Failed to flush traces", "error", err)
+		}
+	}()
 
 	// Init Store
-	var store state.Store
-	if cfg.Feeds.Store.Type == "valkey" {
-		logger.Info("Using Valkey Store", "address", cfg.Feeds.Store.Address)
-		s, err := state.NewValkeyStore(cfg.Feeds.Store.Address, cfg.Feeds.Store.Password)
-		if err != nil {
-			logger.Error("Failed to initialize Valkey store", "error", err)
-			os.Exit(1)
-		}
-		store = s
-	} else {
-		logger.Info("Using Memory Store")
-		store = state.NewMemoryStore()
+	store, closeStore, err := openStore(cfg.Feeds.Store, logger)
+	if err != nil {
+		logger.Error("Failed to initialize store", "error", err)
+		os.Exit(1)
 	}
+	defer closeStore()
 
 	// Init Components
+	policy, err := netpolicy.New(cfg.Feeds.NetworkPolicy)
+	if err != nil {
+		logger.Error("Failed to initialize network policy", "error", err)
+		os.Exit(1)
+	}
 	whClient := webhook.NewClient()
+	whClient.SetNetworkPolicy(policy)
 	fetcher := feed.NewFetcher(store, whClient, cfg.Webhooks.Webhooks, cfg.Feeds)
+	fetcher.SetNetworkPolicy(policy)
+	notifier := alert.NewNotifier(whClient, cfg.Webhooks.Alerts)
+	fetcher.SetAlerter(notifier, cfg.Webhooks.Alerts)
 
 	// Metrics Server
 	go func() {
@@ -64,6 +102,16 @@ func main() {
 	// Context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	go notifier.Run(ctx)
+
+	// Admin API
+	if cfg.Feeds.Admin.Listen != "" {
+		admin := http.NewServeMux()
+		admin.Handle("/admin/log/level", serverLogger)
+		admin.Handle("/admin/bursts", fetcher.BurstHandler())
+		admin.Handle("/admin/bursts/", fetcher.BurstHandler())
+		startAdmin(ctx, cfg.Feeds.Admin.Listen, admin, logger)
+	}
 
 	// Handle Signals
 	sigChan := make(chan os.Signal, 1)
@@ -75,6 +123,42 @@ func main() {
 		cancel()
 	}()
 
+	// SIGUSR1 toggles debug logging without a restart.
+	levelChan := make(chan os.Signal, 1)
+	signal.Notify(levelChan, syscall.SIGUSR1)
+	go func() {
+		for range levelChan {
+			serverLogger.ToggleDebug()
+		}
+	}()
+
+	// Sharding
+	if cfg.Feeds.Sharding.Enabled {
+		sharder, err := newSharder(ctx, cfg.Feeds.Sharding, store)
+		if err != nil {
+			logger.Error("Failed to initialize sharding", "error", err)
+			os.Exit(1)
+		}
+		fetcher.SetSharder(sharder)
+
+		shardDone := make(chan struct{})
+		go func() {
+			defer close(shardDone)
+			sharder.Run(ctx)
+		}()
+		// Wait for the replica to deregister before exiting.
+		defer func() { <-shardDone }()
+		logger.Info("Sharding enabled", "replica", sharder.ID())
+	}
+
+	// WebSub
+	if cfg.Feeds.WebSub.Enabled {
+		if err := startWebSub(ctx, cfg, store, fetcher, policy, logger); err != nil {
+			logger.Error("Failed to initialize WebSub", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	// Run Fetcher
 	logger.Info("Starting RSS Fetcher",
 		"interval", cfg.Feeds.Interval,
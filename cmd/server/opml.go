@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"rss-fetcher/internal/config"
+)
+
+const opmlUsage = `Usage: rss-fetcher opml <command> [flags]
+
+Commands:
+  import   Merge the feeds of an OPML file into the feeds config
+  export   Write the configured feeds as OPML
+
+Run "rss-fetcher opml <command> -h" for command flags.`
+
+func runOPMLCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, opmlUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("opml "+args[0], flag.ContinueOnError)
+	feedsPath := flags.String("feeds", "config/feeds.yaml", "Path to feeds configuration file")
+	var (
+		write *bool
+		file  *string
+		title *string
+	)
+	switch args[0] {
+	case "import":
+		write = flags.Bool("w", false, "Write the merged config back to -feeds instead of stdout")
+		flags.Usage = func() {
+			fmt.Fprintln(flags.Output(), "Usage: rss-fetcher opml import [flags] <file.opml>\n\nFolders become feed tags and titles become names. Feeds already\nconfigured (by url or previous_urls) keep their settings and gain\nmissing names and tags.")
+			flags.PrintDefaults()
+		}
+	case "export":
+		file = flags.String("o", "", "Output file (default: stdout)")
+		title = flags.String("title", "rss-fetcher feeds", "OPML title")
+	default:
+		fmt.Fprintf(os.Stderr, "unknown opml command %q\n\n%s\n", args[0], opmlUsage)
+		return 2
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	// Keep stdout for command output; logs go to stderr.
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	switch args[0] {
+	case "import":
+		if flags.NArg() != 1 {
+			flags.Usage()
+			return 2
+		}
+		return runOPMLImport(logger, *feedsPath, flags.Arg(0), *write)
+	default:
+		return runOPMLExport(logger, *feedsPath, *file, *title)
+	}
+}
+
+func runOPMLImport(logger *slog.Logger, feedsPath, opmlPath string, write bool) int {
+	f, err := os.Open(opmlPath)
+	if err != nil {
+		logger.Error("Failed to open OPML file", "error", err)
+		return 1
+	}
+	imported, err := config.ParseOPML(f)
+	f.Close()
+	if err != nil {
+		logger.Error("Failed to read OPML file", "path", opmlPath, "error", err)
+		return 1
+	}
+
+	doc, err := os.ReadFile(feedsPath)
+	if err != nil && !(errors.Is(err, fs.ErrNotExist) && write) {
+		logger.Error("Failed to read feeds config", "error", err)
+		return 1
+	}
+	merged, result, err := config.MergeFeeds(doc, imported)
+	if err != nil {
+		logger.Error("Failed to merge feeds", "path", feedsPath, "error", err)
+		return 1
+	}
+
+	if write {
+		// Replace the file atomically so a failed write keeps the old config.
+		tmp, err := os.CreateTemp(filepath.Dir(feedsPath), ".feeds-*.yaml")
+		if err == nil {
+			_, err = tmp.Write(merged)
+			if closeErr := tmp.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = os.Rename(tmp.Name(), feedsPath)
+			}
+			if err != nil {
+				os.Remove(tmp.Name())
+			}
+		}
+		if err != nil {
+			logger.Error("Failed to write feeds config", "path", feedsPath, "error", err)
+			return 1
+		}
+	} else if _, err := os.Stdout.Write(merged); err != nil {
+		logger.Error("Failed to write feeds config", "error", err)
+		return 1
+	}
+
+	logger.Info("OPML imported",
+		"feeds", len(imported),
+		"added", result.Added,
+		"updated", result.Updated,
+		"unchanged", result.Unchanged)
+	return 0
+}
+
+func runOPMLExport(logger *slog.Logger, feedsPath, file, title string) int {
+	cfg, err := config.LoadFeeds(feedsPath)
+	if err != nil {
+		logger.Error("Failed to load config", "error", err)
+		return 1
+	}
+
+	out := os.Stdout
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			logger.Error("Failed to create output file", "error", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := config.WriteOPML(out, title, cfg.Feeds); err != nil {
+		logger.Error("Failed to write OPML", "error", err)
+		return 1
+	}
+	logger.Info("OPML exported", "feeds", len(cfg.Feeds))
+	return 0
+}
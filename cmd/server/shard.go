@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/shard"
+	"rss-fetcher/internal/state"
+)
+
+// newSharder registers this replica and loads the initial membership so
+// that the first run already processes only owned feeds.
+func newSharder(ctx context.Context, cfg config.ShardingConfig, store state.Store) (*shard.Sharder, error) {
+	membership, ok := store.(shard.Membership)
+	if !ok {
+		return nil, fmt.Errorf("store %T does not support shard membership", store)
+	}
+
+	id := cfg.ReplicaID
+	if id == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine replica id: %w", err)
+		}
+		id = hostname
+	}
+
+	sharder := shard.NewSharder(id, membership, cfg.HeartbeatInterval, cfg.ReplicaTTL)
+	refreshCtx, cancel := context.WithTimeout(ctx, cfg.HeartbeatInterval)
+	defer cancel()
+	if err := sharder.Refresh(refreshCtx); err != nil {
+		return nil, fmt.Errorf("failed to register replica: %w", err)
+	}
+	return sharder, nil
+}
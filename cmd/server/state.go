@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+)
+
+const stateUsage = `Usage: rss-fetcher state <command> [flags]
+
+Commands:
+  export   Write every stored feed state as JSON lines
+  import   Load feed states from JSON lines written by export
+  migrate  Upgrade stored feed states to the current schema version
+
+Run "rss-fetcher state <command> -h" for command flags.`
+
+func runStateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, stateUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("state "+args[0], flag.ContinueOnError)
+	feedsPath := fs.String("feeds", "config/feeds.yaml", "Path to feeds configuration file (selects the store)")
+	var (
+		file   *string
+		dryRun *bool
+	)
+	switch args[0] {
+	case "export":
+		file = fs.String("o", "", "Output file (default: stdout)")
+	case "import":
+		file = fs.String("i", "", "Input file (default: stdin)")
+		dryRun = fs.Bool("dry-run", false, "Print what would change without writing")
+	case "migrate":
+		dryRun = fs.Bool("dry-run", false, "Print what would change without writing")
+	default:
+		fmt.Fprintf(os.Stderr, "unknown state command %q\n\n%s\n", args[0], stateUsage)
+		return 2
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	// Keep stdout for command output; logs go to stderr.
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	cfg, err := config.LoadFeeds(*feedsPath)
+	if err != nil {
+		logger.Error("Failed to load config", "error", err)
+		return 1
+	}
+	if cfg.Store.Type == "memory" {
+		logger.Error("The memory store does not outlive the process; configure a persistent store.type to use state commands")
+		return 1
+	}
+
+	store, closeStore, err := openStore(cfg.Store, logger)
+	if err != nil {
+		logger.Error("Failed to initialize store", "error", err)
+		return 1
+	}
+	defer closeStore()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "export":
+		err = exportStates(ctx, store, *file, logger)
+	case "import":
+		err = importStates(ctx, store, *file, *dryRun, logger)
+	case "migrate":
+		err = migrateStates(ctx, store, *dryRun, logger)
+	}
+	if err != nil {
+		logger.Error("State command failed", "command", args[0], "error", err)
+		return 1
+	}
+	return 0
+}
+
+func exportStates(ctx context.Context, store state.Store, path string, logger *slog.Logger) error {
+	var w io.Writer = os.Stdout
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := state.Export(ctx, store, w)
+	if err != nil {
+		return err
+	}
+	logger.Info("Exported feed states", "count", n)
+	return nil
+}
+
+func importStates(ctx context.Context, store state.Store, path string, dryRun bool, logger *slog.Logger) error {
+	var r io.Reader = os.Stdin
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	changes, err := state.Import(ctx, store, r, dryRun)
+	printChanges(changes, dryRun)
+	if err != nil {
+		return err
+	}
+	logger.Info("Imported feed states", "records", len(changes), "dry_run", dryRun)
+	return nil
+}
+
+func migrateStates(ctx context.Context, store state.Store, dryRun bool, logger *slog.Logger) error {
+	changes, err := state.Migrate(ctx, store, dryRun)
+	printChanges(changes, dryRun)
+	if err != nil {
+		return err
+	}
+	logger.Info("Migrated feed states", "migrated", len(changes), "current_version", state.CurrentVersion, "dry_run", dryRun)
+	return nil
+}
+
+func printChanges(changes []state.Change, dryRun bool) {
+	prefix := ""
+	if dryRun {
+		prefix = "[dry-run] "
+	}
+	for _, c := range changes {
+		fmt.Printf("%s%s\n", prefix, c)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+)
+
+// openStore opens the configured state backend. The returned close
+// function must be called once the store is no longer used.
+func openStore(cfg config.StoreConfig, logger *slog.Logger) (state.Store, func(), error) {
+	switch cfg.Type {
+	case "valkey":
+		logger.Info("Using Valkey Store", "address", cfg.Address)
+		s, err := state.NewValkeyStore(cfg.Address, cfg.Password)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize Valkey store: %w", err)
+		}
+		return s, func() { s.Close() }, nil
+	case "bolt":
+		logger.Info("Using Bolt Store", "path", cfg.Path)
+		s, err := state.NewBoltStore(cfg.Path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize Bolt store: %w", err)
+		}
+		return s, func() { s.Close() }, nil
+	default:
+		logger.Info("Using Memory Store")
+		return state.NewMemoryStore(), func() {}, nil
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/feed"
+	"rss-fetcher/internal/netpolicy"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/websub"
+)
+
+// startWebSub starts the WebSub subscriber and its callback server. Both
+// stop when ctx is cancelled.
+func startWebSub(ctx context.Context, cfg *config.AppConfig, store state.Store, fetcher *feed.Fetcher, policy *netpolicy.Policy, logger *slog.Logger) error {
+	sub, err := websub.NewSubscriber(cfg.Feeds.WebSub, cfg.Webhooks.WebSubSecret, cfg.Feeds.Feeds, fetcher.ProcessPushedFeed)
+	if err != nil {
+		return err
+	}
+	sub.SetNetworkPolicy(policy)
+	// Hubs may verify a request at any replica behind the callback URL.
+	if locker, ok := store.(state.Locker); ok {
+		sub.SetLocker(locker)
+	}
+	fetcher.SetPushSubscriber(sub)
+	go sub.Run(ctx)
+
+	srv := &http.Server{
+		Addr:              cfg.Feeds.WebSub.Listen,
+		Handler:           sub,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		logger.Info("Starting WebSub callback server", "addr", srv.Addr, "callback_url", cfg.Feeds.WebSub.CallbackURL)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("WebSub callback server failed", "error", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	return nil
+}
@@ -0,0 +1,194 @@
+// Package alert sends operational alerts to the ops webhook.
+package alert
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/webhook"
+)
+
+var (
+	metricAlerts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_alerts_sent_total",
+		Help: "Alert messages sent to the ops webhook, by kind and state (firing or resolved)",
+	}, []string{"kind", "state"})
+
+	metricAlertsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_alerts_dropped_total",
+		Help: "Alerts not sent because alerts.max_per_hour was reached or the send queue was full",
+	}, []string{"kind"})
+
+	metricAlertsFiring = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rss_alerts_firing",
+		Help: "Conditions currently alerted by this replica",
+	})
+)
+
+const (
+	// rateWindow is the period alerts.max_per_hour applies to.
+	rateWindow = time.Hour
+	// queueSize is how many alerts may wait for Run to send them.
+	queueSize = 64
+	// sendTimeout bounds sending one alert, retries included.
+	sendTimeout = time.Minute
+)
+
+// Alert describes an operational condition.
+type Alert struct {
+	Kind    string // e.g. "stale"
+	Key     string // Identifies the condition, e.g. "stale:<feed key>"
+	Summary string // Short description, e.g. "Feed Example is stale"
+	Detail  string
+	URL     string // What the alert is about, e.g. the feed URL
+}
+
+// Notifier posts alerts through the ops webhook using the same providers
+// as item notifications. A condition is alerted once while it lasts, and
+// at most max_per_hour conditions are alerted per hour; resolutions are
+// always sent for conditions that were alerted.
+//
+// Alerts are sent by Run in the background, so a slow ops webhook never
+// holds up the reporter.
+type Notifier struct {
+	client      *webhook.Client
+	webhook     *config.Webhook
+	maxPerHour  int
+	logger      *slog.Logger
+	now         func() time.Time
+	queue       chan message
+	sendTimeout time.Duration
+
+	mu     sync.Mutex
+	firing map[string]bool // by key; false if the alert was dropped
+	sent   []time.Time     // firing alerts sent within rateWindow
+}
+
+// NewNotifier returns a Notifier for cfg. Without an ops webhook alerts are
+// dropped; the conditions are logged by their reporters either way.
+func NewNotifier(client *webhook.Client, cfg config.AlertsConfig) *Notifier {
+	return &Notifier{
+		client:      client,
+		webhook:     cfg.Webhook,
+		maxPerHour:  cfg.MaxPerHour,
+		logger:      slog.Default(),
+		now:         time.Now,
+		queue:       make(chan message, queueSize),
+		sendTimeout: sendTimeout,
+		firing:      make(map[string]bool),
+	}
+}
+
+// message is an alert waiting to be sent.
+type message struct {
+	alert  Alert
+	state  string
+	prefix string
+}
+
+// Run sends queued alerts until ctx is done.
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-n.queue:
+			n.send(ctx, m)
+		}
+	}
+}
+
+// Fire reports that a condition started. It does nothing if the condition
+// is already firing.
+func (n *Notifier) Fire(_ context.Context, a Alert) {
+	if n.webhook == nil {
+		return
+	}
+	n.mu.Lock()
+	if _, ok := n.firing[a.Key]; ok {
+		n.mu.Unlock()
+		return
+	}
+	allowed := n.allow()
+	n.firing[a.Key] = allowed
+	metricAlertsFiring.Set(float64(len(n.firing)))
+	n.mu.Unlock()
+
+	if !allowed {
+		n.logger.Warn("Alert rate limit reached; alert not sent", "alert", a.Key, "max_per_hour", n.maxPerHour)
+		metricAlertsDropped.WithLabelValues(a.Kind).Inc()
+		return
+	}
+	n.enqueue(message{alert: a, state: "firing", prefix: "[ALERT] "})
+}
+
+// Resolve reports that a condition cleared. A condition that fired before
+// this process started, such as a stale feed recorded in state, is
+// resolved too; one whose alert was dropped is not.
+func (n *Notifier) Resolve(_ context.Context, a Alert) {
+	if n.webhook == nil {
+		return
+	}
+	n.mu.Lock()
+	sent, ok := n.firing[a.Key]
+	delete(n.firing, a.Key)
+	metricAlertsFiring.Set(float64(len(n.firing)))
+	n.mu.Unlock()
+
+	if ok && !sent {
+		return
+	}
+	n.enqueue(message{alert: a, state: "resolved", prefix: "[RESOLVED] "})
+}
+
+// allow reports whether another alert may be sent now. n.mu must be held.
+func (n *Notifier) allow() bool {
+	if n.maxPerHour <= 0 {
+		return true
+	}
+	now := n.now()
+	kept := n.sent[:0]
+	for _, t := range n.sent {
+		if now.Sub(t) < rateWindow {
+			kept = append(kept, t)
+		}
+	}
+	n.sent = kept
+	if len(n.sent) >= n.maxPerHour {
+		return false
+	}
+	n.sent = append(n.sent, now)
+	return true
+}
+
+func (n *Notifier) enqueue(m message) {
+	select {
+	case n.queue <- m:
+	default:
+		n.logger.Warn("Alert queue full; alert not sent", "alert", m.alert.Key, "state", m.state)
+		metricAlertsDropped.WithLabelValues(m.alert.Kind).Inc()
+	}
+}
+
+func (n *Notifier) send(ctx context.Context, m message) {
+	ctx, cancel := context.WithTimeout(ctx, n.sendTimeout)
+	defer cancel()
+	a := m.alert
+	payload := webhook.Payload{
+		FeedTitle:   m.prefix + a.Summary,
+		ItemTitle:   a.Detail,
+		ItemURL:     a.URL,
+		PublishedAt: n.now(),
+	}
+	if err := n.client.SendWithRateLimit(ctx, *n.webhook, payload); err != nil {
+		n.logger.Error("Failed to send alert", "alert", a.Key, "state", m.state, "error", err)
+		return
+	}
+	metricAlerts.WithLabelValues(a.Kind, m.state).Inc()
+}
@@ -0,0 +1,138 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestNotifierSendsFiringAndResolvedMessages(t *testing.T) {
+	var titles []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			FeedTitle string `json:"feed_title"`
+			ItemURL   string `json:"item_url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode alert: %v", err)
+		}
+		if body.ItemURL != "https://example.com/feed.xml" {
+			t.Errorf("item_url = %q", body.ItemURL)
+		}
+		titles = append(titles, body.FeedTitle)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	n := NewNotifier(webhook.NewClient(), config.AlertsConfig{Webhook: &config.Webhook{
+		Name:     "ops",
+		URL:      server.URL,
+		Provider: "generic",
+	}})
+	a := Alert{Kind: "stale", Key: "stale:x", Summary: "Feed x is stale", URL: "https://example.com/feed.xml"}
+	n.Fire(context.Background(), a)
+	n.Resolve(context.Background(), a)
+	sendQueued(n)
+
+	want := []string{"[ALERT] Feed x is stale", "[RESOLVED] Feed x is stale"}
+	if len(titles) != len(want) || titles[0] != want[0] || titles[1] != want[1] {
+		t.Fatalf("titles = %q, want %q", titles, want)
+	}
+}
+
+func TestNotifierWithoutWebhookDropsAlerts(t *testing.T) {
+	n := NewNotifier(webhook.NewClient(), config.AlertsConfig{})
+	n.Fire(context.Background(), Alert{Kind: "stale", Key: "stale:x"})
+}
+
+func TestNotifierDeduplicatesAndRateLimits(t *testing.T) {
+	var titles []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			FeedTitle string `json:"feed_title"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode alert: %v", err)
+		}
+		titles = append(titles, body.FeedTitle)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	n := NewNotifier(webhook.NewClient(), config.AlertsConfig{
+		Webhook:    &config.Webhook{URL: server.URL, Provider: "generic"},
+		MaxPerHour: 2,
+	})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+	ctx := context.Background()
+	a := Alert{Kind: "feed_failure", Key: "a", Summary: "a"}
+	b := Alert{Kind: "feed_failure", Key: "b", Summary: "b"}
+	c := Alert{Kind: "feed_failure", Key: "c", Summary: "c"}
+
+	n.Fire(ctx, a)
+	n.Fire(ctx, a) // already firing
+	n.Fire(ctx, b)
+	n.Fire(ctx, c) // over max_per_hour
+	n.Resolve(ctx, c)
+	n.Resolve(ctx, a)
+	now = now.Add(time.Hour)
+	n.Fire(ctx, c)
+	sendQueued(n)
+
+	want := []string{"[ALERT] a", "[ALERT] b", "[RESOLVED] a", "[ALERT] c"}
+	if !slices.Equal(titles, want) {
+		t.Fatalf("titles = %q, want %q", titles, want)
+	}
+}
+
+// sendQueued sends the alerts queued so far, like Run.
+func sendQueued(n *Notifier) {
+	for len(n.queue) > 0 {
+		n.send(context.Background(), <-n.queue)
+	}
+}
+
+func TestNotifierBoundsEachSend(t *testing.T) {
+	received := make(chan string, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			FeedTitle string `json:"feed_title"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode alert: %v", err)
+		}
+		received <- body.FeedTitle
+		// The ops webhook hangs.
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	n := NewNotifier(webhook.NewClient(), config.AlertsConfig{Webhook: &config.Webhook{URL: server.URL, Provider: "generic"}})
+	n.sendTimeout = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go n.Run(ctx)
+
+	// Neither call waits for the webhook.
+	n.Fire(ctx, Alert{Kind: "stale", Key: "a", Summary: "a"})
+	n.Fire(ctx, Alert{Kind: "stale", Key: "b", Summary: "b"})
+
+	for _, want := range []string{"[ALERT] a", "[ALERT] b"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Fatalf("alert = %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("alert %q was not sent", want)
+		}
+	}
+}
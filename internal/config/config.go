@@ -2,26 +2,69 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"rss-fetcher/internal/cron"
 )
 
 type FeedsConfig struct {
-	Feeds                           []Feed        `yaml:"feeds"`
-	Interval                        time.Duration `yaml:"interval"`
-	Store                           StoreConfig   `yaml:"store"`
-	SkipInitialNotify               bool          `yaml:"skip_initial_notify"`
-	InitialWarmupStableObservations int           `yaml:"initial_warmup_stable_observations"`
-	MaxNotificationsPerFeedPerRun   int           `yaml:"max_notifications_per_feed_per_run"`
+	Feeds                           []Feed              `yaml:"feeds"`
+	OPMLFiles                       []string            `yaml:"opml_files"` // Feeds to add, relative to the feeds config file
+	Interval                        time.Duration       `yaml:"interval"`
+	Store                           StoreConfig         `yaml:"store"`
+	SkipInitialNotify               bool                `yaml:"skip_initial_notify"`
+	InitialWarmupStableObservations int                 `yaml:"initial_warmup_stable_observations"`
+	MaxNotificationsPerFeedPerRun   int                 `yaml:"max_notifications_per_feed_per_run"`
+	BurstPolicy                     string              `yaml:"burst_policy"`                      // Default; see BurstPolicies
+	NotifyOnUpdate                  bool                `yaml:"notify_on_update"`                  // Notify changed items of every feed
+	MaxUpdateNotificationsPerItem   int                 `yaml:"max_update_notifications_per_item"` // 0 is unlimited
+	OrphanGracePeriod               time.Duration       `yaml:"orphan_grace_period"`               // 0 keeps orphaned states forever
+	StaleAfter                      time.Duration       `yaml:"stale_after"`                       // Default; 0 disables stale detection
+	Sharding                        ShardingConfig      `yaml:"sharding"`
+	Concurrency                     ConcurrencyConfig   `yaml:"concurrency"`
+	Scheduler                       SchedulerConfig     `yaml:"scheduler"`
+	WebSub                          WebSubConfig        `yaml:"websub"`
+	Fetch                           FetchConfig         `yaml:"fetch"`
+	NetworkPolicy                   NetworkPolicyConfig `yaml:"network_policy"`
+	Metrics                         MetricsConfig       `yaml:"metrics"`
+	Tracing                         TracingConfig       `yaml:"tracing"`
+	Log                             LogConfig           `yaml:"log"`
+	Admin                           AdminConfig         `yaml:"admin"`
 }
 
 type Feed struct {
-	Name string `yaml:"name"`
+	ID   string `yaml:"id,omitempty"` // Stable state key; defaults to the URL
+	Name string `yaml:"name,omitempty"`
 	URL  string `yaml:"url"`
+	// PreviousURLs are keys the feed's state was stored under before its
+	// URL (or ID) changed. Found state is carried over to Key.
+	PreviousURLs []string `yaml:"previous_urls,omitempty"`
+	Tags         []string `yaml:"tags,omitempty"` // e.g. OPML folders
+	// StaleAfter overrides the default stale_after for this feed.
+	StaleAfter time.Duration `yaml:"stale_after,omitempty"`
+	Debug      bool          `yaml:"debug,omitempty"` // Log this feed at debug level
+	// BurstPolicy overrides the default burst_policy for this feed.
+	BurstPolicy    string `yaml:"burst_policy,omitempty"`
+	NotifyOnUpdate bool   `yaml:"notify_on_update,omitempty"` // Notify changed items of this feed
 }
 
+// BurstPolicies are what a run does with more new items of a feed than
+// max_notifications_per_feed_per_run:
+//   - suppress notifies none of them and advances the baseline
+//   - newest_n notifies the newest max_notifications_per_feed_per_run
+//   - digest notifies all of them in one digest message per webhook
+//   - hold keeps them in the store until approved or rejected
+var BurstPolicies = []string{"suppress", "newest_n", "digest", "hold"}
+
 func (f Feed) Label() string {
 	if f.Name != "" {
 		return f.Name
@@ -29,6 +72,29 @@ func (f Feed) Label() string {
 	return f.URL
 }
 
+// Key is the key the feed's state is stored under.
+func (f Feed) Key() string {
+	if f.ID != "" {
+		return f.ID
+	}
+	return f.URL
+}
+
+// PreviousKeys lists the keys the feed's state may have been stored under
+// before, including the URL of a feed that has since been given an ID.
+func (f Feed) PreviousKeys() []string {
+	var keys []string
+	if f.ID != "" && f.URL != f.ID {
+		keys = append(keys, f.URL)
+	}
+	for _, previous := range f.PreviousURLs {
+		if previous != "" && previous != f.Key() && !slices.Contains(keys, previous) {
+			keys = append(keys, previous)
+		}
+	}
+	return keys
+}
+
 func (f *Feed) UnmarshalYAML(value *yaml.Node) error {
 	switch value.Kind {
 	case yaml.ScalarNode:
@@ -47,18 +113,99 @@ func (f *Feed) UnmarshalYAML(value *yaml.Node) error {
 		*f = Feed(decoded)
 		return nil
 	default:
-		return fmt.Errorf("feed must be a URL string or mapping with url/name")
+		return fmt.Errorf("feed must be a URL string or mapping with url/name/id/previous_urls/tags/stale_after/debug/burst_policy/notify_on_update")
 	}
 }
 
 type StoreConfig struct {
-	Type     string `yaml:"type"` // "memory" or "valkey"
+	Type     string `yaml:"type"` // "memory", "valkey" or "bolt"
 	Address  string `yaml:"address"`
 	Password string `yaml:"password"`
+	Path     string `yaml:"path"` // Database file for the bolt store
+}
+
+type ShardingConfig struct {
+	Enabled           bool          `yaml:"enabled"`
+	ReplicaID         string        `yaml:"replica_id"` // Defaults to the hostname
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval"`
+	ReplicaTTL        time.Duration `yaml:"replica_ttl"` // How long a replica stays a member without heartbeats
+}
+
+type ConcurrencyConfig struct {
+	MaxWorkers   int           `yaml:"max_workers"`    // Feeds processed at once; 0 is unlimited
+	PerHost      int           `yaml:"per_host"`       // Fetches in flight per host; 0 is unlimited
+	PerHostDelay time.Duration `yaml:"per_host_delay"` // Minimum delay between fetch starts to one host
+	Jitter       time.Duration `yaml:"jitter"`         // Spread feed starts over this window of each run
+}
+
+type SchedulerConfig struct {
+	Mode        string        `yaml:"mode"`         // "fixed" (default) or "adaptive"
+	MinInterval time.Duration `yaml:"min_interval"` // Shortest adaptive poll interval
+	MaxInterval time.Duration `yaml:"max_interval"` // Longest adaptive poll interval
+}
+
+type FetchConfig struct {
+	Timeout             time.Duration `yaml:"timeout"`               // Per request, including the body; 0 is unlimited
+	MaxBodySize         int64         `yaml:"max_body_size"`         // Bytes transferred; 0 is unlimited
+	MaxDecompressedSize int64         `yaml:"max_decompressed_size"` // Bytes after decompression; 0 is unlimited
+}
+
+type MetricsConfig struct {
+	// PerFeedLabels labels feed metrics with the feed name. Disable it to
+	// bound cardinality with many feeds; feed metrics are then aggregated.
+	PerFeedLabels bool `yaml:"per_feed_labels"`
+}
+
+// TracingConfig enables OpenTelemetry tracing. The exporter is configured
+// with the standard OTEL_* environment variables.
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// LogConfig sets the level and format of the server's logs. The level can
+// be changed at runtime; see the logging package.
+type LogConfig struct {
+	Level  string `yaml:"level"`  // "debug", "info", "warn" or "error"
+	Format string `yaml:"format"` // "json", "text" or "logfmt"
+}
+
+// AdminConfig serves the admin API, which changes the server's state, on a
+// listener of its own. It is off unless Listen is set.
+type AdminConfig struct {
+	Listen string `yaml:"listen"` // e.g. "127.0.0.1:9091"; keep it off public networks
+}
+
+// NetworkPolicyConfig applies to feed, WebSub hub and webhook requests.
+type NetworkPolicyConfig struct {
+	BlockPrivate bool     `yaml:"block_private"` // Refuse loopback, private, link-local and metadata addresses
+	Allow        []string `yaml:"allow"`         // CIDRs, IP addresses or host names exempt from the block
+}
+
+type WebSubConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	CallbackURL string        `yaml:"callback_url"` // Public base URL routed to Listen
+	Listen      string        `yaml:"listen"`       // Address of the callback server
+	Lease       time.Duration `yaml:"lease"`        // Requested subscription lease
 }
 
 type WebhooksConfig struct {
 	Webhooks []Webhook `yaml:"webhooks"`
+	// WebSubSecret derives the WebSub callback paths and signing secrets.
+	// Replicas sharing subscriptions must use the same value.
+	WebSubSecret string       `yaml:"websub_secret"`
+	Alerts       AlertsConfig `yaml:"alerts"`
+}
+
+// AlertsConfig sends operational alerts, such as stale feeds, to a webhook
+// of their own. The thresholds count consecutive failures before an alert
+// fires; 0 disables that alert.
+type AlertsConfig struct {
+	Webhook         *Webhook `yaml:"webhook"`          // Alerts are only logged if nil
+	FeedFailures    int      `yaml:"feed_failures"`    // Failed fetches of one feed
+	WebhookFailures int      `yaml:"webhook_failures"` // Rejected deliveries to one webhook
+	StoreFailures   int      `yaml:"store_failures"`   // Failed state store operations
+	Burst           bool     `yaml:"burst"`            // Alert on suppressed notification bursts
+	MaxPerHour      int      `yaml:"max_per_hour"`     // Alerts fired per hour; 0 is unlimited
 }
 
 type Webhook struct {
@@ -67,6 +214,173 @@ type Webhook struct {
 	Provider     string        `yaml:"provider"` // "generic" (default), "discord", or "misskey"
 	PostInterval time.Duration `yaml:"post_interval"`
 	APIToken     string        `yaml:"api_token"` // Required for misskey
+	// Digest batches items into periodic messages instead of posting each.
+	Digest *DigestConfig `yaml:"digest"`
+	// DeliveryWindow holds items found outside it until it opens.
+	DeliveryWindow *DeliveryWindowConfig `yaml:"delivery_window"`
+	// DedupWindow skips items whose canonical URL or GUID was posted to
+	// the webhook, from any feed, within this long. 0 disables it.
+	DedupWindow time.Duration `yaml:"dedup_window"`
+}
+
+// DeliveryWindowConfig limits when a webhook is posted to. A time is in
+// the window if its day is one of Days and its time of day is in one of
+// Hours, both in Timezone. A range ending before it starts, such as
+// "22:00-06:00", spans midnight.
+type DeliveryWindowConfig struct {
+	Days     []string `yaml:"days"`     // "mon" to "sun"; every day if empty
+	Hours    []string `yaml:"hours"`    // "HH:MM-HH:MM" ranges, end excluded; all day if empty
+	Timezone string   `yaml:"timezone"` // IANA name; defaults to UTC
+	// Deliver is how items held outside the window are posted when it
+	// opens: "individual" (default) or "digest".
+	Deliver string `yaml:"deliver"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Contains reports whether t is in the window. A range that spans
+// midnight belongs to the day it starts on, so its hours after midnight
+// are in the window if the previous day is.
+func (w *DeliveryWindowConfig) Contains(t time.Time) (bool, error) {
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return false, err
+	}
+	t = t.In(loc)
+	onDay := func(weekday time.Weekday) bool {
+		return len(w.Days) == 0 || slices.ContainsFunc(w.Days, func(day string) bool {
+			return weekdays[strings.ToLower(day)] == weekday
+		})
+	}
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	if len(w.Hours) == 0 {
+		return onDay(today), nil
+	}
+	minute := t.Hour()*60 + t.Minute()
+	for _, hours := range w.Hours {
+		start, end, err := parseHours(hours)
+		if err != nil {
+			return false, err
+		}
+		if start <= end && onDay(today) && minute >= start && minute < end ||
+			start > end && (onDay(today) && minute >= start || onDay(yesterday) && minute < end) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// parseHours parses "HH:MM-HH:MM" into minutes of the day. "24:00" ends a
+// range at midnight.
+func parseHours(hours string) (start, end int, err error) {
+	from, to, ok := strings.Cut(hours, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("hours %q must be HH:MM-HH:MM", hours)
+	}
+	parse := func(s string) (int, error) {
+		var h, m int
+		if _, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+			return 0, fmt.Errorf("invalid time %q in hours %q", s, hours)
+		}
+		return h*60 + m, nil
+	}
+	if start, err = parse(from); err != nil {
+		return 0, 0, err
+	}
+	if end, err = parse(to); err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("hours %q is empty", hours)
+	}
+	return start, end, nil
+}
+
+func (w *DeliveryWindowConfig) validate() error {
+	for _, day := range w.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown day %q", day)
+		}
+	}
+	for _, hours := range w.Hours {
+		if _, _, err := parseHours(hours); err != nil {
+			return err
+		}
+	}
+	if _, err := time.LoadLocation(w.Timezone); err != nil {
+		return err
+	}
+	switch w.Deliver {
+	case "", "individual", "digest":
+	default:
+		return fmt.Errorf("unknown deliver %q", w.Deliver)
+	}
+	return nil
+}
+
+// DigestConfig flushes a webhook's queued items as one message, split to
+// fit the provider, either Interval after the oldest item was queued or at
+// the next Schedule time after that.
+type DigestConfig struct {
+	Interval  time.Duration `yaml:"interval"`
+	Schedule  string        `yaml:"schedule"`   // Cron expression, e.g. "0 9 * * *"
+	Timezone  string        `yaml:"timezone"`   // IANA name Schedule is evaluated in; defaults to UTC
+	Template  string        `yaml:"template"`   // text/template for the message text
+	MaxLength int           `yaml:"max_length"` // Characters per message; defaults to the provider's limit
+}
+
+// NextFlush returns when items queued since oldest are due.
+func (d *DigestConfig) NextFlush(oldest time.Time) (time.Time, error) {
+	if d.Schedule == "" {
+		return oldest.Add(d.Interval), nil
+	}
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	schedule, err := cron.Parse(d.Schedule, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := schedule.Next(oldest)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never matches", d.Schedule)
+	}
+	return next, nil
+}
+
+func (d *DigestConfig) validate() error {
+	if (d.Interval > 0) == (d.Schedule != "") {
+		return fmt.Errorf("exactly one of interval and schedule is required")
+	}
+	if d.Interval < 0 {
+		return fmt.Errorf("interval must be > 0")
+	}
+	if d.MaxLength < 0 {
+		return fmt.Errorf("max_length must be >= 0")
+	}
+	if _, err := d.NextFlush(time.Now()); err != nil {
+		return err
+	}
+	if _, err := template.New("digest").Parse(d.Template); err != nil {
+		return fmt.Errorf("template: %w", err)
+	}
+	return nil
+}
+
+// Label identifies the webhook in logs, metrics and alerts without exposing
+// its URL, which may embed a token.
+func (w Webhook) Label() string {
+	if w.Name != "" {
+		return w.Name
+	}
+	if u, err := url.Parse(w.URL); err == nil {
+		return u.Host
+	}
+	return ""
 }
 
 type AppConfig struct {
@@ -75,23 +389,21 @@ type AppConfig struct {
 }
 
 func Load(feedsPath, webhooksPath string) (*AppConfig, error) {
-	// Defaults
+	feeds, err := LoadFeeds(feedsPath)
+	if err != nil {
+		return nil, err
+	}
 	c := &AppConfig{
-		Feeds: &FeedsConfig{
-			Interval:                        10 * time.Minute,
-			SkipInitialNotify:               true,
-			InitialWarmupStableObservations: 2,
-			MaxNotificationsPerFeedPerRun:   10,
-			Store: StoreConfig{
-				Type: "memory",
+		Feeds: feeds,
+		Webhooks: &WebhooksConfig{
+			Alerts: AlertsConfig{
+				FeedFailures:    3,
+				WebhookFailures: 3,
+				StoreFailures:   3,
+				Burst:           true,
+				MaxPerHour:      20,
 			},
 		},
-		Webhooks: &WebhooksConfig{},
-	}
-
-	// Load Feeds
-	if err := loadYaml(feedsPath, c.Feeds); err != nil {
-		return nil, fmt.Errorf("failed to load feeds config: %w", err)
 	}
 
 	// Load Webhooks
@@ -99,14 +411,6 @@ func Load(feedsPath, webhooksPath string) (*AppConfig, error) {
 		return nil, fmt.Errorf("failed to load webhooks config: %w", err)
 	}
 
-	if len(c.Feeds.Feeds) == 0 {
-		return nil, fmt.Errorf("no feeds configured")
-	}
-	for i, feed := range c.Feeds.Feeds {
-		if feed.URL == "" {
-			return nil, fmt.Errorf("feeds[%d].url is required", i)
-		}
-	}
 	if len(c.Webhooks.Webhooks) == 0 {
 		return nil, fmt.Errorf("no webhooks configured")
 	}
@@ -114,12 +418,33 @@ func Load(feedsPath, webhooksPath string) (*AppConfig, error) {
 		if wh.URL == "" {
 			return nil, fmt.Errorf("webhooks[%d].url is required", i)
 		}
+		if wh.Digest != nil {
+			if err := wh.Digest.validate(); err != nil {
+				return nil, fmt.Errorf("webhooks[%d].digest: %w", i, err)
+			}
+		}
+		if wh.DeliveryWindow != nil {
+			if err := wh.DeliveryWindow.validate(); err != nil {
+				return nil, fmt.Errorf("webhooks[%d].delivery_window: %w", i, err)
+			}
+		}
+		if wh.DedupWindow < 0 {
+			return nil, fmt.Errorf("webhooks[%d].dedup_window must be >= 0", i)
+		}
 	}
-	if c.Feeds.InitialWarmupStableObservations < 1 {
-		return nil, fmt.Errorf("initial_warmup_stable_observations must be >= 1")
+
+	if c.Feeds.WebSub.Enabled && c.Feeds.Sharding.Enabled && c.Webhooks.WebSubSecret == "" {
+		return nil, fmt.Errorf("websub_secret is required when websub and sharding are both enabled")
 	}
-	if c.Feeds.MaxNotificationsPerFeedPerRun < 0 {
-		return nil, fmt.Errorf("max_notifications_per_feed_per_run must be >= 0")
+
+	if wh := c.Webhooks.Alerts.Webhook; wh != nil && wh.URL == "" {
+		return nil, fmt.Errorf("alerts.webhook.url is required")
+	}
+	if a := c.Webhooks.Alerts; a.FeedFailures < 0 || a.WebhookFailures < 0 || a.StoreFailures < 0 {
+		return nil, fmt.Errorf("alerts failure thresholds must be >= 0")
+	}
+	if c.Webhooks.Alerts.MaxPerHour < 0 {
+		return nil, fmt.Errorf("alerts.max_per_hour must be >= 0")
 	}
 
 	// Set default provider
@@ -128,10 +453,209 @@ func Load(feedsPath, webhooksPath string) (*AppConfig, error) {
 			c.Webhooks.Webhooks[i].Provider = "generic"
 		}
 	}
+	if wh := c.Webhooks.Alerts.Webhook; wh != nil && wh.Provider == "" {
+		wh.Provider = "generic"
+	}
 
 	return c, nil
 }
 
+// LoadFeeds loads and validates only the feeds configuration. Commands
+// that work on stored state use it so they do not need webhook secrets.
+func LoadFeeds(feedsPath string) (*FeedsConfig, error) {
+	// Defaults
+	c := &FeedsConfig{
+		Interval:                        10 * time.Minute,
+		SkipInitialNotify:               true,
+		InitialWarmupStableObservations: 2,
+		MaxNotificationsPerFeedPerRun:   10,
+		BurstPolicy:                     "suppress",
+		MaxUpdateNotificationsPerItem:   3,
+		OrphanGracePeriod:               7 * 24 * time.Hour,
+		Store: StoreConfig{
+			Type: "memory",
+			Path: "data/state.db",
+		},
+		Sharding: ShardingConfig{
+			HeartbeatInterval: 10 * time.Second,
+			ReplicaTTL:        30 * time.Second,
+		},
+		Scheduler: SchedulerConfig{
+			Mode:        "fixed",
+			MinInterval: 5 * time.Minute,
+			MaxInterval: 24 * time.Hour,
+		},
+		WebSub: WebSubConfig{
+			Listen: ":8080",
+			Lease:  24 * time.Hour,
+		},
+		Fetch: FetchConfig{
+			Timeout:             30 * time.Second,
+			MaxBodySize:         10 << 20,
+			MaxDecompressedSize: 50 << 20,
+		},
+		Metrics: MetricsConfig{
+			PerFeedLabels: true,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+	}
+
+	// Load Feeds. An OPML file is accepted in place of the YAML config and
+	// only provides the feeds.
+	if strings.EqualFold(filepath.Ext(feedsPath), ".opml") {
+		c.OPMLFiles = []string{filepath.Base(feedsPath)}
+	} else if err := loadYaml(feedsPath, c); err != nil {
+		return nil, fmt.Errorf("failed to load feeds config: %w", err)
+	}
+	// Feeds configured in YAML win over the same feed in an OPML file.
+	for _, path := range c.OPMLFiles {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(feedsPath), path)
+		}
+		imported, err := loadOPML(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, feed := range imported {
+			if !slices.ContainsFunc(c.Feeds, func(f Feed) bool { return f.URL == feed.URL || f.Key() == feed.Key() }) {
+				c.Feeds = append(c.Feeds, feed)
+			}
+		}
+	}
+
+	if len(c.Feeds) == 0 {
+		return nil, fmt.Errorf("no feeds configured")
+	}
+	keys := make(map[string]int, len(c.Feeds))
+	for i, feed := range c.Feeds {
+		if feed.URL == "" {
+			return nil, fmt.Errorf("feeds[%d].url is required", i)
+		}
+		if feed.StaleAfter < 0 {
+			return nil, fmt.Errorf("feeds[%d].stale_after must be >= 0", i)
+		}
+		if feed.BurstPolicy != "" && !slices.Contains(BurstPolicies, feed.BurstPolicy) {
+			return nil, fmt.Errorf("feeds[%d]: unknown burst_policy %q", i, feed.BurstPolicy)
+		}
+		if j, ok := keys[feed.Key()]; ok {
+			return nil, fmt.Errorf("feeds[%d] and feeds[%d] have the same id or url %q", j, i, feed.Key())
+		}
+		keys[feed.Key()] = i
+	}
+	switch c.Store.Type {
+	case "memory", "valkey":
+	case "bolt":
+		if c.Store.Path == "" {
+			return nil, fmt.Errorf("store.path is required for bolt store")
+		}
+	default:
+		// Unknown types have always meant the memory store.
+		slog.Warn("Unknown store.type; using the memory store", "type", c.Store.Type)
+		c.Store.Type = "memory"
+	}
+	if c.InitialWarmupStableObservations < 1 {
+		return nil, fmt.Errorf("initial_warmup_stable_observations must be >= 1")
+	}
+	if c.MaxNotificationsPerFeedPerRun < 0 {
+		return nil, fmt.Errorf("max_notifications_per_feed_per_run must be >= 0")
+	}
+	if c.MaxUpdateNotificationsPerItem < 0 {
+		return nil, fmt.Errorf("max_update_notifications_per_item must be >= 0")
+	}
+	if !slices.Contains(BurstPolicies, c.BurstPolicy) {
+		return nil, fmt.Errorf("unknown burst_policy %q", c.BurstPolicy)
+	}
+	if c.OrphanGracePeriod < 0 {
+		return nil, fmt.Errorf("orphan_grace_period must be >= 0")
+	}
+	if c.StaleAfter < 0 {
+		return nil, fmt.Errorf("stale_after must be >= 0")
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		return nil, fmt.Errorf("unknown log.level %q", c.Log.Level)
+	}
+	switch c.Log.Format {
+	case "json", "text", "logfmt":
+	default:
+		return nil, fmt.Errorf("unknown log.format %q", c.Log.Format)
+	}
+	if c.Concurrency.MaxWorkers < 0 {
+		return nil, fmt.Errorf("concurrency.max_workers must be >= 0")
+	}
+	if c.Concurrency.PerHost < 0 {
+		return nil, fmt.Errorf("concurrency.per_host must be >= 0")
+	}
+	if c.Concurrency.PerHostDelay < 0 {
+		return nil, fmt.Errorf("concurrency.per_host_delay must be >= 0")
+	}
+	if c.Concurrency.Jitter < 0 || c.Concurrency.Jitter >= c.Interval {
+		return nil, fmt.Errorf("concurrency.jitter must be >= 0 and less than interval")
+	}
+	switch c.Scheduler.Mode {
+	case "fixed":
+	case "adaptive":
+		if c.Scheduler.MinInterval <= 0 {
+			return nil, fmt.Errorf("scheduler.min_interval must be > 0")
+		}
+		if c.Scheduler.MaxInterval < c.Scheduler.MinInterval {
+			return nil, fmt.Errorf("scheduler.max_interval must be >= scheduler.min_interval")
+		}
+		if c.Concurrency.Jitter >= c.Scheduler.MinInterval {
+			return nil, fmt.Errorf("concurrency.jitter must be less than scheduler.min_interval")
+		}
+	default:
+		return nil, fmt.Errorf("unknown scheduler.mode %q", c.Scheduler.Mode)
+	}
+	if c.Fetch.Timeout < 0 {
+		return nil, fmt.Errorf("fetch.timeout must be >= 0")
+	}
+	if c.Fetch.MaxBodySize < 0 || c.Fetch.MaxDecompressedSize < 0 {
+		return nil, fmt.Errorf("fetch.max_body_size and fetch.max_decompressed_size must be >= 0")
+	}
+	if c.WebSub.Enabled {
+		u, err := url.Parse(c.WebSub.CallbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("websub.callback_url must be an absolute http(s) URL")
+		}
+		if c.WebSub.Listen == "" {
+			return nil, fmt.Errorf("websub.listen is required")
+		}
+		if c.WebSub.Lease < time.Minute {
+			return nil, fmt.Errorf("websub.lease must be >= 1m")
+		}
+	}
+	if c.Sharding.Enabled {
+		if c.Store.Type != "valkey" {
+			return nil, fmt.Errorf("sharding requires store.type valkey")
+		}
+		if c.Sharding.HeartbeatInterval <= 0 {
+			return nil, fmt.Errorf("sharding.heartbeat_interval must be > 0")
+		}
+		if c.Sharding.ReplicaTTL <= c.Sharding.HeartbeatInterval {
+			return nil, fmt.Errorf("sharding.replica_ttl must be greater than sharding.heartbeat_interval")
+		}
+	}
+
+	return c, nil
+}
+
+func loadOPML(path string) ([]Feed, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OPML feeds: %w", err)
+	}
+	defer f.Close()
+	feeds, err := ParseOPML(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return feeds, nil
+}
+
 func loadYaml(path string, out interface{}) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestLoadSupportsStringAndNamedFeeds(t *testing.T) {
@@ -69,3 +70,195 @@ webhooks:
 		t.Fatal("Load returned nil error for feed without URL")
 	}
 }
+
+func TestLoadFallsBackToMemoryForUnknownStoreType(t *testing.T) {
+	dir := t.TempDir()
+	feedsPath := filepath.Join(dir, "feeds.yaml")
+	webhooksPath := filepath.Join(dir, "webhooks.yaml")
+
+	if err := os.WriteFile(feedsPath, []byte(`
+feeds:
+  - https://example.com/rss.xml
+store:
+  type: sqlite
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(webhooksPath, []byte(`
+webhooks:
+  - name: test
+    url: https://example.com/webhook
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(feedsPath, webhooksPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Feeds.Store.Type != "memory" {
+		t.Fatalf("store type = %q, want memory", cfg.Feeds.Store.Type)
+	}
+}
+
+func TestLoadValidatesBurstPolicy(t *testing.T) {
+	dir := t.TempDir()
+	feedsPath := filepath.Join(dir, "feeds.yaml")
+	webhooksPath := filepath.Join(dir, "webhooks.yaml")
+
+	if err := os.WriteFile(webhooksPath, []byte(`
+webhooks:
+  - name: test
+    url: https://example.com/webhook
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for feeds, wantErr := range map[string]bool{
+		"burst_policy: hold\nfeeds:\n  - {url: https://example.com/rss.xml, burst_policy: newest_n}": false,
+		"burst_policy: drop\nfeeds:\n  - https://example.com/rss.xml":                                true,
+		"feeds:\n  - {url: https://example.com/rss.xml, burst_policy: later}":                        true,
+	} {
+		if err := os.WriteFile(feedsPath, []byte(feeds), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(feedsPath, webhooksPath); (err != nil) != wantErr {
+			t.Errorf("%q: Load error = %v, want error %v", feeds, err, wantErr)
+		}
+	}
+}
+
+func TestLoadValidatesDigest(t *testing.T) {
+	dir := t.TempDir()
+	feedsPath := filepath.Join(dir, "feeds.yaml")
+	webhooksPath := filepath.Join(dir, "webhooks.yaml")
+
+	if err := os.WriteFile(feedsPath, []byte(`
+feeds:
+  - https://example.com/rss.xml
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for digest, wantErr := range map[string]bool{
+		`{interval: 1h}`: false,
+		`{schedule: "0 9 * * mon-fri", timezone: Asia/Tokyo}`: false,
+		`{}`:                                 true,
+		`{interval: 1h, schedule: "@daily"}`: true,
+		`{schedule: "0 25 * * *"}`:           true,
+		`{schedule: "@daily", timezone: Mars/Olympus}`: true,
+		`{interval: 1h, template: "{{.Items"}`:         true,
+	} {
+		if err := os.WriteFile(webhooksPath, []byte(`
+webhooks:
+  - name: test
+    url: https://example.com/webhook
+    digest: `+digest+`
+`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(feedsPath, webhooksPath); (err != nil) != wantErr {
+			t.Errorf("digest %s: Load error = %v, want error %v", digest, err, wantErr)
+		}
+	}
+}
+
+func TestLoadValidatesDeliveryWindow(t *testing.T) {
+	dir := t.TempDir()
+	feedsPath := filepath.Join(dir, "feeds.yaml")
+	webhooksPath := filepath.Join(dir, "webhooks.yaml")
+
+	if err := os.WriteFile(feedsPath, []byte(`
+feeds:
+  - https://example.com/rss.xml
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for window, wantErr := range map[string]bool{
+		`{days: [mon, fri], hours: ["09:00-18:00"], timezone: Asia/Tokyo}`: false,
+		`{hours: ["22:00-24:00", "00:00-06:00"], deliver: digest}`:         false,
+		`{days: [someday]}`:        true,
+		`{hours: ["9-18"]}`:        true,
+		`{hours: ["09:00-09:00"]}`: true,
+		`{hours: ["09:00-25:00"]}`: true,
+		`{timezone: Mars/Olympus}`: true,
+		`{deliver: later}`:         true,
+	} {
+		if err := os.WriteFile(webhooksPath, []byte(`
+webhooks:
+  - name: test
+    url: https://example.com/webhook
+    delivery_window: `+window+`
+`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(feedsPath, webhooksPath); (err != nil) != wantErr {
+			t.Errorf("delivery_window %s: Load error = %v, want error %v", window, err, wantErr)
+		}
+	}
+}
+
+func TestLoadValidatesDedupWindow(t *testing.T) {
+	dir := t.TempDir()
+	feedsPath := filepath.Join(dir, "feeds.yaml")
+	webhooksPath := filepath.Join(dir, "webhooks.yaml")
+
+	if err := os.WriteFile(feedsPath, []byte(`
+feeds:
+  - https://example.com/rss.xml
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for window, wantErr := range map[string]bool{
+		"0s":  false,
+		"24h": false,
+		"-1h": true,
+	} {
+		if err := os.WriteFile(webhooksPath, []byte(`
+webhooks:
+  - name: test
+    url: https://example.com/webhook
+    dedup_window: `+window+`
+`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(feedsPath, webhooksPath); (err != nil) != wantErr {
+			t.Errorf("dedup_window %s: Load error = %v, want error %v", window, err, wantErr)
+		}
+	}
+}
+
+func TestDeliveryWindowContains(t *testing.T) {
+	window := &DeliveryWindowConfig{
+		Days:     []string{"mon", "tue", "wed", "thu", "fri"},
+		Hours:    []string{"22:00-06:00"},
+		Timezone: "Asia/Tokyo",
+	}
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2026, 10, 19, 22, 0, 0, 0, tokyo), true},  // Monday evening
+		{time.Date(2026, 10, 20, 5, 59, 0, 0, tokyo), true},  // Tuesday morning
+		{time.Date(2026, 10, 20, 6, 0, 0, 0, tokyo), false},  // End is excluded
+		{time.Date(2026, 10, 19, 12, 0, 0, 0, tokyo), false}, // Monday noon
+		{time.Date(2026, 10, 18, 23, 0, 0, 0, tokyo), false}, // Sunday
+		{time.Date(2026, 10, 19, 13, 30, 0, 0, time.UTC), true},
+		{time.Date(2026, 10, 19, 3, 0, 0, 0, tokyo), false}, // Monday morning belongs to Sunday
+		{time.Date(2026, 10, 24, 3, 0, 0, 0, tokyo), true},  // Saturday morning belongs to Friday
+	} {
+		got, err := window.Contains(tc.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("Contains(%s) = %v, want %v", tc.at, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title,omitempty"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []opmlOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Category string        `xml:"category,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// ParseOPML returns the feeds of an OPML subscription list, tagged with the
+// folders and categories they are filed under.
+func ParseOPML(r io.Reader) ([]Feed, error) {
+	var doc opmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OPML: %w", err)
+	}
+
+	var feeds []Feed
+	index := make(map[string]int)
+	var walk func(outlines []opmlOutline, folders []string)
+	walk = func(outlines []opmlOutline, folders []string) {
+		for _, o := range outlines {
+			name := strings.TrimSpace(o.Title)
+			if name == "" {
+				name = strings.TrimSpace(o.Text)
+			}
+			feedURL := strings.TrimSpace(o.XMLURL)
+			if feedURL == "" {
+				// A folder; folders without a name only group.
+				if name != "" {
+					walk(o.Outlines, append(slices.Clip(folders), name))
+				} else {
+					walk(o.Outlines, folders)
+				}
+				continue
+			}
+
+			tags := slices.Clone(folders)
+			for _, category := range strings.Split(o.Category, ",") {
+				for _, tag := range strings.Split(category, "/") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						tags = append(tags, tag)
+					}
+				}
+			}
+			if i, ok := index[feedURL]; ok {
+				feeds[i].Tags = mergeTags(feeds[i].Tags, tags)
+				continue
+			}
+			if name == feedURL {
+				name = ""
+			}
+			index[feedURL] = len(feeds)
+			feeds = append(feeds, Feed{Name: name, URL: feedURL, Tags: mergeTags(nil, tags)})
+			walk(o.Outlines, folders)
+		}
+	}
+	walk(doc.Body.Outlines, nil)
+	return feeds, nil
+}
+
+// WriteOPML writes feeds as an OPML 2.0 subscription list. Tagged feeds
+// are filed under a folder per tag, so ParseOPML restores their tags.
+func WriteOPML(w io.Writer, title string, feeds []Feed) error {
+	var doc opmlDocument
+	doc.Version = "2.0"
+	doc.Head.Title = title
+	doc.Head.DateCreated = time.Now().UTC().Format(time.RFC1123Z)
+
+	folders := make(map[string]int)
+	for _, feed := range feeds {
+		outline := opmlOutline{
+			Text:   feed.Label(),
+			Title:  feed.Label(),
+			Type:   "rss",
+			XMLURL: feed.URL,
+		}
+		if len(feed.Tags) == 0 {
+			doc.Body.Outlines = append(doc.Body.Outlines, outline)
+			continue
+		}
+		for _, tag := range feed.Tags {
+			i, ok := folders[tag]
+			if !ok {
+				i = len(doc.Body.Outlines)
+				folders[tag] = i
+				doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{Text: tag, Title: tag})
+			}
+			doc.Body.Outlines[i].Outlines = append(doc.Body.Outlines[i].Outlines, outline)
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// MergeResult counts the feeds MergeFeeds added and updated.
+type MergeResult struct {
+	Added     int
+	Updated   int
+	Unchanged int
+}
+
+// MergeFeeds merges imported feeds into a feeds.yaml document, matching
+// them by URL, and returns the new document.
+func MergeFeeds(doc []byte, imported []Feed) ([]byte, MergeResult, error) {
+	var result MergeResult
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil {
+		return nil, result, fmt.Errorf("failed to parse feeds config: %w", err)
+	}
+	if root.Kind == 0 {
+		root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	mapping := root.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil, result, fmt.Errorf("feeds config must be a mapping")
+	}
+
+	var feedsNode *yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "feeds" {
+			feedsNode = mapping.Content[i+1]
+		}
+	}
+	if feedsNode == nil {
+		feedsNode = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		mapping.Content = append([]*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!str", Value: "feeds"}, feedsNode}, mapping.Content...)
+	} else if feedsNode.Kind != yaml.SequenceNode {
+		if feedsNode.Tag != "!!null" {
+			return nil, result, fmt.Errorf("feeds must be a list")
+		}
+		*feedsNode = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+
+	index := make(map[string]int)
+	existing := make([]Feed, len(feedsNode.Content))
+	for i, node := range feedsNode.Content {
+		if err := node.Decode(&existing[i]); err != nil {
+			return nil, result, fmt.Errorf("feeds[%d]: %w", i, err)
+		}
+		index[existing[i].URL] = i
+		for _, previous := range existing[i].PreviousURLs {
+			if _, ok := index[previous]; !ok {
+				index[previous] = i
+			}
+		}
+	}
+
+	for _, feed := range imported {
+		i, ok := index[feed.URL]
+		if !ok {
+			node, err := feedNode(feed)
+			if err != nil {
+				return nil, result, err
+			}
+			index[feed.URL] = len(feedsNode.Content)
+			feedsNode.Content = append(feedsNode.Content, node)
+			existing = append(existing, feed)
+			result.Added++
+			continue
+		}
+
+		merged := existing[i]
+		if merged.Name == "" {
+			merged.Name = feed.Name
+		}
+		merged.Tags = mergeTags(merged.Tags, feed.Tags)
+		if merged.Name == existing[i].Name && slices.Equal(merged.Tags, existing[i].Tags) {
+			result.Unchanged++
+			continue
+		}
+		node, err := feedNode(merged)
+		if err != nil {
+			return nil, result, err
+		}
+		old := feedsNode.Content[i]
+		node.HeadComment, node.LineComment, node.FootComment = old.HeadComment, old.LineComment, old.FootComment
+		feedsNode.Content[i] = node
+		existing[i] = merged
+		result.Updated++
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return nil, result, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, result, err
+	}
+	return buf.Bytes(), result, nil
+}
+
+// feedNode encodes feed in the shortest form LoadFeeds accepts.
+func feedNode(feed Feed) (*yaml.Node, error) {
+	var node yaml.Node
+	if feed.ID == "" && feed.Name == "" && len(feed.PreviousURLs) == 0 && len(feed.Tags) == 0 {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: feed.URL}, nil
+	}
+	if err := node.Encode(feed); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// mergeTags appends the tags missing from tags, keeping their order.
+func mergeTags(tags, more []string) []string {
+	for _, tag := range more {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
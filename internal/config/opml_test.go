@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testOPML = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="Tech" title="Tech">
+      <outline type="rss" text="Go Blog" title="Go Blog" xmlUrl="https://go.dev/blog/feed.atom" htmlUrl="https://go.dev/blog"/>
+      <outline text="Rust">
+        <outline type="rss" text="This Week in Rust" xmlUrl="https://this-week-in-rust.org/rss.xml"/>
+      </outline>
+    </outline>
+    <outline text="News">
+      <outline type="rss" text="Go Blog" xmlUrl="https://go.dev/blog/feed.atom"/>
+    </outline>
+    <outline type="rss" text="https://example.com/untitled.xml" xmlUrl="https://example.com/untitled.xml" category="/Misc/Later"/>
+  </body>
+</opml>`
+
+func TestParseOPMLMapsFoldersToTags(t *testing.T) {
+	feeds, err := ParseOPML(strings.NewReader(testOPML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Feed{
+		{Name: "Go Blog", URL: "https://go.dev/blog/feed.atom", Tags: []string{"Tech", "News"}},
+		{Name: "This Week in Rust", URL: "https://this-week-in-rust.org/rss.xml", Tags: []string{"Tech", "Rust"}},
+		{URL: "https://example.com/untitled.xml", Tags: []string{"Misc", "Later"}},
+	}
+	if len(feeds) != len(want) {
+		t.Fatalf("got %d feeds, want %d: %+v", len(feeds), len(want), feeds)
+	}
+	for i := range want {
+		if feeds[i].Name != want[i].Name || feeds[i].URL != want[i].URL || !slices.Equal(feeds[i].Tags, want[i].Tags) {
+			t.Errorf("feeds[%d] = %+v, want %+v", i, feeds[i], want[i])
+		}
+	}
+}
+
+func TestWriteOPMLRoundTrips(t *testing.T) {
+	feeds := []Feed{
+		{Name: "Go Blog", URL: "https://go.dev/blog/feed.atom", Tags: []string{"Tech", "News"}},
+		{URL: "https://example.com/rss.xml"},
+	}
+	var buf bytes.Buffer
+	if err := WriteOPML(&buf, "feeds", feeds); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseOPML(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed[0].Name != "Go Blog" || !slices.Equal(parsed[0].Tags, feeds[0].Tags) ||
+		parsed[1].URL != feeds[1].URL || parsed[1].Name != "" {
+		t.Fatalf("round trip = %+v", parsed)
+	}
+}
+
+func TestMergeFeedsKeepsSettingsAndComments(t *testing.T) {
+	doc := []byte(`# Poll every ten minutes.
+interval: 10m
+feeds:
+  # The Go team's blog.
+  - https://go.dev/blog/feed.atom
+  - name: Renamed
+    url: https://this-week-in-rust.org/rss.xml
+    tags: [Rust]
+  - id: moved
+    url: https://example.com/new.xml
+    previous_urls: [https://example.com/untitled.xml]
+`)
+	imported, err := ParseOPML(strings.NewReader(testOPML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imported = append(imported, Feed{Name: "New", URL: "https://example.org/feed.xml"})
+
+	merged, result, err := MergeFeeds(doc, imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (MergeResult{Added: 1, Updated: 3}) {
+		t.Fatalf("result = %+v", result)
+	}
+	for _, want := range []string{"# Poll every ten minutes.", "# The Go team's blog.", "interval: 10m"} {
+		if !bytes.Contains(merged, []byte(want)) {
+			t.Errorf("merged config lost %q:\n%s", want, merged)
+		}
+	}
+
+	var cfg FeedsConfig
+	if err := yaml.Unmarshal(merged, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Feeds) != 4 {
+		t.Fatalf("got %d feeds:\n%s", len(cfg.Feeds), merged)
+	}
+	if f := cfg.Feeds[0]; f.Name != "Go Blog" || !slices.Equal(f.Tags, []string{"Tech", "News"}) {
+		t.Errorf("go blog = %+v", f)
+	}
+	if f := cfg.Feeds[1]; f.Name != "Renamed" || !slices.Equal(f.Tags, []string{"Rust", "Tech"}) {
+		t.Errorf("renamed feed = %+v", f)
+	}
+	if f := cfg.Feeds[2]; f.ID != "moved" || f.URL != "https://example.com/new.xml" || !slices.Equal(f.Tags, []string{"Misc", "Later"}) {
+		t.Errorf("moved feed = %+v", f)
+	}
+	if f := cfg.Feeds[3]; f.Name != "New" || f.URL != "https://example.org/feed.xml" {
+		t.Errorf("added feed = %+v", f)
+	}
+
+	// Merging again changes nothing.
+	again, result, err := MergeFeeds(merged, imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Added != 0 || result.Updated != 0 || !bytes.Equal(again, merged) {
+		t.Fatalf("second merge = %+v:\n%s", result, again)
+	}
+}
+
+func TestLoadFeedsAcceptsOPML(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "subscriptions.opml"), []byte(testOPML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	feedsPath := filepath.Join(dir, "feeds.yaml")
+	if err := os.WriteFile(feedsPath, []byte(`
+opml_files: [subscriptions.opml]
+feeds:
+  - name: Configured
+    url: https://go.dev/blog/feed.atom
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFeeds(feedsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Feeds) != 3 || cfg.Feeds[0].Name != "Configured" || cfg.Feeds[1].Name != "This Week in Rust" {
+		t.Fatalf("feeds = %+v", cfg.Feeds)
+	}
+
+	cfg, err = LoadFeeds(filepath.Join(dir, "subscriptions.opml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Feeds) != 3 || cfg.Interval != 10*time.Minute {
+		t.Fatalf("opml config = %+v", cfg)
+	}
+}
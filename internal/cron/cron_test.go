@@ -0,0 +1,49 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Skip(err)
+	}
+	from := time.Date(2026, 4, 29, 12, 34, 56, 0, time.UTC) // a Wednesday
+
+	tests := []struct {
+		expr string
+		loc  *time.Location
+		want time.Time
+	}{
+		{"*/15 * * * *", nil, time.Date(2026, 4, 29, 12, 45, 0, 0, time.UTC)},
+		{"@hourly", nil, time.Date(2026, 4, 29, 13, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", nil, time.Date(2026, 4, 30, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * *", tokyo, time.Date(2026, 4, 30, 9, 0, 0, 0, tokyo)},
+		{"30 8 * * mon-fri", nil, time.Date(2026, 4, 30, 8, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", nil, time.Date(2026, 5, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan,jul *", nil, time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)},
+		// Day of month and day of week match either way when both are set.
+		{"0 0 13 * fri", nil, time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", nil, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", nil, time.Time{}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr, tt.loc)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := Parse(expr, nil); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"rss-fetcher/internal/alert"
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+)
+
+// conditions tracks failure streaks so that each alert fires and resolves once.
+type conditions struct {
+	mu      sync.Mutex
+	streaks map[string]int
+	firing  map[string]bool
+}
+
+func newConditions() *conditions {
+	return &conditions{streaks: make(map[string]int), firing: make(map[string]bool)}
+}
+
+// fail returns the failure streak of key and whether it should fire now.
+func (c *conditions) fail(key string, threshold int) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streaks[key]++
+	n := c.streaks[key]
+	if threshold <= 0 || n < threshold || c.firing[key] {
+		return n, false
+	}
+	c.firing[key] = true
+	return n, true
+}
+
+// succeed ends the streak of key and reports whether it should resolve.
+func (c *conditions) succeed(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.streaks, key)
+	firing := c.firing[key]
+	delete(c.firing, key)
+	return firing
+}
+
+func (f *Fetcher) fire(ctx context.Context, a alert.Alert) {
+	if f.alerter != nil {
+		f.alerter.Fire(ctx, a)
+	}
+}
+
+func (f *Fetcher) resolve(ctx context.Context, a alert.Alert) {
+	if f.alerter != nil {
+		f.alerter.Resolve(ctx, a)
+	}
+}
+
+// reportFetch tracks consecutive failed fetches of a feed.
+func (f *Fetcher) reportFetch(ctx context.Context, feedConfig config.Feed, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	a := alert.Alert{
+		Kind: "feed_failure",
+		Key:  "feed_failure:" + feedConfig.Key(),
+		URL:  feedConfig.URL,
+	}
+	if err == nil {
+		if f.conditions.succeed(a.Key) {
+			a.Summary = fmt.Sprintf("Feed %s is fetched again", feedConfig.Label())
+			f.resolve(ctx, a)
+		}
+		return
+	}
+	if n, fire := f.conditions.fail(a.Key, f.alerts.FeedFailures); fire {
+		a.Summary = fmt.Sprintf("Feed %s failed %d times in a row", feedConfig.Label(), n)
+		a.Detail = fmt.Sprintf("%s: %v", fetchErrorKind(err), err)
+		f.fire(ctx, a)
+	}
+}
+
+// reportDelivery tracks consecutive failed deliveries to a webhook.
+func (f *Fetcher) reportDelivery(ctx context.Context, wh config.Webhook, err error) {
+	// A delivery interrupted by shutdown says nothing about the webhook.
+	if ctx.Err() != nil {
+		return
+	}
+	a := alert.Alert{
+		Kind: "webhook_failure",
+		Key:  "webhook_failure:" + wh.Label(),
+	}
+	if err == nil {
+		if f.conditions.succeed(a.Key) {
+			a.Summary = fmt.Sprintf("Webhook %s accepts deliveries again", wh.Label())
+			f.resolve(ctx, a)
+		}
+		return
+	}
+	if n, fire := f.conditions.fail(a.Key, f.alerts.WebhookFailures); fire {
+		a.Summary = fmt.Sprintf("Webhook %s rejected %d deliveries in a row", wh.Label(), n)
+		a.Detail = err.Error()
+		f.fire(ctx, a)
+	}
+}
+
+// reportStore tracks consecutive failed state store operations.
+func (f *Fetcher) reportStore(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	a := alert.Alert{Kind: "store_failure", Key: "store_failure"}
+	if err == nil || errors.Is(err, state.ErrNoState) || errors.Is(err, state.ErrConflict) || errors.Is(err, state.ErrLocked) {
+		if f.conditions.succeed(a.Key) {
+			a.Summary = "State store is reachable again"
+			f.resolve(ctx, a)
+		}
+		return
+	}
+	if n, fire := f.conditions.fail(a.Key, f.alerts.StoreFailures); fire {
+		a.Summary = fmt.Sprintf("State store failed %d operations in a row", n)
+		a.Detail = err.Error()
+		f.fire(ctx, a)
+	}
+}
+
+// reportBurst tracks whether the last run of a feed had a burst.
+func (f *Fetcher) reportBurst(ctx context.Context, feedConfig config.Feed, count int, policy string) {
+	a := alert.Alert{
+		Kind: "burst",
+		Key:  "burst:" + feedConfig.Key(),
+		URL:  feedConfig.URL,
+	}
+	if count == 0 {
+		if f.conditions.succeed(a.Key) {
+			a.Summary = fmt.Sprintf("Feed %s notifies normally again", feedConfig.Label())
+			f.resolve(ctx, a)
+		}
+		return
+	}
+	threshold := 0
+	if f.alerts.Burst {
+		threshold = 1
+	}
+	if _, fire := f.conditions.fail(a.Key, threshold); fire {
+		exceeded := fmt.Sprintf("%d new items exceeded max_notifications_per_feed_per_run (%d)", count, f.maxNotificationsPerFeedPerRun)
+		switch policy {
+		case "newest_n":
+			a.Summary = fmt.Sprintf("Feed %s burst cut to the newest items", feedConfig.Label())
+			a.Detail = fmt.Sprintf("%s; only the newest %d were notified.", exceeded, f.maxNotificationsPerFeedPerRun)
+		case "digest":
+			a.Summary = fmt.Sprintf("Feed %s burst sent as a digest", feedConfig.Label())
+			a.Detail = exceeded + "; they were notified in one digest."
+		case "hold":
+			a.Summary = fmt.Sprintf("Feed %s burst held for approval", feedConfig.Label())
+			a.Detail = exceeded + "; approve or reject them through /admin/bursts or the burst command."
+		default:
+			a.Summary = fmt.Sprintf("Feed %s burst suppressed", feedConfig.Label())
+			a.Detail = exceeded + "; the baseline was advanced without notifying them."
+		}
+		f.fire(ctx, a)
+	}
+}
@@ -0,0 +1,125 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestRepeatedFetchFailuresAlertOnceAndResolve(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{{Title: "old", PublishedAt: time.Now().Add(-time.Hour)}}))
+	}))
+	defer feedServer.Close()
+
+	fetcher := NewFetcher(state.NewMemoryStore(), webhook.NewClient(), nil, &config.FeedsConfig{
+		SkipInitialNotify:               true,
+		InitialWarmupStableObservations: 2,
+	})
+	alerts := &recordingAlerter{}
+	fetcher.SetAlerter(alerts, config.AlertsConfig{FeedFailures: 3})
+	feedConfig := config.Feed{URL: feedServer.URL}
+	key := "feed_failure:" + feedServer.URL
+
+	for range 2 {
+		fetcher.ProcessFeed(context.Background(), feedConfig)
+	}
+	if got := alerts.snapshot(); len(got) != 0 {
+		t.Fatalf("alerts below threshold = %v, want none", got)
+	}
+	for range 3 {
+		fetcher.ProcessFeed(context.Background(), feedConfig)
+	}
+	if got, want := alerts.snapshot(), []string{"fire " + key}; !slices.Equal(got, want) {
+		t.Fatalf("alerts after 5 failures = %v, want %v", got, want)
+	}
+
+	failing.Store(false)
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	if got, want := alerts.snapshot(), []string{"fire " + key, "resolve " + key}; !slices.Equal(got, want) {
+		t.Fatalf("alerts after recovery = %v, want %v", got, want)
+	}
+}
+
+func TestRejectedDeliveriesAndBurstsAlert(t *testing.T) {
+	baseline := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	var items atomic.Value
+	items.Store([]rssItem{
+		{Title: "one", PublishedAt: baseline.Add(1 * time.Minute)},
+		{Title: "two", PublishedAt: baseline.Add(2 * time.Minute)},
+	})
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed(items.Load().([]rssItem)))
+	}))
+	defer feedServer.Close()
+
+	var rejecting atomic.Bool
+	rejecting.Store(true)
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rejecting.Load() {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	store := state.NewMemoryStore()
+	if err := store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewFetcher(store, webhook.NewClient(), []config.Webhook{{
+		Name: "test",
+		URL:  webhookServer.URL,
+	}}, &config.FeedsConfig{
+		InitialWarmupStableObservations: 2,
+		MaxNotificationsPerFeedPerRun:   2,
+	})
+	alerts := &recordingAlerter{}
+	fetcher.SetAlerter(alerts, config.AlertsConfig{WebhookFailures: 2, Burst: true})
+	feedConfig := config.Feed{URL: feedServer.URL}
+
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	if got, want := alerts.snapshot(), []string{"fire webhook_failure:test"}; !slices.Equal(got, want) {
+		t.Fatalf("alerts after rejected deliveries = %v, want %v", got, want)
+	}
+
+	more := []rssItem{{Title: "three", PublishedAt: baseline.Add(3 * time.Minute)}}
+	for i := range 3 {
+		more = append(more, rssItem{Title: fmt.Sprint("burst", i), PublishedAt: baseline.Add(time.Duration(4+i) * time.Minute)})
+	}
+	items.Store(more)
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+
+	rejecting.Store(false)
+	items.Store(append(more, rssItem{Title: "after", PublishedAt: baseline.Add(10 * time.Minute)}))
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+
+	want := []string{
+		"fire webhook_failure:test",
+		"fire burst:" + feedServer.URL,
+		"resolve burst:" + feedServer.URL,
+		"resolve webhook_failure:test",
+	}
+	if got := alerts.snapshot(); !slices.Equal(got, want) {
+		t.Fatalf("alerts = %v, want %v", got, want)
+	}
+}
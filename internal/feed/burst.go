@@ -0,0 +1,421 @@
+package feed
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+// burstQueue holds the items of the held bursts of every feed.
+const burstQueue = "bursts"
+
+// ErrNoHeldBurst is returned when a feed has no held burst to approve or
+// reject.
+var ErrNoHeldBurst = errors.New("no held burst for feed")
+
+// HeldBurst is a burst of a feed kept for approval.
+type HeldBurst struct {
+	Feed   string            `json:"feed"` // Feed key
+	HeldAt time.Time         `json:"held_at"`
+	Items  []webhook.Payload `json:"items"` // Oldest first
+}
+
+// heldItem is a held burst item as stored in burstQueue.
+type heldItem struct {
+	Feed      string          `json:"feed"`
+	Payload   webhook.Payload `json:"payload"`
+	Delivered []string        `json:"delivered,omitempty"` // Webhooks that accepted it on an earlier approval
+}
+
+// burstDigestQueue holds the burst digest items wh did not accept.
+func burstDigestQueue(wh config.Webhook) string {
+	return webhookScoped("burst-digest:", wh)
+}
+
+func (f *Fetcher) burstPolicy(feedConfig config.Feed) string {
+	if feedConfig.BurstPolicy != "" {
+		return feedConfig.BurstPolicy
+	}
+	if f.defaultBurstPolicy != "" {
+		return f.defaultBurstPolicy
+	}
+	return "suppress"
+}
+
+// handleBurst applies the burst policy and returns the items left to notify.
+func (f *Fetcher) handleBurst(ctx context.Context, feedConfig config.Feed, logger *slog.Logger, stored *state.FeedState, feedState state.FeedState, feed *gofeed.Feed, newItems []*gofeed.Item, poll *pollResult) []*gofeed.Item {
+	feedURL := feedConfig.Key()
+	feedLabel := f.metricLabel(feedConfig)
+	policy := f.burstPolicy(feedConfig)
+	count := len(newItems)
+	latest := state.NewReadyStateAfter(*newItems[len(newItems)-1].PublishedParsed, feedState.NotifyAfter)
+
+	switch policy {
+	case "newest_n":
+		dropped := len(newItems) - f.maxNotificationsPerFeedPerRun
+		metricFilteredItems.WithLabelValues(feedLabel, "burst").Add(float64(dropped))
+		logger.Warn("Notification burst; notifying only the newest items", "policy", policy, "count", len(newItems), "limit", f.maxNotificationsPerFeedPerRun, "dropped", dropped)
+		newItems = newItems[dropped:]
+
+	case "digest":
+		if err := f.sendBurstDigest(ctx, feedURL, logger, feed, newItems); err != nil {
+			logger.Error("Failed to send notification burst digest; retrying next run", "error", err, "count", len(newItems))
+			return nil
+		}
+		writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+		defer cancel()
+		if err := f.saveState(writeCtx, feedURL, stored, latest, poll); err != nil {
+			logger.Error("Failed to advance state after notification burst digest", "error", err, "count", len(newItems))
+			return nil
+		}
+		metricNewItems.WithLabelValues(feedLabel).Add(float64(len(newItems)))
+		metricLastNewItem.WithLabelValues(feedLabel).SetToCurrentTime()
+		logger.Warn("Notified burst in one digest and advanced baseline", "policy", policy, "count", len(newItems), "limit", f.maxNotificationsPerFeedPerRun, "latest", latest.LastPublishedAt)
+		newItems = nil
+
+	case "hold":
+		if err := f.holdBurst(ctx, feedURL, feed, newItems); err != nil {
+			logger.Error("Failed to hold notification burst; retrying next run", "error", err, "count", len(newItems))
+			return nil
+		}
+		writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+		defer cancel()
+		if err := f.saveState(writeCtx, feedURL, stored, latest, poll); err != nil {
+			logger.Error("Failed to advance state after holding notification burst", "error", err, "count", len(newItems))
+			return nil
+		}
+		logger.Warn("Held notification burst for approval and advanced baseline", "policy", policy, "count", len(newItems), "limit", f.maxNotificationsPerFeedPerRun, "latest", latest.LastPublishedAt)
+		newItems = nil
+
+	default:
+		if err := f.saveState(ctx, feedURL, stored, latest, poll); err != nil {
+			logger.Error("Failed to advance state after suppressing notification burst", "error", err, "count", len(newItems))
+			return nil
+		}
+		metricBurstSuppressed.WithLabelValues(feedLabel).Inc()
+		metricFilteredItems.WithLabelValues(feedLabel, "burst").Add(float64(len(newItems)))
+		logger.Warn("Suppressed notification burst and advanced baseline", "policy", policy, "count", len(newItems), "limit", f.maxNotificationsPerFeedPerRun, "latest", latest.LastPublishedAt)
+		newItems = nil
+	}
+	metricBursts.WithLabelValues(feedLabel, policy).Inc()
+	f.reportBurst(ctx, feedConfig, count, policy)
+	return newItems
+}
+
+// sendBurstDigest posts items to each webhook in one digest or queues them.
+func (f *Fetcher) sendBurstDigest(ctx context.Context, feedKey string, logger *slog.Logger, feed *gofeed.Feed, items []*gofeed.Item) error {
+	payloads := make([]webhook.Payload, len(items))
+	for i, item := range items {
+		payloads[i] = newPayload(feed, item)
+	}
+	now := time.Now()
+	held := make(heldLookup)
+	var errs []error
+	for _, wh := range f.webhooks {
+		if wh.Digest != nil || !f.windowOpen(wh, now) {
+			for i, item := range items {
+				if err := f.deliver(ctx, logger, wh, queuedItemID(feedKey, item), payloads[i], now, held); err != nil {
+					logger.Error("Failed to post webhook", "name", wh.Name, "item", item.Title, "error", err)
+					errs = append(errs, fmt.Errorf("failed to queue %q for webhook %s: %w", item.Title, wh.Label(), err))
+				}
+			}
+			continue
+		}
+		var fresh []webhook.Payload
+		var ids []string
+		claimed := make(map[string][]string)
+		for i, item := range items {
+			id := queuedItemID(feedKey, item)
+			keys, duplicate := f.claimItem(ctx, logger, wh, id, payloads[i])
+			if !duplicate {
+				fresh = append(fresh, payloads[i])
+				ids = append(ids, id)
+				claimed[id] = keys
+			}
+		}
+		if len(fresh) == 0 {
+			continue
+		}
+		sent, err := f.whClient.SendDigest(ctx, wh, fresh)
+		f.reportDelivery(ctx, wh, err)
+		if err == nil {
+			continue
+		}
+		logger.Error("Failed to post burst digest; retrying the rest later", "name", wh.Name, "error", err, "sent", sent)
+		if err := f.queueBurstDigest(ctx, wh, ids[sent:], fresh[sent:], now); err != nil {
+			for _, id := range ids[sent:] {
+				f.releaseItem(ctx, logger, wh, id, claimed[id])
+			}
+			errs = append(errs, fmt.Errorf("failed to queue burst digest for webhook %s: %w", wh.Label(), err))
+		}
+	}
+	// An interrupted run may not have reached every webhook.
+	return errors.Join(append(errs, ctx.Err())...)
+}
+
+// queueBurstDigest queues the burst digest items wh did not accept.
+func (f *Fetcher) queueBurstDigest(ctx context.Context, wh config.Webhook, ids []string, payloads []webhook.Payload, now time.Time) error {
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+	defer cancel()
+	for i, id := range ids {
+		if err := f.enqueue(writeCtx, burstDigestQueue(wh), id, payloads[i], now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flushBurstDigest retries the burst digest items wh did not accept.
+func (f *Fetcher) flushBurstDigest(ctx context.Context, wh config.Webhook, logger *slog.Logger) {
+	queue := burstDigestQueue(wh)
+	queued, err := f.queue.ListQueue(ctx, queue)
+	f.reportStore(ctx, err)
+	if err != nil {
+		logger.Error("Failed to read burst digest queue", "error", err)
+		return
+	}
+	if len(queued) == 0 {
+		return
+	}
+	if sent, remaining := f.sendQueuedDigest(ctx, wh, queue, queued, logger); sent > 0 {
+		logger.Info("Sent burst digest", "items", sent, "remaining", remaining)
+	}
+}
+
+// holdBurst keeps items in the store for approval.
+func (f *Fetcher) holdBurst(ctx context.Context, feedKey string, feed *gofeed.Feed, items []*gofeed.Item) error {
+	if f.queue == nil {
+		return errors.New("state store cannot hold items")
+	}
+	now := time.Now()
+	queued := make([]state.QueuedItem, len(items))
+	for i, item := range items {
+		data, err := json.Marshal(heldItem{Feed: feedKey, Payload: newPayload(feed, item)})
+		if err != nil {
+			return err
+		}
+		queued[i] = state.QueuedItem{ID: queuedItemID(feedKey, item), QueuedAt: now, Data: data}
+	}
+	err := f.queue.Enqueue(ctx, burstQueue, queued...)
+	f.reportStore(ctx, err)
+	return err
+}
+
+// HeldBursts returns the bursts held for approval, by feed key.
+func (f *Fetcher) HeldBursts(ctx context.Context) ([]HeldBurst, error) {
+	if f.queue == nil {
+		return nil, nil
+	}
+	queued, err := f.queue.ListQueue(ctx, burstQueue)
+	if err != nil {
+		return nil, err
+	}
+	var bursts []HeldBurst
+	index := make(map[string]int)
+	for _, item := range queued {
+		var held heldItem
+		if err := json.Unmarshal(item.Data, &held); err != nil {
+			slog.Warn("Skipping undecodable held item", "id", item.ID, "error", err)
+			continue
+		}
+		i, ok := index[held.Feed]
+		if !ok {
+			i = len(bursts)
+			index[held.Feed] = i
+			bursts = append(bursts, HeldBurst{Feed: held.Feed, HeldAt: item.QueuedAt})
+		}
+		bursts[i].Items = append(bursts[i].Items, held.Payload)
+	}
+	for _, burst := range bursts {
+		slices.SortStableFunc(burst.Items, func(a, b webhook.Payload) int { return a.PublishedAt.Compare(b.PublishedAt) })
+	}
+	slices.SortFunc(bursts, func(a, b HeldBurst) int { return strings.Compare(a.Feed, b.Feed) })
+	return bursts, nil
+}
+
+// ApproveBurst notifies the held burst of the feed with key feedKey as
+// new items and returns how many items were delivered. Delivery stops at
+// the first item a webhook did not accept, which stays held with the
+// items after it; the webhooks that did accept it are recorded and skipped
+// on the next approval.
+func (f *Fetcher) ApproveBurst(ctx context.Context, feedKey string) (int, error) {
+	return f.resolveBurst(ctx, feedKey, func(queued []state.QueuedItem, held []heldItem) (int, error) {
+		logger := slog.With("feed", feedKey)
+		lookup := make(heldLookup)
+		for i, item := range held {
+			var failed error
+			delivered := item.Delivered
+			for _, wh := range f.webhooks {
+				if slices.Contains(delivered, webhookScoped("", wh)) {
+					continue
+				}
+				if err := f.deliver(ctx, logger, wh, queued[i].ID, item.Payload, time.Now(), lookup); err != nil {
+					logger.Error("Failed to post webhook", "name", wh.Name, "item", item.Payload.ItemTitle, "error", err)
+					failed = fmt.Errorf("failed to deliver %q to webhook %s: %w", item.Payload.ItemTitle, wh.Label(), err)
+					continue
+				}
+				delivered = append(delivered, webhookScoped("", wh))
+			}
+			if failed != nil && len(delivered) > len(item.Delivered) {
+				item.Delivered = delivered
+				f.recordApproval(ctx, logger, queued[i], item)
+			}
+			n := i
+			if failed == nil {
+				n, failed = i+1, ctx.Err()
+			}
+			if failed != nil {
+				logger.Warn("Approved held burst in part; the rest stays held", "items", n, "held", len(held)-n)
+				return n, failed
+			}
+		}
+		logger.Info("Approved held burst", "items", len(held))
+		return len(held), nil
+	})
+}
+
+// recordApproval stores which webhooks accepted a held item.
+func (f *Fetcher) recordApproval(ctx context.Context, logger *slog.Logger, queued state.QueuedItem, item heldItem) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		logger.Error("Failed to record approved webhooks; they may be posted again", "item", item.Payload.ItemTitle, "error", err)
+		return
+	}
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+	defer cancel()
+	queued.Data = data
+	if err := f.queue.Enqueue(writeCtx, burstQueue, queued); err != nil {
+		logger.Error("Failed to record approved webhooks; they may be posted again", "item", item.Payload.ItemTitle, "error", err)
+	}
+}
+
+// RejectBurst drops the held burst of the feed with key feedKey and
+// returns how many items it had.
+func (f *Fetcher) RejectBurst(ctx context.Context, feedKey string) (int, error) {
+	return f.resolveBurst(ctx, feedKey, func(queued []state.QueuedItem, _ []heldItem) (int, error) {
+		slog.Info("Rejected held burst", "feed", feedKey, "items", len(queued))
+		return len(queued), nil
+	})
+}
+
+// resolveBurst removes as many of a feed's held items as resolve returns.
+func (f *Fetcher) resolveBurst(ctx context.Context, feedKey string, resolve func(queued []state.QueuedItem, held []heldItem) (int, error)) (int, error) {
+	if f.queue == nil {
+		return 0, ErrNoHeldBurst
+	}
+	// Do not race an approval through another replica or the CLI.
+	if f.locker != nil {
+		unlock, err := f.locker.TryLock(ctx, burstQueue, feedLockTTL)
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+			defer cancel()
+			if err := unlock(unlockCtx); err != nil {
+				slog.Warn("Failed to release burst lock", "error", err)
+			}
+		}()
+	}
+	queued, err := f.queue.ListQueue(ctx, burstQueue)
+	if err != nil {
+		return 0, err
+	}
+	var items []state.QueuedItem
+	var helds []heldItem
+	for _, item := range queued {
+		var held heldItem
+		if err := json.Unmarshal(item.Data, &held); err != nil || held.Feed != feedKey {
+			continue
+		}
+		// Keep the items ordered by publication as they are added.
+		i, _ := slices.BinarySearchFunc(helds, held, func(a, b heldItem) int {
+			return cmp.Or(a.Payload.PublishedAt.Compare(b.Payload.PublishedAt), 1)
+		})
+		items = slices.Insert(items, i, item)
+		helds = slices.Insert(helds, i, held)
+	}
+	if len(items) == 0 {
+		return 0, ErrNoHeldBurst
+	}
+
+	n, resolveErr := resolve(items, helds)
+	if n == 0 {
+		return 0, resolveErr
+	}
+	ids := make([]string, n)
+	for i, item := range items[:n] {
+		ids[i] = item.ID
+	}
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+	defer cancel()
+	if err := f.queue.RemoveFromQueue(writeCtx, burstQueue, ids...); err != nil {
+		return n, fmt.Errorf("failed to remove resolved items; they stay held: %w", err)
+	}
+	return n, resolveErr
+}
+
+// BurstHandler serves the admin API for held bursts:
+//
+//	GET  /admin/bursts                   lists held bursts as JSON
+//	POST /admin/bursts/approve?feed=KEY  notifies a feed's held burst
+//	POST /admin/bursts/reject?feed=KEY   drops a feed's held burst
+func (f *Fetcher) BurstHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/bursts", func(w http.ResponseWriter, r *http.Request) {
+		bursts, err := f.HeldBursts(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if bursts == nil {
+			bursts = []HeldBurst{}
+		}
+		writeJSON(w, bursts)
+	})
+	resolve := func(action func(context.Context, string) (int, error)) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			feedKey := r.URL.Query().Get("feed")
+			if feedKey == "" {
+				http.Error(w, "feed is required", http.StatusBadRequest)
+				return
+			}
+			n, err := action(r.Context(), feedKey)
+			switch {
+			case errors.Is(err, ErrNoHeldBurst):
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			case errors.Is(err, state.ErrLocked):
+				http.Error(w, "another approval is in progress", http.StatusConflict)
+				return
+			case err != nil:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, map[string]any{"feed": feedKey, "items": n})
+		}
+	}
+	mux.HandleFunc("POST /admin/bursts/approve", resolve(f.ApproveBurst))
+	mux.HandleFunc("POST /admin/bursts/reject", resolve(f.RejectBurst))
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write admin response", "error", err)
+	}
+}
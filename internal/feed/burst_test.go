@@ -0,0 +1,251 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+// burstFixture serves a feed with three items after a stored baseline and
+// records what a generic webhook receives.
+type burstFixture struct {
+	store    *state.MemoryStore
+	feed     config.Feed
+	webhooks []config.Webhook
+
+	mu       sync.Mutex
+	received []string // Item titles, or "digest:" and the digest's titles
+}
+
+func newBurstFixture(t *testing.T) *burstFixture {
+	t.Helper()
+	baseline := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{
+			{Title: "one", PublishedAt: baseline.Add(1 * time.Minute)},
+			{Title: "two", PublishedAt: baseline.Add(2 * time.Minute)},
+			{Title: "three", PublishedAt: baseline.Add(3 * time.Minute)},
+		}))
+	}))
+	t.Cleanup(feedServer.Close)
+
+	fx := &burstFixture{store: state.NewMemoryStore(), feed: config.Feed{URL: feedServer.URL}}
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Type      string            `json:"type"`
+			ItemTitle string            `json:"item_title"`
+			Items     []webhook.Payload `json:"items"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode webhook body: %v", err)
+		}
+		got := body.ItemTitle
+		if body.Type == "digest" {
+			var titles []string
+			for _, item := range body.Items {
+				titles = append(titles, item.ItemTitle)
+			}
+			got = "digest:" + strings.Join(titles, ",")
+		}
+		fx.mu.Lock()
+		fx.received = append(fx.received, got)
+		fx.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(webhookServer.Close)
+	fx.webhooks = []config.Webhook{{Name: "test", URL: webhookServer.URL}}
+
+	if err := fx.store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+	return fx
+}
+
+func (fx *burstFixture) fetcher(policy string) *Fetcher {
+	return NewFetcher(fx.store, webhook.NewClient(), fx.webhooks, &config.FeedsConfig{
+		InitialWarmupStableObservations: 2,
+		MaxNotificationsPerFeedPerRun:   2,
+		BurstPolicy:                     policy,
+	})
+}
+
+func (fx *burstFixture) takeReceived() []string {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	received := fx.received
+	fx.received = nil
+	return received
+}
+
+func TestBurstPolicies(t *testing.T) {
+	for policy, want := range map[string][]string{
+		"suppress": nil,
+		"newest_n": {"two", "three"},
+		"digest":   {"digest:one,two,three"},
+		"hold":     nil,
+	} {
+		t.Run(policy, func(t *testing.T) {
+			fx := newBurstFixture(t)
+			fetcher := fx.fetcher(policy)
+			fetcher.ProcessFeed(context.Background(), fx.feed)
+			if got := fx.takeReceived(); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("received = %v, want %v", got, want)
+			}
+
+			// Every policy advances the baseline past the burst.
+			fetcher.ProcessFeed(context.Background(), fx.feed)
+			if got := fx.takeReceived(); len(got) != 0 {
+				t.Fatalf("received on the next run = %v, want nothing", got)
+			}
+		})
+	}
+}
+
+func TestFeedBurstPolicyOverridesDefault(t *testing.T) {
+	fx := newBurstFixture(t)
+	fx.feed.BurstPolicy = "newest_n"
+	fx.fetcher("suppress").ProcessFeed(context.Background(), fx.feed)
+	if got := fx.takeReceived(); len(got) != 2 {
+		t.Fatalf("received = %v, want the two newest items", got)
+	}
+}
+
+func TestHeldBurstIsApprovedOrRejected(t *testing.T) {
+	fx := newBurstFixture(t)
+	fetcher := fx.fetcher("hold")
+	fetcher.ProcessFeed(context.Background(), fx.feed)
+
+	bursts, err := fetcher.HeldBursts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bursts) != 1 || bursts[0].Feed != fx.feed.Key() || len(bursts[0].Items) != 3 {
+		t.Fatalf("held bursts = %+v, want the three items of the feed", bursts)
+	}
+
+	// The held items are in the store, so another process approves them.
+	handler := fx.fetcher("hold").BurstHandler()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/bursts/approve?feed="+fx.feed.Key(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("approve status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := fx.takeReceived(); fmt.Sprint(got) != "[one two three]" {
+		t.Fatalf("received after approval = %v, want [one two three]", got)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/admin/bursts/reject?feed="+fx.feed.Key(), nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("reject after approval status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	// A rejected burst is dropped without notifications.
+	reheld := newBurstFixture(t)
+	fetcher = reheld.fetcher("hold")
+	fetcher.ProcessFeed(context.Background(), reheld.feed)
+	if n, err := fetcher.RejectBurst(context.Background(), reheld.feed.Key()); n != 3 || err != nil {
+		t.Fatalf("RejectBurst = %d, %v; want 3, nil", n, err)
+	}
+	if _, err := fetcher.ApproveBurst(context.Background(), reheld.feed.Key()); !errors.Is(err, ErrNoHeldBurst) {
+		t.Fatalf("ApproveBurst after rejection error = %v, want ErrNoHeldBurst", err)
+	}
+	if got := reheld.takeReceived(); len(got) != 0 {
+		t.Fatalf("received after rejection = %v, want nothing", got)
+	}
+}
+
+func TestApprovalStopsAtFirstFailedItem(t *testing.T) {
+	fx := newBurstFixture(t)
+	fx.fetcher("hold").ProcessFeed(context.Background(), fx.feed)
+
+	// A second webhook rejects the second item until it recovers.
+	var recovered atomic.Bool
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhook.Payload
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload.ItemTitle == "two" && !recovered.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer failing.Close()
+	fx.webhooks = append(fx.webhooks, config.Webhook{Name: "failing", URL: failing.URL})
+	fetcher := fx.fetcher("hold")
+
+	if n, err := fetcher.ApproveBurst(context.Background(), fx.feed.Key()); n != 1 || err == nil {
+		t.Fatalf("ApproveBurst = %d, %v; want 1 and an error", n, err)
+	}
+	bursts, err := fetcher.HeldBursts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bursts) != 1 || len(bursts[0].Items) != 2 || bursts[0].Items[0].ItemTitle != "two" {
+		t.Fatalf("held bursts after failed approval = %+v, want two and three", bursts)
+	}
+	if got := fx.takeReceived(); fmt.Sprint(got) != "[one two]" {
+		t.Fatalf("first webhook received %v, want [one two]", got)
+	}
+
+	// The webhook that accepted two is not posted it again.
+	recovered.Store(true)
+	if n, err := fetcher.ApproveBurst(context.Background(), fx.feed.Key()); n != 2 || err != nil {
+		t.Fatalf("second ApproveBurst = %d, %v; want 2", n, err)
+	}
+	if got := fx.takeReceived(); fmt.Sprint(got) != "[three]" {
+		t.Fatalf("first webhook received %v on the second approval, want [three]", got)
+	}
+}
+
+func TestFailedBurstDigestIsRetried(t *testing.T) {
+	fx := newBurstFixture(t)
+	var calls atomic.Int64
+	var received atomic.Value
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Items []webhook.Payload `json:"items"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		received.Store(len(body.Items))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer flaky.Close()
+	fx.webhooks = append(fx.webhooks, config.Webhook{Name: "flaky", URL: flaky.URL})
+	fetcher := fx.fetcher("digest")
+
+	fetcher.ProcessFeed(context.Background(), fx.feed)
+	if got := fx.takeReceived(); fmt.Sprint(got) != "[digest:one,two,three]" {
+		t.Fatalf("received = %v, want the digest", got)
+	}
+	if received.Load() != nil {
+		t.Fatalf("flaky webhook accepted a digest on its first call")
+	}
+
+	fetcher.flushQueues(context.Background(), time.Now())
+	if got := received.Load(); got != 3 {
+		t.Fatalf("retried digest items = %v, want 3", got)
+	}
+	// The baseline still moved past the burst.
+	fetcher.ProcessFeed(context.Background(), fx.feed)
+	if got := fx.takeReceived(); len(got) != 0 {
+		t.Fatalf("received on the next run = %v, want nothing", got)
+	}
+}
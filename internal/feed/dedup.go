@@ -0,0 +1,115 @@
+package feed
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/webhook"
+)
+
+// trackingParams are query parameters that only identify where a link was
+// shared, besides those starting with utm_.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+}
+
+// canonicalURL normalizes an item link so that links to the same article
+// from different feeds compare equal: the scheme, the www. prefix, default
+// ports, tracking parameters, the fragment and a trailing slash are
+// dropped, and the remaining query is sorted. It returns "" for links that
+// are not absolute URLs.
+func canonicalURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host = net.JoinHostPort(host, port)
+	}
+	host = strings.TrimPrefix(host, "www.")
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") || trackingParams[strings.ToLower(key)] {
+			query.Del(key)
+		}
+	}
+	canonical := host + strings.TrimRight(u.EscapedPath(), "/")
+	if len(query) > 0 {
+		canonical += "?" + query.Encode()
+	}
+	return canonical
+}
+
+// dedupSet names the store set of the items wh received recently.
+func dedupSet(wh config.Webhook) string {
+	return webhookScoped("dedup:", wh)
+}
+
+// claimItem claims payload's item, by canonical URL and GUID, in wh's
+// dedup set on behalf of id, and reports whether wh received it within
+// its dedup window on behalf of another item. It returns the keys claimed
+// for releaseItem, which must be called if the item is not delivered
+// after all. Updates are not deduplicated. Items are delivered if the
+// store cannot tell.
+func (f *Fetcher) claimItem(ctx context.Context, logger *slog.Logger, wh config.Webhook, id string, payload webhook.Payload) (claimed []string, duplicate bool) {
+	if wh.DedupWindow <= 0 || payload.Event != "" || f.seen == nil {
+		return nil, false
+	}
+	var keys []string
+	if canonical := canonicalURL(payload.ItemURL); canonical != "" {
+		keys = append(keys, "url:"+canonical)
+	}
+	if payload.ItemGUID != "" {
+		keys = append(keys, "guid:"+payload.ItemGUID)
+	}
+	set := dedupSet(wh)
+	for _, key := range keys {
+		owner, err := f.seen.Claim(ctx, set, key, id, wh.DedupWindow)
+		f.reportStore(ctx, err)
+		if err != nil {
+			logger.Error("Failed to check for duplicate items; delivering", "webhook", wh.Label(), "error", err)
+			return claimed, false
+		}
+		if owner != id {
+			f.releaseItem(ctx, logger, wh, id, claimed)
+			metricDuplicateItems.WithLabelValues(wh.Label()).Inc()
+			logger.Info("Item already posted to webhook; skipping", "webhook", wh.Label(), "item", payload.ItemTitle, "url", payload.ItemURL, "first", owner)
+			return nil, true
+		}
+		claimed = append(claimed, key)
+	}
+	return claimed, false
+}
+
+// releaseItem forgets the keys claimed for id by claimItem, so that the
+// same item from another feed is not skipped.
+func (f *Fetcher) releaseItem(ctx context.Context, logger *slog.Logger, wh config.Webhook, id string, claimed []string) {
+	if len(claimed) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+	defer cancel()
+	set := dedupSet(wh)
+	for _, key := range claimed {
+		err := f.seen.Release(ctx, set, key, id)
+		f.reportStore(ctx, err)
+		if err != nil {
+			logger.Warn("Failed to release duplicate check of undelivered item", "webhook", wh.Label(), "key", key, "error", err)
+		}
+	}
+}
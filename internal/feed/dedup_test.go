@@ -0,0 +1,119 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	for _, tc := range []struct {
+		raw  string
+		want string
+	}{
+		{raw: "https://example.com/post", want: "example.com/post"},
+		{raw: "http://WWW.Example.com:80/post/", want: "example.com/post"},
+		{raw: "https://example.com:8443/post", want: "example.com:8443/post"},
+		{raw: "https://example.com/post?utm_source=rss&utm_medium=feed#comments", want: "example.com/post"},
+		{raw: "https://example.com/post?id=2&fbclid=abc&a=1", want: "example.com/post?a=1&id=2"},
+		{raw: "https://example.com/Post", want: "example.com/Post"},
+		{raw: "https://example.com/", want: "example.com"},
+		{raw: "/relative/post", want: ""},
+		{raw: "", want: ""},
+	} {
+		if got := canonicalURL(tc.raw); got != tc.want {
+			t.Errorf("canonicalURL(%q) = %q, want %q", tc.raw, got, tc.want)
+		}
+	}
+}
+
+// dedupFixture serves two feeds, /a and /b, with the same article under
+// differently written links, and counts the posts each webhook path
+// accepted. Posts to a path in fail are rejected once.
+type dedupFixture struct {
+	store *state.MemoryStore
+	feeds []config.Feed
+	url   string
+
+	mu       sync.Mutex
+	fail     map[string]bool
+	received map[string]int
+}
+
+func newDedupFixture(t *testing.T) *dedupFixture {
+	t.Helper()
+	published := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	links := map[string]string{
+		"/a": "https://example.com/article",
+		"/b": "http://www.example.com/article/?utm_source=rss#top",
+	}
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w,
+			`<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>%s</title><item><title>Article</title><link>%s</link><guid>%s</guid><pubDate>%s</pubDate></item></channel></rss>`,
+			r.URL.Path, links[r.URL.Path], r.URL.Path, published.Format(time.RFC1123Z),
+		)
+	}))
+	t.Cleanup(feedServer.Close)
+
+	fx := &dedupFixture{store: state.NewMemoryStore(), fail: map[string]bool{}, received: map[string]int{}}
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fx.mu.Lock()
+		defer fx.mu.Unlock()
+		if fx.fail[r.URL.Path] {
+			fx.fail[r.URL.Path] = false
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fx.received[r.URL.Path]++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(webhookServer.Close)
+	fx.url = webhookServer.URL
+
+	fx.feeds = []config.Feed{{URL: feedServer.URL + "/a"}, {URL: feedServer.URL + "/b"}}
+	for _, feedConfig := range fx.feeds {
+		if err := fx.store.SetFeedState(context.Background(), feedConfig.Key(), state.NewReadyState(published.Add(-time.Minute))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fx
+}
+
+func (fx *dedupFixture) run() {
+	fetcher := NewFetcher(fx.store, webhook.NewClient(), []config.Webhook{
+		{Name: "dedup", URL: fx.url + "/dedup", DedupWindow: time.Hour},
+		{Name: "all", URL: fx.url + "/all"},
+	}, &config.FeedsConfig{InitialWarmupStableObservations: 2, MaxNotificationsPerFeedPerRun: 10})
+	for _, feedConfig := range fx.feeds {
+		fetcher.ProcessFeed(context.Background(), feedConfig)
+	}
+}
+
+func TestDedupWindowSkipsItemsPostedFromAnotherFeed(t *testing.T) {
+	fx := newDedupFixture(t)
+	fx.run()
+
+	if fx.received["/dedup"] != 1 || fx.received["/all"] != 2 {
+		t.Fatalf("posts = %v, want 1 to the webhook with a dedup window and 2 to the other", fx.received)
+	}
+}
+
+func TestDedupWindowDoesNotSkipItemsWhoseFirstDeliveryFailed(t *testing.T) {
+	fx := newDedupFixture(t)
+	fx.fail["/dedup"] = true
+	fx.run()
+
+	// The article from /a was rejected, so the one from /b is posted.
+	if fx.received["/dedup"] != 1 {
+		t.Fatalf("posts = %v, want 1 to the webhook with a dedup window", fx.received)
+	}
+}
@@ -0,0 +1,249 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+// queueTick is how often digests and held items are checked for being due.
+const queueTick = time.Minute
+
+// heldFlushBudget bounds one flush of held items to well within the lock TTL.
+const heldFlushBudget = feedLockTTL / 2
+
+// heldQueue holds the items found outside wh's delivery window.
+func heldQueue(wh config.Webhook) string {
+	return webhookScoped("held:", wh)
+}
+
+// usesQueue reports whether items for wh may be queued.
+func usesQueue(wh config.Webhook) bool {
+	return wh.Digest != nil || wh.DeliveryWindow != nil
+}
+
+// heldLookup caches whether each held queue has items for one run.
+type heldLookup map[string]bool
+
+// deliver posts or queues payload for wh unless wh already received it.
+func (f *Fetcher) deliver(ctx context.Context, logger *slog.Logger, wh config.Webhook, id string, payload webhook.Payload, now time.Time, held heldLookup) error {
+	claimed, duplicate := f.claimItem(ctx, logger, wh, id, payload)
+	if duplicate {
+		return nil
+	}
+	err := f.dispatch(ctx, logger, wh, id, payload, now, held)
+	if err != nil {
+		f.releaseItem(ctx, logger, wh, id, claimed)
+	}
+	return err
+}
+
+func (f *Fetcher) dispatch(ctx context.Context, logger *slog.Logger, wh config.Webhook, id string, payload webhook.Payload, now time.Time, held heldLookup) error {
+	if wh.Digest != nil {
+		if err := f.enqueue(ctx, digestQueue(wh), id, payload, now); err != nil {
+			return fmt.Errorf("failed to queue item for digest: %w", err)
+		}
+		metricDigestQueued.WithLabelValues(wh.Label()).Inc()
+		return nil
+	}
+	// Items held before the window opened go first, so a new item joins
+	// them while any are left and is posted by the flush.
+	open := f.windowOpen(wh, now)
+	if !open || f.holdsItems(ctx, wh, held) {
+		if err := f.enqueue(ctx, heldQueue(wh), id, payload, now); err != nil {
+			return fmt.Errorf("failed to hold item until the delivery window: %w", err)
+		}
+		metricHeldQueued.WithLabelValues(wh.Label()).Inc()
+		held[heldQueue(wh)] = true
+		if open {
+			logger := logger.With("webhook", wh.Label())
+			f.withQueueLock(ctx, heldQueue(wh), logger, func() { f.flushHeld(ctx, wh, logger) })
+			delete(held, heldQueue(wh))
+		}
+		return nil
+	}
+	err := f.whClient.SendWithRateLimit(ctx, wh, payload)
+	f.reportDelivery(ctx, wh, err)
+	return err
+}
+
+// holdsItems reports whether wh's held queue has, or may have, items.
+func (f *Fetcher) holdsItems(ctx context.Context, wh config.Webhook, held heldLookup) bool {
+	if wh.DeliveryWindow == nil || f.queue == nil {
+		return false
+	}
+	queue := heldQueue(wh)
+	if holds, ok := held[queue]; ok {
+		return holds
+	}
+	items, err := f.queue.ListQueue(ctx, queue)
+	f.reportStore(ctx, err)
+	held[queue] = err != nil || len(items) > 0
+	return held[queue]
+}
+
+// windowOpen reports whether wh may be posted to at now.
+func (f *Fetcher) windowOpen(wh config.Webhook, now time.Time) bool {
+	if wh.DeliveryWindow == nil {
+		return true
+	}
+	open, err := wh.DeliveryWindow.Contains(now)
+	if err != nil {
+		slog.Error("Failed to evaluate delivery window; delivering", "webhook", wh.Label(), "error", err)
+		return true
+	}
+	return open
+}
+
+func (f *Fetcher) enqueue(ctx context.Context, queue, id string, payload webhook.Payload, now time.Time) error {
+	if f.queue == nil {
+		return errors.New("state store cannot queue items")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	err = f.queue.Enqueue(ctx, queue, state.QueuedItem{ID: id, QueuedAt: now, Data: data})
+	f.reportStore(ctx, err)
+	return err
+}
+
+// runQueues flushes due digests and held items until ctx is done.
+func (f *Fetcher) runQueues(ctx context.Context) {
+	ticker := time.NewTicker(queueTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.flushQueues(ctx, time.Now())
+		}
+	}
+}
+
+// flushQueues sends what is due of every webhook whose window is open.
+func (f *Fetcher) flushQueues(ctx context.Context, now time.Time) {
+	if f.queue == nil {
+		return
+	}
+	for _, wh := range f.webhooks {
+		if !f.windowOpen(wh, now) {
+			continue
+		}
+		logger := slog.With("webhook", wh.Label())
+		f.withQueueLock(ctx, burstDigestQueue(wh), logger, func() { f.flushBurstDigest(ctx, wh, logger) })
+		if !usesQueue(wh) {
+			continue
+		}
+		if wh.Digest != nil {
+			f.withQueueLock(ctx, digestQueue(wh), logger, func() { f.flushDigest(ctx, wh, logger, now) })
+		} else {
+			f.withQueueLock(ctx, heldQueue(wh), logger, func() { f.flushHeld(ctx, wh, logger) })
+		}
+	}
+}
+
+// withQueueLock runs flush unless another replica is flushing queue.
+func (f *Fetcher) withQueueLock(ctx context.Context, queue string, logger *slog.Logger, flush func()) {
+	if f.locker == nil {
+		flush()
+		return
+	}
+	unlock, err := f.locker.TryLock(ctx, queue, feedLockTTL)
+	f.reportStore(ctx, err)
+	if errors.Is(err, state.ErrLocked) {
+		return
+	} else if err != nil {
+		logger.Error("Failed to acquire queue lock; skipping", "error", err)
+		return
+	}
+	flush()
+	unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+	defer cancel()
+	if err := unlock(unlockCtx); err != nil {
+		logger.Warn("Failed to release queue lock", "error", err)
+	}
+}
+
+// flushHeld posts the items held outside wh's delivery window.
+func (f *Fetcher) flushHeld(ctx context.Context, wh config.Webhook, logger *slog.Logger) {
+	queue := heldQueue(wh)
+	items, err := f.queue.ListQueue(ctx, queue)
+	f.reportStore(ctx, err)
+	if err != nil {
+		logger.Error("Failed to read held items", "error", err)
+		return
+	}
+	if len(items) == 0 {
+		metricHeldPending.WithLabelValues(wh.Label()).Set(0)
+		return
+	}
+
+	var sent, remaining int
+	if wh.DeliveryWindow.Deliver == "digest" {
+		sent, remaining = f.sendQueuedDigest(ctx, wh, queue, items, logger)
+	} else {
+		sent, remaining = f.sendQueuedItems(ctx, wh, queue, items, logger)
+	}
+	if sent > 0 {
+		metricHeldSent.WithLabelValues(wh.Label()).Add(float64(sent))
+		logger.Info("Delivered held items", "items", sent, "remaining", remaining)
+	}
+	metricHeldPending.WithLabelValues(wh.Label()).Set(float64(remaining))
+}
+
+// sendQueuedItems posts items one by one and returns how many were sent and
+// how many are left.
+func (f *Fetcher) sendQueuedItems(ctx context.Context, wh config.Webhook, queue string, items []state.QueuedItem, logger *slog.Logger) (int, int) {
+	var removed []string
+	sent := 0
+	deadline := time.Now().Add(heldFlushBudget)
+	for _, item := range items {
+		if time.Now().After(deadline) {
+			logger.Info("Held items left for the next flush", "items", len(items)-len(removed))
+			break
+		}
+		var payload webhook.Payload
+		if err := json.Unmarshal(item.Data, &payload); err != nil {
+			logger.Error("Dropping undecodable queued item", "id", item.ID, "error", err)
+			removed = append(removed, item.ID)
+			continue
+		}
+		err := f.whClient.SendWithRateLimit(ctx, wh, payload)
+		f.reportDelivery(ctx, wh, err)
+		if err != nil {
+			logger.Error("Failed to post held item; remaining items retried next time", "item", payload.ItemTitle, "error", err)
+			break
+		}
+		removed = append(removed, item.ID)
+		sent++
+	}
+	if !f.removeQueued(ctx, queue, removed, logger) {
+		return 0, len(items)
+	}
+	return sent, len(items) - len(removed)
+}
+
+// removeQueued removes sent items from queue, even if ctx is cancelled.
+func (f *Fetcher) removeQueued(ctx context.Context, queue string, ids []string, logger *slog.Logger) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+	defer cancel()
+	err := f.queue.RemoveFromQueue(writeCtx, queue, ids...)
+	f.reportStore(writeCtx, err)
+	if err != nil {
+		logger.Error("Failed to remove sent items from queue; they may be sent again", "queue", queue, "error", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestDeliveryWindowHoldsItemsUntilItOpens(t *testing.T) {
+	baseline := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{
+			{Title: "one", PublishedAt: baseline.Add(1 * time.Minute)},
+			{Title: "two", PublishedAt: baseline.Add(2 * time.Minute)},
+		}))
+	}))
+	defer feedServer.Close()
+
+	var mu sync.Mutex
+	var received []string
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body webhook.Payload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		mu.Lock()
+		received = append(received, body.ItemTitle)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	// The window opens two hours from now and lasts an hour.
+	opens := time.Now().UTC().Add(2 * time.Hour)
+	window := &config.DeliveryWindowConfig{
+		Hours: []string{opens.Format("15:04") + "-" + opens.Add(time.Hour).Format("15:04")},
+	}
+	store := state.NewMemoryStore()
+	if err := store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+	webhooks := []config.Webhook{{Name: "windowed", URL: webhookServer.URL, DeliveryWindow: window}}
+	feedsConfig := &config.FeedsConfig{InitialWarmupStableObservations: 2, MaxNotificationsPerFeedPerRun: 10}
+	fetcher := NewFetcher(store, webhook.NewClient(), webhooks, feedsConfig)
+	fetcher.ProcessFeed(context.Background(), config.Feed{URL: feedServer.URL})
+
+	fetcher.flushQueues(context.Background(), time.Now())
+	if len(received) != 0 {
+		t.Fatalf("deliveries outside the window = %v, want none", received)
+	}
+
+	// The held items are in the store, so a restarted fetcher delivers them.
+	restarted := NewFetcher(store, webhook.NewClient(), webhooks, feedsConfig)
+	restarted.flushQueues(context.Background(), opens.Add(time.Minute))
+	if len(received) != 2 || received[0] != "one" || received[1] != "two" {
+		t.Fatalf("deliveries in the window = %v, want [one two]", received)
+	}
+	held, err := store.ListQueue(context.Background(), heldQueue(webhooks[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(held) != 0 {
+		t.Fatalf("held items after delivery = %d, want 0", len(held))
+	}
+}
+
+func TestItemsInOpenWindowFollowHeldItems(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body webhook.Payload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		mu.Lock()
+		received = append(received, body.ItemTitle)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	opens := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+	wh := config.Webhook{Name: "windowed", URL: webhookServer.URL, DeliveryWindow: &config.DeliveryWindowConfig{Hours: []string{"09:00-18:00"}}}
+	store := state.NewMemoryStore()
+	fetcher := NewFetcher(store, webhook.NewClient(), []config.Webhook{wh}, &config.FeedsConfig{})
+	ctx := context.Background()
+	held := make(heldLookup)
+
+	if err := fetcher.deliver(ctx, slog.Default(), wh, "feed 1", webhook.Payload{ItemTitle: "held"}, opens.Add(-time.Hour), held); err != nil {
+		t.Fatal(err)
+	}
+	// The window opened before the next flush.
+	if err := fetcher.deliver(ctx, slog.Default(), wh, "feed 2", webhook.Payload{ItemTitle: "new"}, opens.Add(time.Minute), held); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(received) != "[held new]" {
+		t.Fatalf("deliveries = %v, want [held new]", received)
+	}
+	if held, err := store.ListQueue(ctx, heldQueue(wh)); err != nil || len(held) != 0 {
+		t.Fatalf("held items after delivery = %v, %v; want none", held, err)
+	}
+}
+
+// listCountingStore counts reads of queues.
+type listCountingStore struct {
+	*state.MemoryStore
+	lists atomic.Int64
+}
+
+func (s *listCountingStore) ListQueue(ctx context.Context, queue string) ([]state.QueuedItem, error) {
+	s.lists.Add(1)
+	return s.MemoryStore.ListQueue(ctx, queue)
+}
+
+func TestHeldQueueIsReadOncePerRun(t *testing.T) {
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	wh := config.Webhook{Name: "windowed", URL: webhookServer.URL, DeliveryWindow: &config.DeliveryWindowConfig{Hours: []string{"09:00-18:00"}}}
+	store := &listCountingStore{MemoryStore: state.NewMemoryStore()}
+	fetcher := NewFetcher(store, webhook.NewClient(), []config.Webhook{wh}, &config.FeedsConfig{})
+	ctx := context.Background()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	held := make(heldLookup)
+	for i := range 3 {
+		if err := fetcher.deliver(ctx, slog.Default(), wh, fmt.Sprintf("feed %d", i), webhook.Payload{ItemTitle: "new"}, now, held); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := store.lists.Load(); n != 1 {
+		t.Fatalf("held queue reads = %d, want 1", n)
+	}
+}
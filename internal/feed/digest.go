@@ -0,0 +1,106 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+// webhookScoped names store data of wh with prefix. Webhooks without a
+// name are told apart by their URL, which is not stored as is.
+func webhookScoped(prefix string, wh config.Webhook) string {
+	if wh.Name != "" {
+		return prefix + wh.Name
+	}
+	return fmt.Sprintf("%s%016x", prefix, xxhash.Sum64String(wh.URL))
+}
+
+// digestQueue names the store queue holding wh's digest items.
+func digestQueue(wh config.Webhook) string {
+	return webhookScoped("digest:", wh)
+}
+
+// queuedItemID identifies item of a feed within a queue, so that queueing
+// it again on a retried run replaces the earlier entry.
+func queuedItemID(feedKey string, item *gofeed.Item) string {
+	return feedKey + " " + itemID(item)
+}
+
+// flushDigest sends wh's digest if its oldest queued item is due at now.
+func (f *Fetcher) flushDigest(ctx context.Context, wh config.Webhook, logger *slog.Logger, now time.Time) {
+	queue := digestQueue(wh)
+	queued, err := f.queue.ListQueue(ctx, queue)
+	f.reportStore(ctx, err)
+	if err != nil {
+		logger.Error("Failed to read digest queue", "error", err)
+		return
+	}
+	metricDigestPending.WithLabelValues(wh.Label()).Set(float64(len(queued)))
+	if len(queued) == 0 {
+		return
+	}
+	due, err := wh.Digest.NextFlush(queued[0].QueuedAt)
+	if err != nil {
+		logger.Error("Failed to schedule digest", "error", err)
+		return
+	}
+	if now.Before(due) {
+		return
+	}
+
+	sent, remaining := f.sendQueuedDigest(ctx, wh, queue, queued, logger)
+	if sent > 0 {
+		metricDigestItemsSent.WithLabelValues(wh.Label()).Add(float64(sent))
+		logger.Info("Sent digest", "items", sent)
+	}
+	metricDigestPending.WithLabelValues(wh.Label()).Set(float64(remaining))
+}
+
+// sendQueuedDigest posts the queued items to wh as a digest and removes
+// the delivered ones from queue. It returns how many were sent and how
+// many are left in the queue.
+func (f *Fetcher) sendQueuedDigest(ctx context.Context, wh config.Webhook, queue string, queued []state.QueuedItem, logger *slog.Logger) (int, int) {
+	// Undecodable items are removed along with the sent ones.
+	var payloads []webhook.Payload
+	var ids, removed []string
+	for _, item := range queued {
+		var payload webhook.Payload
+		if err := json.Unmarshal(item.Data, &payload); err != nil {
+			logger.Error("Dropping undecodable queued item", "id", item.ID, "error", err)
+			removed = append(removed, item.ID)
+			continue
+		}
+		payloads = append(payloads, payload)
+		ids = append(ids, item.ID)
+	}
+
+	ctx, span := tracer.Start(ctx, "rss.flush_digest", trace.WithAttributes(attribute.Int("rss.digest.items", len(payloads))))
+	defer span.End()
+	sent := 0
+	if len(payloads) > 0 {
+		var err error
+		sent, err = f.whClient.SendDigest(ctx, wh, payloads)
+		f.reportDelivery(ctx, wh, err)
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			logger.Error("Failed to post digest; remaining items retried next time", "error", err, "sent", sent, "remaining", len(payloads)-sent)
+		}
+	}
+	removed = append(removed, ids[:sent]...)
+	if !f.removeQueued(ctx, queue, removed, logger) {
+		return 0, len(queued)
+	}
+	return sent, len(queued) - len(removed)
+}
@@ -0,0 +1,85 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestDigestWebhookQueuesItemsUntilDue(t *testing.T) {
+	baseline := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{
+			{Title: "one", PublishedAt: baseline.Add(1 * time.Minute)},
+			{Title: "two", PublishedAt: baseline.Add(2 * time.Minute)},
+			{Title: "three", PublishedAt: baseline.Add(3 * time.Minute)},
+		}))
+	}))
+	defer feedServer.Close()
+
+	var immediate atomic.Int64
+	immediateServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		immediate.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer immediateServer.Close()
+
+	var mu sync.Mutex
+	var digests []webhook.DigestPayload
+	digestServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body webhook.DigestPayload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode digest: %v", err)
+		}
+		mu.Lock()
+		digests = append(digests, body)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer digestServer.Close()
+
+	store := state.NewMemoryStore()
+	if err := store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+	webhooks := []config.Webhook{
+		{Name: "immediate", URL: immediateServer.URL},
+		{Name: "digest", URL: digestServer.URL, Digest: &config.DigestConfig{Interval: time.Hour}},
+	}
+	feedsConfig := &config.FeedsConfig{InitialWarmupStableObservations: 2, MaxNotificationsPerFeedPerRun: 10}
+	fetcher := NewFetcher(store, webhook.NewClient(), webhooks, feedsConfig)
+	fetcher.ProcessFeed(context.Background(), config.Feed{URL: feedServer.URL})
+
+	if got := immediate.Load(); got != 3 {
+		t.Fatalf("immediate webhook calls = %d, want 3", got)
+	}
+	fetcher.flushQueues(context.Background(), time.Now())
+	if len(digests) != 0 {
+		t.Fatalf("digests before the interval = %d, want 0", len(digests))
+	}
+
+	// The queue is in the store, so a restarted fetcher flushes it.
+	restarted := NewFetcher(store, webhook.NewClient(), webhooks, feedsConfig)
+	restarted.flushQueues(context.Background(), time.Now().Add(time.Hour))
+	if len(digests) != 1 || len(digests[0].Items) != 3 || digests[0].Items[0].ItemTitle != "one" {
+		t.Fatalf("digests = %+v, want one digest of the three items oldest first", digests)
+	}
+	queued, err := store.ListQueue(context.Background(), digestQueue(webhooks[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queued) != 0 {
+		t.Fatalf("queue after flush = %d items, want 0", len(queued))
+	}
+}
@@ -0,0 +1,103 @@
+package feed
+
+import (
+	"bytes"
+	"mime"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Candidate is a feed advertised by an HTML page with
+// <link rel="alternate" type="...">.
+type Candidate struct {
+	URL   string
+	Type  string
+	Title string
+}
+
+// feedLinkTypes are the link types recognised as feeds.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// discoverCandidates lists the feeds advertised by page, best first.
+func discoverCandidates(page []byte, base *url.URL) []Candidate {
+	var candidates []Candidate
+	seen := make(map[string]bool)
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			// Comment feeds (e.g. WordPress "Comments Feed") are rarely
+			// what a site or channel URL was meant to follow.
+			slices.SortStableFunc(candidates, func(a, b Candidate) int {
+				return isCommentFeed(a) - isCommentFeed(b)
+			})
+			return candidates
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.DataAtom {
+			case atom.Base:
+				if href, err := url.Parse(attr(token, "href")); err == nil && base != nil {
+					base = base.ResolveReference(href)
+				}
+			case atom.Link:
+				if !hasToken(attr(token, "rel"), "alternate") {
+					continue
+				}
+				mediaType, _, err := mime.ParseMediaType(attr(token, "type"))
+				if err != nil || !feedLinkTypes[mediaType] {
+					continue
+				}
+				href, err := url.Parse(strings.TrimSpace(attr(token, "href")))
+				if err != nil || href.String() == "" {
+					continue
+				}
+				if base != nil {
+					href = base.ResolveReference(href)
+				}
+				if seen[href.String()] {
+					continue
+				}
+				seen[href.String()] = true
+				candidates = append(candidates, Candidate{
+					URL:   href.String(),
+					Type:  mediaType,
+					Title: strings.TrimSpace(attr(token, "title")),
+				})
+			}
+		}
+	}
+}
+
+func isCommentFeed(c Candidate) int {
+	if strings.Contains(strings.ToLower(c.Title), "comment") || strings.Contains(strings.ToLower(c.URL), "/comments/") {
+		return 1
+	}
+	return 0
+}
+
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestDiscoverCandidatesPrefersContentFeeds(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/")
+	page := []byte(`<!doctype html><html><head>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="Comments Feed" href="/comments/feed/">
+<link rel="alternate" type="application/atom+xml" title="Posts" href="atom.xml">
+<link rel="alternate" type="application/feed+json; charset=utf-8" href="https://example.com/feed.json">
+<link rel="alternate" type="text/html" hreflang="en" href="/en/">
+</head><body></body></html>`)
+
+	got := discoverCandidates(page, base)
+	want := []string{"https://example.com/blog/atom.xml", "https://example.com/feed.json", "https://example.com/comments/feed/"}
+	if len(got) != len(want) {
+		t.Fatalf("candidates = %+v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].URL != want[i] {
+			t.Fatalf("candidates[%d] = %q, want %q", i, got[i].URL, want[i])
+		}
+	}
+	if got[1].Type != "application/feed+json" {
+		t.Fatalf("JSON feed type = %q", got[1].Type)
+	}
+}
+
+func TestFetcherFollowsPageToFeedAndRediscoversOn404(t *testing.T) {
+	published := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	var feedPath atomic.Value
+	feedPath.Store("/feed-v1.xml")
+	var pageRequests atomic.Int64
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			pageRequests.Add(1)
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<html><head><link rel="alternate" type="application/rss+xml" href="%s"></head></html>`, feedPath.Load())
+			return
+		}
+		if r.URL.Path != feedPath.Load().(string) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{{Title: "post", PublishedAt: published}}))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	store := state.NewMemoryStore()
+	fetcher := NewFetcher(store, webhook.NewClient(), nil, &config.FeedsConfig{
+		SkipInitialNotify:               true,
+		InitialWarmupStableObservations: 2,
+	})
+	feedConfig := config.Feed{URL: server.URL + "/"}
+
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	st, err := store.GetFeedState(context.Background(), feedConfig.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ResolvedURL != server.URL+"/feed-v1.xml" {
+		t.Fatalf("ResolvedURL = %q, want discovered feed", st.ResolvedURL)
+	}
+
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	if got := pageRequests.Load(); got != 1 {
+		t.Fatalf("page requests with cached feed URL = %d, want 1", got)
+	}
+
+	feedPath.Store("/feed-v2.xml")
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	st, err = store.GetFeedState(context.Background(), feedConfig.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.ResolvedURL != server.URL+"/feed-v2.xml" {
+		t.Fatalf("ResolvedURL after 404 = %q, want rediscovered feed", st.ResolvedURL)
+	}
+}
@@ -1,80 +1,433 @@
 package feed
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"net/url"
+	"slices"
 	"sort"
 	"sync"
 	"time"
 
 	"github.com/mmcdole/gofeed"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
+	"rss-fetcher/internal/alert"
 	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/logging"
+	"rss-fetcher/internal/netpolicy"
 	"rss-fetcher/internal/state"
 	"rss-fetcher/internal/webhook"
 )
 
-var (
-	metricFetchCount = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "rss_fetch_count_total",
-		Help: "The total number of feed fetches",
-	}, []string{"feed", "status"})
+var tracer = otel.Tracer("rss-fetcher/internal/feed")
 
-	metricNewItems = promauto.NewCounterVec(prometheus.CounterOpts{
-		Name: "rss_new_items_total",
-		Help: "The total number of new items found",
-	}, []string{"feed"})
+const (
+	// feedTimeout bounds one ProcessFeed call, including webhook rate
+	// limit waits.
+	feedTimeout = 5 * time.Minute
+	// stateWriteTimeout bounds the final baseline write of a run and the
+	// lock release, which are detached from the run's own context.
+	stateWriteTimeout = 5 * time.Second
+	// feedLockTTL outlives a ProcessFeed call so that a lock only expires
+	// early if its holder crashed.
+	feedLockTTL = feedTimeout + 2*stateWriteTimeout
+	// pushRetryInterval is how often pushed content for a locked feed
+	// tries the lock again.
+	pushRetryInterval = time.Second
+	// scheduleTick is how often the adaptive scheduler looks for due feeds
+	// when min_interval is longer.
+	scheduleTick = time.Minute
 )
 
+// Sharder decides which feeds this replica is responsible for.
+type Sharder interface {
+	ID() string
+	Owns(feedKey string) bool
+}
+
+// Alerter notifies operators when a condition starts and when it clears.
+type Alerter interface {
+	Fire(ctx context.Context, a alert.Alert)
+	Resolve(ctx context.Context, a alert.Alert)
+}
+
+// PushSubscriber is told which WebSub hub, if any, each polled feed
+// advertises. An empty hub means the feed no longer advertises one.
+type PushSubscriber interface {
+	Observe(feedConfig config.Feed, hub, topic string)
+}
+
 type Fetcher struct {
 	store                           state.Store
+	locker                          state.Locker
+	queue                           state.Queue
+	seen                            state.SeenSet
+	sharder                         Sharder
+	push                            PushSubscriber
+	alerter                         Alerter
+	alerts                          config.AlertsConfig
+	conditions                      *conditions
 	whClient                        *webhook.Client
 	webhooks                        []config.Webhook
+	getter                          *httpGetter
 	parser                          *gofeed.Parser
+	scheduler                       *adaptiveScheduler
 	skipInitialNotify               bool
 	initialWarmupStableObservations int
 	maxNotificationsPerFeedPerRun   int
+	defaultBurstPolicy              string
+	notifyOnUpdate                  bool
+	maxUpdatesPerItem               int
+	orphanGracePeriod               time.Duration
+	staleAfter                      time.Duration
+	workers                         chan struct{}
+	hosts                           *hostLimiter
+	jitter                          time.Duration
+	perFeedLabels                   bool
+	statuses                        *feedStatuses
+
+	pushMu sync.Mutex
+	// pushes has an entry for every feed whose pushed content is being
+	// processed, holding the newest content pushed since, if any.
+	pushes map[string][]byte
 }
 
 func NewFetcher(store state.Store, whClient *webhook.Client, webhooks []config.Webhook, feedsConfig *config.FeedsConfig) *Fetcher {
+	// Stores shared between replicas implement Locker so that each feed is
+	// fetched by one replica at a time. The instrumented store below hides
+	// it, so look it up first.
+	locker, _ := store.(state.Locker)
+	queue, _ := store.(state.Queue)
+	if queue != nil {
+		queue = state.InstrumentQueue(queue)
+	}
+	seen, _ := store.(state.SeenSet)
+	if seen != nil {
+		seen = state.InstrumentSeenSet(seen)
+	}
+	// The original RSS document carries the ttl and skip hints.
+	parser := gofeed.NewParser()
+	parser.KeepOriginalFeed = true
+	var scheduler *adaptiveScheduler
+	if feedsConfig.Scheduler.Mode == "adaptive" {
+		scheduler = newAdaptiveScheduler(feedsConfig.Interval, feedsConfig.Scheduler.MinInterval, feedsConfig.Scheduler.MaxInterval, feedsConfig.Concurrency.Jitter)
+	}
+	// Polls and pushed content share the worker limit.
+	var workers chan struct{}
+	if feedsConfig.Concurrency.MaxWorkers > 0 {
+		workers = make(chan struct{}, feedsConfig.Concurrency.MaxWorkers)
+	}
 	return &Fetcher{
-		store:                           store,
+		locker:                          locker,
+		queue:                           queue,
+		seen:                            seen,
+		store:                           state.Instrument(store),
 		whClient:                        whClient,
 		webhooks:                        webhooks,
-		parser:                          gofeed.NewParser(),
+		getter:                          newHTTPGetter(feedsConfig.Fetch),
+		parser:                          parser,
+		scheduler:                       scheduler,
 		skipInitialNotify:               feedsConfig.SkipInitialNotify,
 		initialWarmupStableObservations: feedsConfig.InitialWarmupStableObservations,
 		maxNotificationsPerFeedPerRun:   feedsConfig.MaxNotificationsPerFeedPerRun,
+		defaultBurstPolicy:              feedsConfig.BurstPolicy,
+		notifyOnUpdate:                  feedsConfig.NotifyOnUpdate,
+		maxUpdatesPerItem:               feedsConfig.MaxUpdateNotificationsPerItem,
+		orphanGracePeriod:               feedsConfig.OrphanGracePeriod,
+		staleAfter:                      feedsConfig.StaleAfter,
+		workers:                         workers,
+		hosts:                           newHostLimiter(feedsConfig.Concurrency.PerHost, feedsConfig.Concurrency.PerHostDelay),
+		jitter:                          feedsConfig.Concurrency.Jitter,
+		perFeedLabels:                   feedsConfig.Metrics.PerFeedLabels,
+		statuses:                        newFeedStatuses(),
+		pushes:                          make(map[string][]byte),
+		conditions:                      newConditions(),
 	}
 }
 
+// SetSharder restricts runs to the feeds owned by this replica. Without a
+// sharder every configured feed is processed.
+func (f *Fetcher) SetSharder(s Sharder) {
+	f.sharder = s
+}
+
+// SetPushSubscriber reports the WebSub hub of every polled feed to s.
+func (f *Fetcher) SetPushSubscriber(s PushSubscriber) {
+	f.push = s
+}
+
+// SetAlerter makes the fetcher report operational conditions, such as
+// stale feeds or repeated failures, to a once they cross the thresholds of
+// cfg. Without an alerter they are only logged.
+func (f *Fetcher) SetAlerter(a Alerter, cfg config.AlertsConfig) {
+	f.alerter = a
+	f.alerts = cfg
+}
+
+// SetNetworkPolicy makes feed requests dial through p. It must be called
+// before Run.
+func (f *Fetcher) SetNetworkPolicy(p *netpolicy.Policy) {
+	p.Apply(f.getter.transport)
+}
+
+// fetchFunc obtains the current feed document for one run.
+type fetchFunc func(ctx context.Context, resolvedURL string) (fetched, error)
+
 func (f *Fetcher) ProcessFeed(ctx context.Context, feedConfig config.Feed) {
 	feedURL := feedConfig.URL
-	feedLabel := feedConfig.Label()
-	logger := slog.With("feed", feedLabel, "feed_url", feedURL)
-	logger.Info("Checking feed")
+	feedLabel := f.metricLabel(feedConfig)
+	logger := feedLogger(feedConfig)
+	ctx, span := tracer.Start(ctx, "rss.process_feed", trace.WithAttributes(feedAttributes(feedConfig)...))
+	defer span.End()
 
-	feed, err := f.parser.ParseURLWithContext(feedURL, ctx)
-	if err != nil {
-		logger.Error("Failed to parse feed", "error", err)
-		metricFetchCount.WithLabelValues(feedLabel, "error").Inc()
+	err := f.withFeedLock(ctx, feedConfig.Key(), logger, func() {
+		logger.Info("Checking feed")
+		poll := f.processFeed(ctx, feedConfig, logger, func(ctx context.Context, resolvedURL string) (fetched, error) {
+			ctx, span := tracer.Start(ctx, "rss.fetch", trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attribute.String("url.full", feedURL)))
+			defer span.End()
+			start := time.Now()
+			result, err := f.fetchResolved(ctx, logger, feedURL, resolvedURL)
+			metricFetchDuration.WithLabelValues(feedLabel).Observe(time.Since(start).Seconds())
+			f.reportFetch(ctx, feedConfig, err)
+			if err != nil {
+				span.SetAttributes(attribute.String("rss.fetch.error_kind", fetchErrorKind(err)))
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return result, err
+			}
+			metricResponseSize.WithLabelValues(feedLabel).Observe(float64(result.size))
+			span.SetAttributes(attribute.Int("rss.fetch.size", result.size))
+			if result.resolvedURL != "" {
+				span.SetAttributes(attribute.String("rss.feed.resolved_url", result.resolvedURL))
+			}
+			return result, nil
+		})
+		if f.scheduler != nil {
+			next := f.scheduler.schedule(feedConfig.Key(), poll, time.Now())
+			logger.Debug("Scheduled next poll", "at", next)
+		}
+		if f.push != nil && poll != nil {
+			f.push.Observe(feedConfig, poll.hints.hub, poll.hints.self)
+		}
+	})
+	// A feed skipped because another replica holds its lock is not due
+	// again until the normal interval has passed.
+	if err != nil && f.scheduler != nil {
+		next := f.scheduler.schedule(feedConfig.Key(), nil, time.Now())
+		logger.Debug("Scheduled next poll", "at", next)
+	}
+}
+
+// ProcessPushedFeed runs new-item detection on feed content delivered by
+// a WebSub hub instead of fetching the feed. Polling continues as usual,
+// so content missed by the hub is still picked up later.
+//
+// Content pushed while the feed is being processed is applied once the
+// feed's lock is released, for as long as a lock can be held. Of the
+// content pushed while earlier content is still pending, only the newest
+// is kept.
+func (f *Fetcher) ProcessPushedFeed(ctx context.Context, feedConfig config.Feed, body []byte) {
+	logger := feedLogger(feedConfig)
+	key := feedConfig.Key()
+	f.pushMu.Lock()
+	_, pending := f.pushes[key]
+	f.pushes[key] = body
+	f.pushMu.Unlock()
+	if pending {
+		logger.Debug("Pushed content is pending; keeping the newest")
 		return
 	}
-	metricFetchCount.WithLabelValues(feedLabel, "success").Inc()
 
-	feedState, stateErr := f.store.GetFeedState(feedURL)
+	for {
+		f.pushMu.Lock()
+		body := f.pushes[key]
+		if body == nil || ctx.Err() != nil {
+			delete(f.pushes, key)
+			f.pushMu.Unlock()
+			return
+		}
+		f.pushes[key] = nil
+		f.pushMu.Unlock()
+		f.processPushedFeed(ctx, feedConfig, logger, body)
+	}
+}
+
+func (f *Fetcher) processPushedFeed(ctx context.Context, feedConfig config.Feed, logger *slog.Logger, body []byte) {
+	ctx, span := tracer.Start(ctx, "rss.process_pushed_feed", trace.WithAttributes(feedAttributes(feedConfig)...))
+	defer span.End()
+
+	process := func() {
+		ctx, cancel := context.WithTimeout(ctx, feedTimeout)
+		defer cancel()
+		logger.Info("Processing pushed feed content")
+		f.processFeed(ctx, feedConfig, logger, func(_ context.Context, resolvedURL string) (fetched, error) {
+			feed, err := f.parser.Parse(bytes.NewReader(body))
+			if err != nil {
+				return fetched{}, fmt.Errorf("%w: %w", errParse, err)
+			}
+			return fetched{feed: feed, resolvedURL: resolvedURL}, nil
+		})
+	}
+	wait := time.NewTimer(feedLockTTL)
+	defer wait.Stop()
+	// The worker is released between attempts so that waiting for a
+	// poll does not hold up others.
+	attempt := func() error {
+		if f.workers != nil {
+			select {
+			case f.workers <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-f.workers }()
+		}
+		return f.withFeedLock(ctx, feedConfig.Key(), logger, process)
+	}
+	for errors.Is(attempt(), state.ErrLocked) {
+		logger.Debug("Feed is being processed; retrying pushed content when it is done")
+		select {
+		case <-ctx.Done():
+			return
+		case <-wait.C:
+			logger.Warn("Dropping pushed content; feed stayed locked", "waited", feedLockTTL)
+			return
+		case <-time.After(pushRetryInterval):
+		}
+	}
+}
+
+// feedLogger returns the logger for one feed's runs, with debug logs
+// enabled if the feed asks for them.
+func feedLogger(feedConfig config.Feed) *slog.Logger {
+	logger := slog.With("feed", feedConfig.Label(), "feed_url", feedConfig.URL)
+	if feedConfig.Debug {
+		logger = logging.Verbose(logger)
+	}
+	return logger
+}
+
+// withFeedLock runs fn while holding the feed's lock, or skips it if
+// another run is processing the feed, returning state.ErrLocked, or the
+// lock cannot be acquired.
+func (f *Fetcher) withFeedLock(ctx context.Context, feedKey string, logger *slog.Logger, fn func()) error {
+	if f.locker == nil {
+		fn()
+		return nil
+	}
+
+	lockCtx, span := tracer.Start(ctx, "state.lock")
+	unlock, err := f.locker.TryLock(lockCtx, "feed:"+feedKey, feedLockTTL)
+	span.End()
+	f.reportStore(ctx, err)
+	if errors.Is(err, state.ErrLocked) {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("rss.feed.locked_elsewhere", true))
+		logger.Debug("Feed is being processed by another replica; skipping")
+		return err
+	} else if err != nil {
+		logger.Error("Failed to acquire feed lock; skipping", "error", err)
+		return err
+	}
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+		defer cancel()
+		if err := unlock(unlockCtx); err != nil {
+			logger.Warn("Failed to release feed lock", "error", err)
+		}
+	}()
+	fn()
+	return nil
+}
+
+// processFeed obtains the feed with fetch and delivers its new items. It
+// returns nil if the feed could not be obtained.
+func (f *Fetcher) processFeed(ctx context.Context, feedConfig config.Feed, logger *slog.Logger, fetch fetchFunc) *pollResult {
+	// feedURL is the state key, which is the URL unless the feed has an ID.
+	feedURL := feedConfig.Key()
+	feedLabel := f.metricLabel(feedConfig)
+
+	feedState, stateErr := f.store.GetFeedState(ctx, feedURL)
+	if errors.Is(stateErr, state.ErrNoState) && len(feedConfig.PreviousKeys()) > 0 {
+		feedState, stateErr = f.carryOverState(ctx, feedConfig, logger)
+	}
+	f.reportStore(ctx, stateErr)
 	if stateErr != nil && !errors.Is(stateErr, state.ErrNoState) {
 		logger.Error("Failed to read feed state; skipping notification because baseline is not comparable", "error", stateErr)
-		return
+		return nil
+	}
+	// stored is what every write of this run expects to replace, so a
+	// concurrent writer's progress is never rolled back.
+	var stored *state.FeedState
+	if stateErr == nil {
+		read := feedState
+		stored = &read
+		f.statuses.set(feedURL, feedState.Status)
 	}
 
+	span := trace.SpanFromContext(ctx)
+	if stored != nil {
+		span.SetAttributes(attribute.String("rss.feed.status", stored.Status))
+	}
+	result, err := fetch(ctx, feedState.ResolvedURL)
+	if err != nil {
+		span.SetStatus(codes.Error, "fetch failed")
+		kind := fetchErrorKind(err)
+		logger.Error("Failed to fetch feed", "error", err, "kind", kind)
+		metricFetchCount.WithLabelValues(feedLabel, kind).Inc()
+		return nil
+	}
+	metricFetchCount.WithLabelValues(feedLabel, "success").Inc()
+	metricLastSuccess.WithLabelValues(feedLabel).SetToCurrentTime()
+	feed := result.feed
+	if result.resolvedURL != feedState.ResolvedURL && result.resolvedURL != "" {
+		logger.Info("Using feed discovered from configured page", "resolved_url", result.resolvedURL)
+	}
+	if result.header != nil {
+		// Pushed content carries no redirect information either way. Without
+		// per-feed labels the gauge could not tell feeds apart, so only the
+		// log is left.
+		if result.movedTo != "" {
+			logger.Warn("Feed URL permanently redirects; config should be updated", "moved_to", result.movedTo)
+		}
+		if f.perFeedLabels {
+			metricFeedMoved.WithLabelValues(feedLabel).Set(boolToFloat(result.movedTo != ""))
+		}
+	} else {
+		result.movedTo = feedState.MovedTo
+	}
+
+	// Every write of this run records the merged history, resolved URL,
+	// redirect and staleness, which ride along with the baseline rather
+	// than costing a write of their own.
 	items := itemsWithPublishedTime(feed.Items)
+	if undated := len(feed.Items) - len(items); undated > 0 {
+		metricFilteredItems.WithLabelValues(feedLabel, "undated").Add(float64(undated))
+	}
+	// Relative hub and self links refer to the URL the feed came from.
+	base, _ := url.Parse(cmp.Or(result.resolvedURL, feedConfig.URL))
+	poll := &pollResult{
+		hints:       parseHints(feed, result.header, base, time.Now()),
+		history:     mergeHistory(feedState.ItemHistory, items),
+		resolvedURL: result.resolvedURL,
+		movedTo:     result.movedTo,
+	}
+	poll.staleSince = f.checkStale(ctx, feedConfig, logger, stored, items, time.Now())
+	var updates []itemUpdate
+	poll.fingerprints, updates = trackItems(feedState.Fingerprints, items, result.header == nil)
+
 	if len(items) == 0 {
 		logger.Debug("No comparable items")
-		return
+		f.saveObservations(ctx, feedURL, logger, stored, poll)
+		return poll
 	}
 
 	sort.Slice(items, func(i, j int) bool {
@@ -87,68 +440,92 @@ func (f *Fetcher) ProcessFeed(ctx context.Context, feedConfig config.Feed) {
 			feedState = state.NewReadyState(time.Time{})
 		} else {
 			feedState = state.NewWarmingState(latest, time.Now())
-			if err := f.store.SetFeedState(feedURL, feedState); err != nil {
+			if err := f.saveState(ctx, feedURL, stored, feedState, poll); err != nil {
 				logger.Error("Failed to record initial warming state", "error", err)
 			} else {
 				logger.Info("Starting feed warmup; notification skipped", "latest", latest, "stable_observations", feedState.WarmupStableObservations)
 			}
-			return
+			return poll
 		}
 	}
 
 	if feedState.Status == state.StatusWarming {
-		f.processWarmingFeed(feedURL, logger, feedState, latest)
-		return
+		f.processWarmingFeed(ctx, feedURL, logger, stored, feedState, latest, poll)
+		return poll
 	}
 
 	if feedState.Status != state.StatusReady {
 		logger.Error("Unknown feed state status; skipping notification because baseline is not comparable", "status", feedState.Status)
-		return
+		return poll
 	}
 
 	newItems := itemsAfter(items, feedState.LastPublishedAt, feedState.NotifyAfter)
+	// Items after the baseline are notified as new, even if an interrupted
+	// run saw them before they changed.
+	updates = slices.DeleteFunc(updates, func(u itemUpdate) bool { return slices.Contains(newItems, u.item) })
+	f.notifyUpdates(ctx, feedConfig, logger, feed, updates, poll)
+	burst := f.maxNotificationsPerFeedPerRun > 0 && len(newItems) > f.maxNotificationsPerFeedPerRun
+	if !burst {
+		f.reportBurst(ctx, feedConfig, 0, "")
+	}
 	if len(newItems) == 0 {
 		logger.Debug("No new items")
-		return
+		f.saveObservations(ctx, feedURL, logger, stored, poll)
+		return poll
 	}
 
-	if f.maxNotificationsPerFeedPerRun > 0 && len(newItems) > f.maxNotificationsPerFeedPerRun {
-		nextState := state.NewReadyStateAfter(*newItems[len(newItems)-1].PublishedParsed, feedState.NotifyAfter)
-		if err := f.store.SetFeedState(feedURL, nextState); err != nil {
-			logger.Error("Failed to advance state after suppressing notification burst", "error", err, "count", len(newItems))
-			return
+	if burst {
+		newItems = f.handleBurst(ctx, feedConfig, logger, stored, feedState, feed, newItems, poll)
+		if len(newItems) == 0 {
+			return poll
 		}
-		logger.Warn("Suppressed notification burst and advanced baseline", "count", len(newItems), "limit", f.maxNotificationsPerFeedPerRun, "latest", nextState.LastPublishedAt)
-		return
 	}
 
 	logger.Info("Found new items", "count", len(newItems))
+	span.SetAttributes(attribute.Int("rss.items.new", len(newItems)))
 
+	var nextState state.FeedState
+	processed := 0
+	held := make(heldLookup)
 	for _, item := range newItems {
-		payload := webhook.Payload{
-			FeedTitle:   feed.Title,
-			ItemTitle:   item.Title,
-			ItemURL:     item.Link,
-			PublishedAt: *item.PublishedParsed,
-		}
+		payload := newPayload(feed, item)
 
+		itemCtx, itemSpan := tracer.Start(ctx, "rss.deliver_item", trace.WithAttributes(itemAttributes(item)...))
 		for _, wh := range f.webhooks {
-			if err := f.whClient.SendWithRateLimit(ctx, wh, payload); err != nil {
+			if err := f.deliver(itemCtx, logger, wh, queuedItemID(feedURL, item), payload, time.Now(), held); err != nil {
 				logger.Error("Failed to post webhook", "name", wh.Name, "item", item.Title, "error", err)
 			}
 		}
+		itemSpan.End()
+		// A cancelled run may have interrupted delivery of this item, so it
+		// must stay after the baseline and be retried on the next run.
+		if ctx.Err() != nil {
+			logger.Warn("Feed processing interrupted; remaining items deferred to next run", "error", ctx.Err(), "remaining", len(newItems)-processed)
+			break
+		}
 
 		metricNewItems.WithLabelValues(feedLabel).Inc()
-		nextState := state.NewReadyStateAfter(*item.PublishedParsed, feedState.NotifyAfter)
-		if err := f.store.SetFeedState(feedURL, nextState); err != nil {
-			logger.Error("Failed to update feed state after notification", "error", err, "title", item.Title)
-			return
-		}
+		metricLastNewItem.WithLabelValues(feedLabel).SetToCurrentTime()
+		nextState = state.NewReadyStateAfter(*item.PublishedParsed, feedState.NotifyAfter)
+		processed++
 		logger.Info("Processed new item", "title", item.Title)
 	}
+	if processed == 0 {
+		return poll
+	}
+
+	// The baseline is written once per run rather than per item. Use a
+	// context that survives cancellation so progress made before shutdown
+	// is still recorded.
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stateWriteTimeout)
+	defer cancel()
+	if err := f.saveState(writeCtx, feedURL, stored, nextState, poll); err != nil {
+		logger.Error("Failed to update feed state after notification", "error", err, "processed", processed)
+	}
+	return poll
 }
 
-func (f *Fetcher) processWarmingFeed(feedURL string, logger *slog.Logger, feedState state.FeedState, latest time.Time) {
+func (f *Fetcher) processWarmingFeed(ctx context.Context, feedURL string, logger *slog.Logger, stored *state.FeedState, feedState state.FeedState, latest time.Time, poll *pollResult) {
 	if latest.After(feedState.LastPublishedAt) {
 		feedState.LastPublishedAt = latest
 		feedState.WarmupStableObservations = 1
@@ -158,7 +535,7 @@ func (f *Fetcher) processWarmingFeed(feedURL string, logger *slog.Logger, feedSt
 
 	if feedState.WarmupStableObservations >= f.initialWarmupStableObservations {
 		feedState = state.NewReadyStateAfter(feedState.LastPublishedAt, feedState.NotifyAfter)
-		if err := f.store.SetFeedState(feedURL, feedState); err != nil {
+		if err := f.saveState(ctx, feedURL, stored, feedState, poll); err != nil {
 			logger.Error("Failed to mark feed warmup complete", "error", err)
 			return
 		}
@@ -166,13 +543,145 @@ func (f *Fetcher) processWarmingFeed(feedURL string, logger *slog.Logger, feedSt
 		return
 	}
 
-	if err := f.store.SetFeedState(feedURL, feedState); err != nil {
+	if err := f.saveState(ctx, feedURL, stored, feedState, poll); err != nil {
 		logger.Error("Failed to update feed warmup state", "error", err)
 		return
 	}
 	logger.Info("Feed warmup continuing; notification skipped", "latest", feedState.LastPublishedAt, "stable_observations", feedState.WarmupStableObservations, "required", f.initialWarmupStableObservations)
 }
 
+// saveState replaces the state this run read with next, or fails with
+// state.ErrConflict.
+func (f *Fetcher) saveState(ctx context.Context, feedURL string, stored *state.FeedState, next state.FeedState, poll *pollResult) error {
+	next.ItemHistory = poll.history
+	next.ResolvedURL = poll.resolvedURL
+	next.MovedTo = poll.movedTo
+	next.StaleSince = poll.staleSince
+	next.Fingerprints = poll.fingerprints
+	err := f.store.CompareAndSetFeedState(ctx, feedURL, stored, next)
+	f.reportStore(ctx, err)
+	if err != nil {
+		return err
+	}
+	f.statuses.set(feedURL, next.Status)
+	return nil
+}
+
+// saveObservations records what poll observed on a run that changes nothing else.
+func (f *Fetcher) saveObservations(ctx context.Context, feedURL string, logger *slog.Logger, stored *state.FeedState, poll *pollResult) {
+	if stored == nil || (stored.ResolvedURL == poll.resolvedURL && stored.MovedTo == poll.movedTo && stored.StaleSince.Equal(poll.staleSince) && maps.Equal(stored.Fingerprints, poll.fingerprints)) {
+		return
+	}
+	if err := f.saveState(ctx, feedURL, stored, *stored, poll); err != nil {
+		logger.Warn("Failed to record feed observations", "error", err)
+	}
+}
+
+// checkStale returns when the feed turned stale, or zero if it is not.
+func (f *Fetcher) checkStale(ctx context.Context, feedConfig config.Feed, logger *slog.Logger, stored *state.FeedState, items []*gofeed.Item, now time.Time) time.Time {
+	staleAfter := f.staleAfter
+	if feedConfig.StaleAfter > 0 {
+		staleAfter = feedConfig.StaleAfter
+	}
+	// A feed without state has no history to judge.
+	if stored == nil {
+		return time.Time{}
+	}
+	if staleAfter <= 0 {
+		// Stale detection was turned off; forget an earlier finding.
+		f.statuses.setStale(feedConfig.Key(), false)
+		return time.Time{}
+	}
+
+	lastItemAt := stored.LastPublishedAt
+	for _, item := range items {
+		if item.PublishedParsed.After(lastItemAt) {
+			lastItemAt = *item.PublishedParsed
+		}
+	}
+	if lastItemAt.IsZero() {
+		return stored.StaleSince
+	}
+
+	stale := now.Sub(lastItemAt) > staleAfter
+	f.statuses.setStale(feedConfig.Key(), stale)
+	if f.perFeedLabels {
+		metricFeedStale.WithLabelValues(feedConfig.Label()).Set(boolToFloat(stale))
+	}
+	a := alert.Alert{
+		Kind:    "stale",
+		Key:     "stale:" + feedConfig.Key(),
+		Summary: fmt.Sprintf("Feed %s is stale", feedConfig.Label()),
+		URL:     feedConfig.URL,
+	}
+	switch {
+	case stale && stored.StaleSince.IsZero():
+		logger.Warn("Feed is stale; no new item within stale_after", "last_item_at", lastItemAt, "stale_after", staleAfter)
+		a.Detail = fmt.Sprintf("No new item since %s (stale_after %s).", lastItemAt.UTC().Format(time.RFC3339), staleAfter)
+		f.fire(ctx, a)
+		return now
+	case !stale && !stored.StaleSince.IsZero():
+		logger.Info("Stale feed resumed", "last_item_at", lastItemAt, "stale_since", stored.StaleSince)
+		a.Detail = fmt.Sprintf("New item published at %s; the feed was stale since %s.", lastItemAt.UTC().Format(time.RFC3339), stored.StaleSince.UTC().Format(time.RFC3339))
+		f.resolve(ctx, a)
+		return time.Time{}
+	}
+	return stored.StaleSince
+}
+
+// carryOverState moves the state stored under one of the feed's previous
+// keys to its current key, so that changing a feed's URL or giving it an
+// ID does not restart warmup. It returns state.ErrNoState if no previous
+// key has state.
+func (f *Fetcher) carryOverState(ctx context.Context, feedConfig config.Feed, logger *slog.Logger) (state.FeedState, error) {
+	for _, previous := range feedConfig.PreviousKeys() {
+		st, err := f.store.GetFeedState(ctx, previous)
+		if errors.Is(err, state.ErrNoState) {
+			continue
+		} else if err != nil {
+			return state.FeedState{}, fmt.Errorf("failed to read state of previous key %q: %w", previous, err)
+		}
+
+		st.OrphanedAt = time.Time{}
+		if err := f.store.CompareAndSetFeedState(ctx, feedConfig.Key(), nil, st); err != nil {
+			return state.FeedState{}, fmt.Errorf("failed to carry over state from previous key %q: %w", previous, err)
+		}
+		if err := f.store.DeleteFeedState(ctx, previous); err != nil {
+			logger.Warn("Failed to delete state of previous key after carrying it over; it will be garbage-collected", "previous_key", previous, "error", err)
+		}
+		logger.Info("Carried over feed state from previous key", "previous_key", previous, "key", feedConfig.Key())
+		return st, nil
+	}
+	return state.FeedState{}, state.ErrNoState
+}
+
+func feedAttributes(feedConfig config.Feed) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("rss.feed.name", feedConfig.Label()),
+		attribute.String("rss.feed.url", feedConfig.URL),
+		attribute.String("rss.feed.key", feedConfig.Key()),
+	}
+}
+
+func itemAttributes(item *gofeed.Item) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("rss.item.title", item.Title),
+		attribute.String("rss.item.url", item.Link),
+		attribute.String("rss.item.guid", item.GUID),
+	}
+	if item.PublishedParsed != nil {
+		attrs = append(attrs, attribute.String("rss.item.published_at", item.PublishedParsed.Format(time.RFC3339)))
+	}
+	return attrs
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func itemsWithPublishedTime(items []*gofeed.Item) []*gofeed.Item {
 	out := make([]*gofeed.Item, 0, len(items))
 	for _, item := range items {
@@ -197,10 +706,27 @@ func itemsAfter(items []*gofeed.Item, baseline, notifyAfter time.Time) []*gofeed
 	return out
 }
 
+// Run processes feeds until ctx is cancelled. In fixed mode every feed is
+// polled each interval; in adaptive mode due feeds are looked for more
+// often and each feed is polled on its own schedule, while orphan
+// collection still happens once per interval.
 func (f *Fetcher) Run(ctx context.Context, feeds []config.Feed, interval time.Duration) {
-	ticker := time.NewTicker(interval)
+	tick := interval
+	if f.scheduler != nil {
+		tick = min(f.scheduler.minInterval, scheduleTick)
+	}
+	ticker := time.NewTicker(tick)
 	defer ticker.Stop()
 
+	// Failed burst digests are retried from a queue as well.
+	if slices.ContainsFunc(f.webhooks, usesQueue) || slices.ContainsFunc(feeds, func(feedConfig config.Feed) bool {
+		return f.burstPolicy(feedConfig) == "digest"
+	}) {
+		go f.runQueues(ctx)
+	}
+
+	f.collectOrphans(ctx, feeds)
+	lastCollected := time.Now()
 	f.runOnce(ctx, feeds)
 
 	for {
@@ -208,21 +734,76 @@ func (f *Fetcher) Run(ctx context.Context, feeds []config.Feed, interval time.Du
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			if time.Since(lastCollected) >= interval-tick/2 {
+				f.collectOrphans(ctx, feeds)
+				lastCollected = time.Now()
+			}
 			f.runOnce(ctx, feeds)
 		}
 	}
 }
 
 func (f *Fetcher) runOnce(ctx context.Context, feeds []config.Feed) {
+	start := time.Now()
+	defer func() { metricCycleDuration.Observe(time.Since(start).Seconds()) }()
+	ctx, span := tracer.Start(ctx, "rss.cycle")
+	defer span.End()
+
+	if f.sharder != nil {
+		feeds = f.ownedFeeds(feeds)
+	}
+	f.statuses.retain(feeds)
+	if f.scheduler != nil {
+		feeds = f.dueFeeds(feeds, time.Now())
+	}
+	span.SetAttributes(attribute.Int("rss.feeds", len(feeds)))
+
 	var wg sync.WaitGroup
 	for _, feedConfig := range feeds {
 		wg.Add(1)
 		go func(feedConfig config.Feed) {
 			defer wg.Done()
-			ctx, cancel := context.WithTimeout(ctx, 5*time.Minute) // Increased timeout for rate limits
+			// The adaptive scheduler applies the jitter to when feeds are due.
+			if f.scheduler == nil {
+				if err := sleepCtx(ctx, jitterOffset(feedConfig.Key(), f.jitter)); err != nil {
+					return
+				}
+			}
+			if f.workers != nil {
+				select {
+				case f.workers <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-f.workers }()
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, feedTimeout)
 			defer cancel()
 			f.ProcessFeed(ctx, feedConfig)
 		}(feedConfig)
 	}
 	wg.Wait()
 }
+
+func (f *Fetcher) ownedFeeds(feeds []config.Feed) []config.Feed {
+	owned := make([]config.Feed, 0, len(feeds))
+	for _, feedConfig := range feeds {
+		if f.sharder.Owns(feedConfig.Key()) {
+			owned = append(owned, feedConfig)
+		}
+	}
+	metricOwnedFeeds.WithLabelValues(f.sharder.ID()).Set(float64(len(owned)))
+	slog.Debug("Processing owned feeds", "replica", f.sharder.ID(), "owned", len(owned), "configured", len(feeds))
+	return owned
+}
+
+func (f *Fetcher) dueFeeds(feeds []config.Feed, now time.Time) []config.Feed {
+	due := make([]config.Feed, 0, len(feeds))
+	for _, feedConfig := range feeds {
+		if f.scheduler.isDue(feedConfig.Key(), now) {
+			due = append(due, feedConfig)
+		}
+	}
+	return due
+}
@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"rss-fetcher/internal/alert"
 	"rss-fetcher/internal/config"
 	"rss-fetcher/internal/state"
 	"rss-fetcher/internal/webhook"
@@ -95,7 +97,7 @@ func TestBurstSuppressionAdvancesBaselineWithoutNotifications(t *testing.T) {
 	defer webhookServer.Close()
 
 	store := state.NewMemoryStore()
-	if err := store.SetFeedState(feedServer.URL, state.NewReadyState(baseline)); err != nil {
+	if err := store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(baseline)); err != nil {
 		t.Fatal(err)
 	}
 
@@ -113,7 +115,7 @@ func TestBurstSuppressionAdvancesBaselineWithoutNotifications(t *testing.T) {
 		t.Fatalf("webhook calls after suppressed burst = %d, want 0", got)
 	}
 
-	st, err := store.GetFeedState(feedServer.URL)
+	st, err := store.GetFeedState(context.Background(), feedServer.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -144,7 +146,7 @@ func TestWebhookPayloadUsesRSSFeedTitleWhenConfiguredNameExists(t *testing.T) {
 	defer webhookServer.Close()
 
 	store := state.NewMemoryStore()
-	if err := store.SetFeedState(feedServer.URL, state.NewReadyState(baseline)); err != nil {
+	if err := store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(baseline)); err != nil {
 		t.Fatal(err)
 	}
 
@@ -170,6 +172,52 @@ func TestWebhookPayloadUsesRSSFeedTitleWhenConfiguredNameExists(t *testing.T) {
 	}
 }
 
+func TestConcurrentFetchersSharingStoreNotifyOnce(t *testing.T) {
+	baseline := time.Now().Add(-1 * time.Hour).UTC().Truncate(time.Second)
+
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Keep the first fetch in flight while the second replica starts.
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{{Title: "new", PublishedAt: baseline.Add(time.Minute)}}))
+	}))
+	defer feedServer.Close()
+
+	var webhookCalls atomic.Int64
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookCalls.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	store := state.NewMemoryStore()
+	if err := store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+
+	webhooks := []config.Webhook{{Name: "test", URL: webhookServer.URL}}
+	feedsConfig := &config.FeedsConfig{
+		InitialWarmupStableObservations: 2,
+		MaxNotificationsPerFeedPerRun:   10,
+	}
+	replicas := []*Fetcher{
+		NewFetcher(store, webhook.NewClient(), webhooks, feedsConfig),
+		NewFetcher(store, webhook.NewClient(), webhooks, feedsConfig),
+	}
+
+	var wg sync.WaitGroup
+	for _, replica := range replicas {
+		wg.Go(func() {
+			replica.ProcessFeed(context.Background(), config.Feed{URL: feedServer.URL})
+		})
+	}
+	wg.Wait()
+
+	if got := webhookCalls.Load(); got != 1 {
+		t.Fatalf("webhook calls = %d, want 1", got)
+	}
+}
+
 type rssItem struct {
 	Title       string
 	PublishedAt time.Time
@@ -188,3 +236,252 @@ func rssFeed(items []rssItem) string {
 	}
 	return out + `</channel></rss>`
 }
+
+func TestPushedContentUsesSameDetectionPath(t *testing.T) {
+	baseline := time.Now().Add(-1 * time.Hour).UTC().Truncate(time.Second)
+
+	var webhookCalls atomic.Int64
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookCalls.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	store := state.NewMemoryStore()
+	feedConfig := config.Feed{URL: "https://example.com/rss.xml"}
+	if err := store.SetFeedState(context.Background(), feedConfig.URL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewFetcher(store, webhook.NewClient(), []config.Webhook{{
+		Name: "test",
+		URL:  webhookServer.URL,
+	}}, &config.FeedsConfig{
+		InitialWarmupStableObservations: 2,
+		MaxNotificationsPerFeedPerRun:   10,
+	})
+
+	pushed := rssFeed([]rssItem{
+		{Title: "seen", PublishedAt: baseline},
+		{Title: "pushed", PublishedAt: baseline.Add(time.Minute)},
+	})
+	fetcher.ProcessPushedFeed(context.Background(), feedConfig, []byte(pushed))
+	// A repeated push of the same content is not notified twice.
+	fetcher.ProcessPushedFeed(context.Background(), feedConfig, []byte(pushed))
+
+	if got := webhookCalls.Load(); got != 1 {
+		t.Fatalf("webhook calls after pushed item = %d, want 1", got)
+	}
+}
+
+func TestPushedContentWaitsForRunningPoll(t *testing.T) {
+	baseline := time.Now().Add(-1 * time.Hour).UTC().Truncate(time.Second)
+
+	var webhookCalls atomic.Int64
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		webhookCalls.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	store := state.NewMemoryStore()
+	feedConfig := config.Feed{URL: "https://example.com/rss.xml"}
+	if err := store.SetFeedState(context.Background(), feedConfig.URL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewFetcher(store, webhook.NewClient(), []config.Webhook{{Name: "test", URL: webhookServer.URL}}, &config.FeedsConfig{
+		InitialWarmupStableObservations: 2,
+		MaxNotificationsPerFeedPerRun:   10,
+	})
+
+	// A poll holds the feed's lock when the push arrives.
+	unlock, err := store.TryLock(context.Background(), "feed:"+feedConfig.Key(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(100*time.Millisecond, func() { unlock(context.Background()) })
+
+	pushed := rssFeed([]rssItem{{Title: "pushed", PublishedAt: baseline.Add(time.Minute)}})
+	fetcher.ProcessPushedFeed(context.Background(), feedConfig, []byte(pushed))
+
+	if got := webhookCalls.Load(); got != 1 {
+		t.Fatalf("webhook calls after push during a poll = %d, want 1", got)
+	}
+}
+
+func TestPushesPendingForAFeedAreCoalesced(t *testing.T) {
+	baseline := time.Now().Add(-1 * time.Hour).UTC().Truncate(time.Second)
+
+	var mu sync.Mutex
+	var titles []string
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			ItemTitle string `json:"item_title"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		titles = append(titles, payload.ItemTitle)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	store := state.NewMemoryStore()
+	feedConfig := config.Feed{URL: "https://example.com/rss.xml"}
+	if err := store.SetFeedState(context.Background(), feedConfig.URL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewFetcher(store, webhook.NewClient(), []config.Webhook{{Name: "test", URL: webhookServer.URL}}, &config.FeedsConfig{
+		InitialWarmupStableObservations: 2,
+		MaxNotificationsPerFeedPerRun:   10,
+	})
+
+	unlock, err := store.TryLock(context.Background(), "feed:"+feedConfig.Key(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	push := func(title string, published time.Time) []byte {
+		return []byte(rssFeed([]rssItem{{Title: title, PublishedAt: published}}))
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fetcher.ProcessPushedFeed(context.Background(), feedConfig, push("first", baseline.Add(time.Minute)))
+	}()
+	for {
+		fetcher.pushMu.Lock()
+		_, pending := fetcher.pushes[feedConfig.Key()]
+		fetcher.pushMu.Unlock()
+		if pending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Both return at once; only the newest is processed after the first.
+	fetcher.ProcessPushedFeed(context.Background(), feedConfig, push("superseded", baseline.Add(2*time.Minute)))
+	fetcher.ProcessPushedFeed(context.Background(), feedConfig, push("newest", baseline.Add(3*time.Minute)))
+	unlock(context.Background())
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(titles) != 2 || titles[0] != "first" || titles[1] != "newest" {
+		t.Fatalf("notified titles = %q, want [first newest]", titles)
+	}
+	if len(fetcher.pushes) != 0 {
+		t.Fatalf("pending pushes after processing = %d, want 0", len(fetcher.pushes))
+	}
+}
+
+func TestFeedLockedElsewhereIsRescheduled(t *testing.T) {
+	store := state.NewMemoryStore()
+	feedConfig := config.Feed{URL: "https://example.com/rss.xml"}
+	fetcher := NewFetcher(store, webhook.NewClient(), nil, &config.FeedsConfig{
+		Interval:  10 * time.Minute,
+		Scheduler: config.SchedulerConfig{Mode: "adaptive", MinInterval: 5 * time.Minute, MaxInterval: time.Hour},
+	})
+
+	unlock, err := store.TryLock(context.Background(), "feed:"+feedConfig.Key(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock(context.Background())
+
+	now := time.Now()
+	if due := fetcher.dueFeeds([]config.Feed{feedConfig}, now); len(due) != 1 {
+		t.Fatalf("due feeds before first poll = %d, want 1", len(due))
+	}
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	if due := fetcher.dueFeeds([]config.Feed{feedConfig}, now.Add(time.Minute)); len(due) != 0 {
+		t.Fatal("feed locked elsewhere is due again at the next tick")
+	}
+	if due := fetcher.dueFeeds([]config.Feed{feedConfig}, now.Add(11*time.Minute)); len(due) != 1 {
+		t.Fatal("feed locked elsewhere is not due after the interval")
+	}
+}
+
+type recordingAlerter struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recordingAlerter) Fire(_ context.Context, a alert.Alert) {
+	r.record("fire " + a.Key)
+}
+
+func (r *recordingAlerter) Resolve(_ context.Context, a alert.Alert) {
+	r.record("resolve " + a.Key)
+}
+
+func (r *recordingAlerter) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordingAlerter) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func TestStaleFeedAlertsOnceAndResolvesOnNewItem(t *testing.T) {
+	baseline := time.Now().Add(-72 * time.Hour).UTC().Truncate(time.Second)
+
+	var rss atomic.Value
+	rss.Store(rssFeed([]rssItem{{Title: "old", PublishedAt: baseline}}))
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rss.Load().(string))
+	}))
+	defer feedServer.Close()
+
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	store := state.NewMemoryStore()
+	if err := store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewFetcher(store, webhook.NewClient(), []config.Webhook{{
+		Name: "test",
+		URL:  webhookServer.URL,
+	}}, &config.FeedsConfig{
+		InitialWarmupStableObservations: 2,
+		MaxNotificationsPerFeedPerRun:   10,
+	})
+	alerts := &recordingAlerter{}
+	fetcher.SetAlerter(alerts, config.AlertsConfig{})
+	feedConfig := config.Feed{URL: feedServer.URL, StaleAfter: 24 * time.Hour}
+	key := "stale:" + feedServer.URL
+
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	if got := alerts.snapshot(); len(got) != 1 || got[0] != "fire "+key {
+		t.Fatalf("alerts after two stale runs = %v, want one firing alert", got)
+	}
+	st, err := store.GetFeedState(context.Background(), feedServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.StaleSince.IsZero() {
+		t.Fatal("stale_since not recorded in state")
+	}
+
+	rss.Store(rssFeed([]rssItem{
+		{Title: "old", PublishedAt: baseline},
+		{Title: "new", PublishedAt: time.Now().UTC().Truncate(time.Second)},
+	}))
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	if got := alerts.snapshot(); len(got) != 2 || got[1] != "resolve "+key {
+		t.Fatalf("alerts after new item = %v, want a resolution", got)
+	}
+	st, err = store.GetFeedState(context.Background(), feedServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.StaleSince.IsZero() {
+		t.Fatalf("stale_since = %s after recovery, want zero", st.StaleSince)
+	}
+}
@@ -0,0 +1,399 @@
+package feed
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/mmcdole/gofeed"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/netpolicy"
+)
+
+const userAgent = "rss-fetcher/1.2"
+
+var (
+	// errOversized is returned when a response exceeds a size limit.
+	errOversized = errors.New("response body too large")
+	// errParse is wrapped by errors for content that is not a usable feed.
+	errParse = errors.New("failed to parse feed")
+)
+
+// fetched is the outcome of fetching a feed.
+type fetched struct {
+	feed   *gofeed.Feed
+	header http.Header // Nil for content pushed by a WebSub hub
+	// resolvedURL is the feed URL discovered from the configured page, or
+	// empty if the configured URL is a feed itself.
+	resolvedURL string
+	// movedTo is where the configured URL permanently redirects, if it
+	// does.
+	movedTo string
+	// size is the length of the feed document after decompression.
+	size int
+}
+
+// notFeedError is returned by fetchFeed when the response is not a feed.
+type notFeedError struct {
+	url     *url.URL // Final URL after redirects
+	movedTo string
+	page    []byte
+}
+
+func (e *notFeedError) Error() string {
+	return fmt.Sprintf("%s is not a feed", e.url)
+}
+
+func (e *notFeedError) Unwrap() error {
+	return errParse
+}
+
+// fetchErrorKind classifies a fetch error for the status label of
+// rss_fetch_count_total.
+func fetchErrorKind(err error) string {
+	var (
+		httpErr     gofeed.HTTPError
+		dnsErr      *net.DNSError
+		netErr      net.Error
+		certErr     *tls.CertificateVerificationError
+		unknownCA   x509.UnknownAuthorityError
+		hostnameErr x509.HostnameError
+		invalidCert x509.CertificateInvalidError
+		recordErr   tls.RecordHeaderError
+		alertErr    tls.AlertError
+	)
+	switch {
+	case errors.Is(err, errOversized):
+		return "oversized"
+	case errors.Is(err, errParse):
+		return "parse"
+	case errors.Is(err, netpolicy.ErrBlocked):
+		return "blocked"
+	case errors.As(err, &httpErr):
+		return "http_status"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.As(err, &certErr), errors.As(err, &unknownCA), errors.As(err, &hostnameErr),
+		errors.As(err, &invalidCert), errors.As(err, &recordErr), errors.As(err, &alertErr):
+		return "tls"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	}
+	return "error"
+}
+
+// httpGetter downloads feeds and pages within size limits.
+type httpGetter struct {
+	client              *http.Client
+	transport           *http.Transport
+	maxBodySize         int64
+	maxDecompressedSize int64
+}
+
+func newHTTPGetter(cfg config.FetchConfig) *httpGetter {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Compression is negotiated and decoded by get so that the decoded
+	// size can be bounded.
+	transport.DisableCompression = true
+	return &httpGetter{
+		client:              &http.Client{Transport: transport, Timeout: cfg.Timeout},
+		transport:           transport,
+		maxBodySize:         cfg.MaxBodySize,
+		maxDecompressedSize: cfg.MaxDecompressedSize,
+	}
+}
+
+// get downloads rawURL and decodes its body. Non-2xx responses fail with
+// gofeed.HTTPError.
+func (g *httpGetter) get(ctx context.Context, rawURL string) ([]byte, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, resp, gofeed.HTTPError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
+	body, err := g.readBody(resp)
+	if err != nil {
+		return nil, resp, err
+	}
+	return body, resp, nil
+}
+
+// readBody reads and decompresses resp.Body, enforcing the size limits on
+// both the transferred and the decoded bytes.
+func (g *httpGetter) readBody(resp *http.Response) ([]byte, error) {
+	if g.maxBodySize > 0 && resp.ContentLength > g.maxBodySize {
+		return nil, fmt.Errorf("%w: Content-Length %d exceeds %d bytes", errOversized, resp.ContentLength, g.maxBodySize)
+	}
+	source := &sourceReader{r: resp.Body}
+	var raw io.Reader = source
+	if g.maxBodySize > 0 {
+		raw = &limitReader{r: raw, remaining: g.maxBodySize, limit: g.maxBodySize}
+	}
+
+	var decoded io.Reader
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		decoded = raw
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(raw)
+		if err != nil {
+			return nil, readError(source, err)
+		}
+		defer zr.Close()
+		decoded = zr
+	case "deflate":
+		decoded = newDeflateReader(raw)
+	case "br":
+		decoded = brotli.NewReader(raw)
+	default:
+		return nil, fmt.Errorf("%w: unsupported Content-Encoding %q", errParse, encoding)
+	}
+	if g.maxDecompressedSize > 0 {
+		decoded = &limitReader{r: decoded, remaining: g.maxDecompressedSize, limit: g.maxDecompressedSize}
+	}
+
+	body, err := io.ReadAll(decoded)
+	if err != nil {
+		return nil, readError(source, err)
+	}
+	return body, nil
+}
+
+// readError attributes a body read failure to the network, a size limit,
+// or corrupt compressed data.
+func readError(source *sourceReader, err error) error {
+	switch {
+	case source.err != nil:
+		return source.err
+	case errors.Is(err, errOversized):
+		return err
+	}
+	return fmt.Errorf("%w: invalid compressed body: %w", errParse, err)
+}
+
+// sourceReader remembers the first error of the underlying connection, so
+// that it can be told apart from decompression errors.
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF && s.err == nil {
+		s.err = err
+	}
+	return n, err
+}
+
+// limitReader fails with errOversized once more than limit bytes are read.
+type limitReader struct {
+	r         io.Reader
+	remaining int64
+	limit     int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Only fail if there actually is more data.
+		var probe [1]byte
+		if n, err := l.r.Read(probe[:]); n > 0 {
+			return 0, fmt.Errorf("%w: exceeds %d bytes", errOversized, l.limit)
+		} else {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// newDeflateReader decodes "deflate" content, which is meant to be zlib
+// wrapped but is sent as raw DEFLATE by some servers.
+func newDeflateReader(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		if zr, err := zlib.NewReader(br); err == nil {
+			return zr
+		}
+	}
+	return flate.NewReader(br)
+}
+
+// feedMediaTypes are the content types feeds are served with.
+var feedMediaTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/xml":       true,
+	"text/xml":              true,
+	"application/feed+json": true,
+	"application/json":      true,
+}
+
+// checkContentType rejects responses that are neither a feed nor an HTML
+// page that may advertise one. Feeds are often mislabelled (text/plain,
+// application/octet-stream), so other types are accepted if the body looks
+// like markup or JSON.
+func checkContentType(contentType string, body []byte) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" || feedMediaTypes[mediaType] || strings.HasSuffix(mediaType, "+xml") ||
+		mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		return nil
+	}
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(trimmed) > 0 && (trimmed[0] == '<' || trimmed[0] == '{') {
+		return nil
+	}
+	return fmt.Errorf("%w: unexpected content type %q", errParse, mediaType)
+}
+
+// permanentRedirect returns where the request that produced resp was
+// permanently redirected to: the target of the leading run of 301 and 308
+// responses in its redirect chain, or "" if the first hop was not
+// permanent.
+func permanentRedirect(resp *http.Response) string {
+	var chain []*http.Request
+	for req := resp.Request; req != nil; {
+		chain = append(chain, req)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
+	}
+
+	// chain runs from the last request back to the original one; each
+	// request's Response is the redirect that created it.
+	movedTo := ""
+	for i := len(chain) - 2; i >= 0; i-- {
+		status := chain[i].Response.StatusCode
+		if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect {
+			break
+		}
+		movedTo = chain[i].URL.String()
+	}
+	return movedTo
+}
+
+// fetchFeed downloads and parses feedURL, keeping the response headers.
+func (f *Fetcher) fetchFeed(ctx context.Context, feedURL string) (fetched, error) {
+	release, err := f.hosts.acquire(ctx, hostOf(feedURL))
+	if err != nil {
+		return fetched{}, fmt.Errorf("gave up waiting for a fetch slot on the feed host: %w", err)
+	}
+	body, resp, err := f.getter.get(ctx, feedURL)
+	release()
+	if err != nil {
+		return fetched{}, err
+	}
+	if err := checkContentType(resp.Header.Get("Content-Type"), body); err != nil {
+		return fetched{}, err
+	}
+
+	result := fetched{header: resp.Header, movedTo: permanentRedirect(resp), size: len(body)}
+	result.feed, err = f.parser.Parse(bytes.NewReader(body))
+	if errors.Is(err, gofeed.ErrFeedTypeNotDetected) {
+		return fetched{}, &notFeedError{url: resp.Request.URL, movedTo: result.movedTo, page: body}
+	} else if err != nil {
+		return fetched{}, fmt.Errorf("%w: %w", errParse, err)
+	}
+	return result, nil
+}
+
+// fetchResolved fetches feedURL, following a page to the feed it advertises.
+func (f *Fetcher) fetchResolved(ctx context.Context, logger *slog.Logger, feedURL, resolvedURL string) (fetched, error) {
+	if resolvedURL != "" {
+		result, err := f.fetchFeed(ctx, resolvedURL)
+		var httpErr gofeed.HTTPError
+		if err == nil {
+			// A discovered URL is ours to update; only a move of the
+			// configured page needs the config changed.
+			result.resolvedURL = resolvedURL
+			if result.movedTo != "" {
+				result.resolvedURL, result.movedTo = result.movedTo, ""
+			}
+			return result, nil
+		} else if !errors.As(err, &httpErr) || (httpErr.StatusCode != http.StatusNotFound && httpErr.StatusCode != http.StatusGone) {
+			return fetched{}, err
+		}
+		logger.Warn("Discovered feed URL is gone; rediscovering from configured page", "resolved_url", resolvedURL, "status", httpErr.StatusCode)
+	}
+
+	result, err := f.fetchFeed(ctx, feedURL)
+	var notFeed *notFeedError
+	if !errors.As(err, &notFeed) {
+		return result, err
+	}
+
+	candidates := discoverCandidates(notFeed.page, notFeed.url)
+	if len(candidates) == 0 {
+		return fetched{}, fmt.Errorf("%w and advertises no feed", err)
+	}
+	best := candidates[0].URL
+	result, err = f.fetchFeed(ctx, best)
+	if err != nil {
+		return fetched{}, fmt.Errorf("failed to fetch feed %s discovered from %s: %w", best, feedURL, err)
+	}
+	result.resolvedURL = best
+	if result.movedTo != "" {
+		result.resolvedURL = result.movedTo
+	}
+	result.movedTo = notFeed.movedTo
+	return result, nil
+}
+
+// DiscoverFeeds returns the feeds advertised by the page at pageURL, best
+// first. If pageURL is a feed itself, it is the only candidate. The page is
+// requested through policy.
+func DiscoverFeeds(ctx context.Context, cfg config.FetchConfig, policy *netpolicy.Policy, pageURL string) ([]Candidate, error) {
+	getter := newHTTPGetter(cfg)
+	policy.Apply(getter.transport)
+	body, resp, err := getter.get(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	switch gofeed.DetectFeedType(bytes.NewReader(body)) {
+	case gofeed.FeedTypeRSS:
+		return []Candidate{{URL: resp.Request.URL.String(), Type: "application/rss+xml"}}, nil
+	case gofeed.FeedTypeAtom:
+		return []Candidate{{URL: resp.Request.URL.String(), Type: "application/atom+xml"}}, nil
+	case gofeed.FeedTypeJSON:
+		return []Candidate{{URL: resp.Request.URL.String(), Type: "application/feed+json"}}, nil
+	}
+	return discoverCandidates(body, resp.Request.URL), nil
+}
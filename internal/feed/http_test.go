@@ -0,0 +1,196 @@
+package feed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/mmcdole/gofeed"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestFetchFeedRecordsOnlyPermanentRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old.xml", http.RedirectHandler("/moved.xml", http.StatusMovedPermanently))
+	mux.Handle("/moved.xml", http.RedirectHandler("/new.xml", http.StatusPermanentRedirect))
+	mux.Handle("/temporary.xml", http.RedirectHandler("/new.xml", http.StatusFound))
+	mux.Handle("/mixed.xml", http.RedirectHandler("/temporary.xml", http.StatusMovedPermanently))
+	mux.HandleFunc("/new.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{{Title: "post", PublishedAt: time.Now()}}))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	fetcher := NewFetcher(state.NewMemoryStore(), webhook.NewClient(), nil, &config.FeedsConfig{})
+	for path, want := range map[string]string{
+		"/new.xml":       "",
+		"/old.xml":       server.URL + "/new.xml",
+		"/temporary.xml": "",
+		"/mixed.xml":     server.URL + "/temporary.xml",
+	} {
+		result, err := fetcher.fetchFeed(context.Background(), server.URL+path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.movedTo != want {
+			t.Fatalf("movedTo for %s = %q, want %q", path, result.movedTo, want)
+		}
+	}
+}
+
+func TestFetchFeedDecodesCompressedBodies(t *testing.T) {
+	feed := rssFeed([]rssItem{{Title: "post", PublishedAt: time.Now()}})
+	encoders := map[string]func(*bytes.Buffer) io.WriteCloser{
+		"gzip":    func(b *bytes.Buffer) io.WriteCloser { return gzip.NewWriter(b) },
+		"deflate": func(b *bytes.Buffer) io.WriteCloser { return zlib.NewWriter(b) },
+		"br":      func(b *bytes.Buffer) io.WriteCloser { return brotli.NewWriter(b) },
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.URL.Query().Get("encoding")
+		var body bytes.Buffer
+		zw := encoders[encoding](&body)
+		io.WriteString(zw, feed)
+		zw.Close()
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(body.Bytes())
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(state.NewMemoryStore(), webhook.NewClient(), nil, &config.FeedsConfig{})
+	for encoding := range encoders {
+		result, err := fetcher.fetchFeed(context.Background(), server.URL+"/?encoding="+encoding)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if len(result.feed.Items) != 1 || result.feed.Items[0].Title != "post" {
+			t.Fatalf("%s: unexpected items %+v", encoding, result.feed.Items)
+		}
+	}
+}
+
+func TestFetchFeedEnforcesSizeLimits(t *testing.T) {
+	feed := rssFeed([]rssItem{{Title: strings.Repeat("a", 4096), PublishedAt: time.Now()}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		if r.URL.Query().Has("gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			zw := gzip.NewWriter(w)
+			io.WriteString(zw, feed)
+			zw.Close()
+			return
+		}
+		io.WriteString(w, feed)
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name  string
+		query string
+		fetch config.FetchConfig
+	}{
+		{"raw body", "", config.FetchConfig{MaxBodySize: 1024}},
+		// The compressed body fits, the decompressed one does not.
+		{"decompressed body", "?gzip", config.FetchConfig{MaxBodySize: 1024, MaxDecompressedSize: 2048}},
+	} {
+		fetcher := NewFetcher(state.NewMemoryStore(), webhook.NewClient(), nil, &config.FeedsConfig{Fetch: tc.fetch})
+		_, err := fetcher.fetchFeed(context.Background(), server.URL+"/"+tc.query)
+		if !errors.Is(err, errOversized) {
+			t.Fatalf("%s: err = %v, want errOversized", tc.name, err)
+		}
+	}
+}
+
+func TestFetchFeedRejectsNonFeedContentTypes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		case "/mislabelled":
+			w.Header().Set("Content-Type", "text/plain")
+			fmt.Fprint(w, rssFeed([]rssItem{{Title: "post", PublishedAt: time.Now()}}))
+		}
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(state.NewMemoryStore(), webhook.NewClient(), nil, &config.FeedsConfig{})
+	if _, err := fetcher.fetchFeed(context.Background(), server.URL+"/image"); fetchErrorKind(err) != "parse" {
+		t.Fatalf("image: err = %v, want a parse error", err)
+	}
+	if _, err := fetcher.fetchFeed(context.Background(), server.URL+"/mislabelled"); err != nil {
+		t.Fatalf("mislabelled feed: %v", err)
+	}
+}
+
+func TestFetchErrorKind(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: exceeds 10 bytes", errOversized), "oversized"},
+		{&notFeedError{url: &url.URL{Host: "example.com"}}, "parse"},
+		{gofeed.HTTPError{StatusCode: 500, Status: "500 Internal Server Error"}, "http_status"},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}}, "dns"},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}, "tls"},
+		{fmt.Errorf("gave up waiting: %w", context.DeadlineExceeded), "timeout"},
+		{errors.New("connection refused"), "error"},
+	} {
+		if got := fetchErrorKind(tc.err); got != tc.want {
+			t.Errorf("fetchErrorKind(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestStateCarriesOverToNewKey(t *testing.T) {
+	baseline := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{{Title: "seen", PublishedAt: baseline}}))
+	}))
+	defer feedServer.Close()
+
+	store := state.NewMemoryStore()
+	oldURL := "https://old.example.com/rss.xml"
+	if err := store.SetFeedState(context.Background(), oldURL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := NewFetcher(store, webhook.NewClient(), nil, &config.FeedsConfig{
+		SkipInitialNotify:               true,
+		InitialWarmupStableObservations: 2,
+	})
+	fetcher.ProcessFeed(context.Background(), config.Feed{
+		ID:           "example",
+		URL:          feedServer.URL,
+		PreviousURLs: []string{oldURL},
+	})
+
+	st, err := store.GetFeedState(context.Background(), "example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != state.StatusReady || !st.LastPublishedAt.Equal(baseline) {
+		t.Fatalf("carried over state = %+v, want ready baseline from previous URL", st)
+	}
+	if _, err := store.GetFeedState(context.Background(), oldURL); !errors.Is(err, state.ErrNoState) {
+		t.Fatalf("GetFeedState of previous URL error = %v, want ErrNoState", err)
+	}
+}
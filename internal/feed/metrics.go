@@ -0,0 +1,207 @@
+package feed
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+)
+
+// Metrics with a feed label use the feed's name (or URL), or an empty
+// value for all feeds when per-feed labels are disabled.
+var (
+	metricFetchCount = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_fetch_count_total",
+		Help: "The total number of feed fetches",
+	}, []string{"feed", "status"})
+
+	metricFetchDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rss_fetch_duration_seconds",
+		Help:    "Time to fetch a feed, including discovery from a configured page",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"feed"})
+
+	metricResponseSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rss_fetch_response_size_bytes",
+		Help:    "Size of fetched feed documents after decompression",
+		Buckets: prometheus.ExponentialBuckets(1024, 4, 8), // 1 KiB to 16 MiB
+	}, []string{"feed"})
+
+	metricLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rss_feed_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful fetch or push of a feed",
+	}, []string{"feed"})
+
+	metricLastNewItem = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rss_feed_last_new_item_timestamp_seconds",
+		Help: "Unix time a new item of a feed was last delivered",
+	}, []string{"feed"})
+
+	metricNewItems = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_new_items_total",
+		Help: "The total number of new items found",
+	}, []string{"feed"})
+
+	metricBurstSuppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_burst_suppressed_total",
+		Help: "Runs whose new items exceeded max_notifications_per_feed_per_run and were not delivered",
+	}, []string{"feed"})
+
+	metricBursts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_bursts_total",
+		Help: "Runs with more new items than max_notifications_per_feed_per_run, by the burst policy applied",
+	}, []string{"feed", "policy"})
+
+	metricItemUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_item_updates_total",
+		Help: "Seen items whose title, link, content or updated time changed",
+	}, []string{"feed"})
+
+	metricFilteredItems = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_items_filtered_total",
+		Help: "Items that were not delivered, by reason",
+	}, []string{"feed", "reason"})
+
+	metricFeeds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rss_feeds",
+		Help: "The number of feeds processed by this replica, by state status",
+	}, []string{"status"})
+
+	metricFeedStale = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rss_feed_stale",
+		Help: "1 if the feed has had no new item for longer than its stale_after (only with per-feed labels)",
+	}, []string{"feed"})
+
+	metricStaleFeeds = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rss_stale_feeds",
+		Help: "The number of feeds processed by this replica that are stale",
+	})
+
+	metricDigestQueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_digest_items_queued_total",
+		Help: "Items queued for a webhook's digest instead of being posted",
+	}, []string{"webhook"})
+
+	metricDigestItemsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_digest_items_sent_total",
+		Help: "Queued items delivered in digests",
+	}, []string{"webhook"})
+
+	metricDigestPending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rss_digest_pending_items",
+		Help: "Items waiting in a webhook's digest queue when it was last checked",
+	}, []string{"webhook"})
+
+	metricHeldQueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_held_items_queued_total",
+		Help: "Items held because they were found outside a webhook's delivery window",
+	}, []string{"webhook"})
+
+	metricHeldSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_held_items_sent_total",
+		Help: "Held items delivered after a webhook's delivery window opened",
+	}, []string{"webhook"})
+
+	metricHeldPending = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rss_held_pending_items",
+		Help: "Items waiting for a webhook's delivery window when it was last checked",
+	}, []string{"webhook"})
+
+	metricDuplicateItems = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_duplicate_items_total",
+		Help: "Items not posted to a webhook because it received the same URL or GUID within its dedup_window",
+	}, []string{"webhook"})
+
+	metricCycleDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "rss_cycle_duration_seconds",
+		Help:    "Time to process all due feeds of a run",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12), // 0.5s to ~17m
+	})
+
+	metricOwnedFeeds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rss_shard_owned_feeds",
+		Help: "The number of configured feeds owned by this replica",
+	}, []string{"replica"})
+
+	metricFeedMoved = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "rss_feed_moved",
+		Help: "1 if the configured feed URL permanently redirects and the config should be updated",
+	}, []string{"feed"})
+
+	metricOrphanedStates = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rss_orphaned_feed_states",
+		Help: "The number of stored feed states whose feed is no longer configured",
+	})
+)
+
+// metricLabel is the feed label value of feedConfig.
+func (f *Fetcher) metricLabel(feedConfig config.Feed) string {
+	if !f.perFeedLabels {
+		return ""
+	}
+	return feedConfig.Label()
+}
+
+// feedStatuses tracks the status and staleness of this replica's feeds.
+type feedStatuses struct {
+	mu     sync.Mutex
+	status map[string]string // by feed key
+	stale  map[string]bool   // by feed key
+}
+
+func newFeedStatuses() *feedStatuses {
+	return &feedStatuses{status: make(map[string]string), stale: make(map[string]bool)}
+}
+
+func (s *feedStatuses) setStale(feedKey string, stale bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stale {
+		s.stale[feedKey] = true
+	} else {
+		delete(s.stale, feedKey)
+	}
+	s.publish()
+}
+
+func (s *feedStatuses) set(feedKey, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status[feedKey] = status
+	s.publish()
+}
+
+// retain forgets feeds that are no longer configured or owned.
+func (s *feedStatuses) retain(feeds []config.Feed) {
+	keep := make(map[string]bool, len(feeds))
+	for _, feedConfig := range feeds {
+		keep[feedConfig.Key()] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.status {
+		if !keep[key] {
+			delete(s.status, key)
+		}
+	}
+	for key := range s.stale {
+		if !keep[key] {
+			delete(s.stale, key)
+		}
+	}
+	s.publish()
+}
+
+func (s *feedStatuses) publish() {
+	counts := map[string]int{state.StatusWarming: 0, state.StatusReady: 0}
+	for _, status := range s.status {
+		counts[status]++
+	}
+	for status, n := range counts {
+		metricFeeds.WithLabelValues(status).Set(float64(n))
+	}
+	metricStaleFeeds.Set(float64(len(s.stale)))
+}
@@ -0,0 +1,80 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestMetricsFollowFeedLifecycle(t *testing.T) {
+	baseline := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	items := []rssItem{{Title: "seen", PublishedAt: baseline}}
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed(items))
+	}))
+	defer feedServer.Close()
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	feedConfig := config.Feed{Name: "metrics-lifecycle", URL: feedServer.URL}
+	fetcher := NewFetcher(state.NewMemoryStore(), webhook.NewClient(), []config.Webhook{{
+		Name: "metrics-lifecycle",
+		URL:  webhookServer.URL,
+	}}, &config.FeedsConfig{
+		SkipInitialNotify:               true,
+		InitialWarmupStableObservations: 1,
+		MaxNotificationsPerFeedPerRun:   1,
+		Metrics:                         config.MetricsConfig{PerFeedLabels: true},
+	})
+
+	fetcher.runOnce(context.Background(), []config.Feed{feedConfig})
+	if got := testutil.ToFloat64(metricFeeds.WithLabelValues(state.StatusWarming)); got != 1 {
+		t.Fatalf("warming feeds = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metricLastSuccess.WithLabelValues("metrics-lifecycle")); got == 0 {
+		t.Fatal("last success timestamp not set")
+	}
+
+	fetcher.runOnce(context.Background(), []config.Feed{feedConfig})
+	if got := testutil.ToFloat64(metricFeeds.WithLabelValues(state.StatusReady)); got != 1 {
+		t.Fatalf("ready feeds = %v, want 1", got)
+	}
+
+	// Only items published after warmup started are notified.
+	now := time.Now()
+	items = append(items,
+		rssItem{Title: "one", PublishedAt: now.Add(time.Minute)},
+		rssItem{Title: "two", PublishedAt: now.Add(2 * time.Minute)},
+	)
+	fetcher.runOnce(context.Background(), []config.Feed{feedConfig})
+	if got := testutil.ToFloat64(metricBurstSuppressed.WithLabelValues("metrics-lifecycle")); got != 1 {
+		t.Fatalf("suppressed bursts = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metricFilteredItems.WithLabelValues("metrics-lifecycle", "burst")); got != 2 {
+		t.Fatalf("filtered burst items = %v, want 2", got)
+	}
+
+	items = append(items, rssItem{Title: "three", PublishedAt: now.Add(3 * time.Minute)})
+	fetcher.runOnce(context.Background(), []config.Feed{feedConfig})
+	if got := testutil.ToFloat64(metricLastNewItem.WithLabelValues("metrics-lifecycle")); got == 0 {
+		t.Fatal("last new item timestamp not set")
+	}
+
+	// Feeds dropped from the config no longer count.
+	fetcher.runOnce(context.Background(), nil)
+	if got := testutil.ToFloat64(metricFeeds.WithLabelValues(state.StatusReady)); got != 0 {
+		t.Fatalf("ready feeds after removal = %v, want 0", got)
+	}
+}
@@ -0,0 +1,68 @@
+package feed
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+)
+
+// collectOrphans marks and eventually deletes stored states of feeds that
+// were removed from the configuration. Failures are logged and retried on
+// the next run; they never block fetching.
+func (f *Fetcher) collectOrphans(ctx context.Context, feeds []config.Feed) {
+	// Previous keys stay active until the feed's next run carries their
+	// state over.
+	active := make([]string, 0, len(feeds))
+	for _, feedConfig := range feeds {
+		active = append(active, feedConfig.Key())
+		active = append(active, feedConfig.PreviousKeys()...)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	result, err := state.CollectOrphans(ctx, f.store, active, f.orphanGracePeriod, time.Now())
+	if err != nil {
+		slog.Error("Failed to collect orphaned feed states", "error", err)
+		return
+	}
+	metricOrphanedStates.Set(float64(result.Orphaned))
+
+	if result.Marked > 0 || result.Restored > 0 || result.Deleted > 0 {
+		slog.Info("Reconciled orphaned feed states",
+			"orphaned", result.Orphaned,
+			"marked", result.Marked,
+			"restored", result.Restored,
+			"deleted", result.Deleted,
+			"grace_period", f.orphanGracePeriod)
+	} else if result.Orphaned > 0 {
+		slog.Debug("Orphaned feed states pending deletion", "orphaned", result.Orphaned, "grace_period", f.orphanGracePeriod)
+	}
+
+	f.collectOrphanQueues(ctx)
+}
+
+// collectOrphanQueues deletes the digest, held and burst digest queues of
+// webhooks that were removed from the configuration or renamed, which
+// would otherwise never be flushed.
+func (f *Fetcher) collectOrphanQueues(ctx context.Context) {
+	if f.queue == nil {
+		return
+	}
+	active := make([]string, 0, 3*len(f.webhooks))
+	for _, wh := range f.webhooks {
+		active = append(active, digestQueue(wh), heldQueue(wh), burstDigestQueue(wh))
+	}
+
+	deleted, err := state.CollectOrphanQueues(ctx, f.queue, []string{"digest:", "held:", "burst-digest:"}, active, f.orphanGracePeriod, time.Now())
+	if err != nil {
+		slog.Error("Failed to collect orphaned webhook queues", "error", err)
+		return
+	}
+	if deleted > 0 {
+		slog.Info("Deleted queues of removed webhooks", "deleted", deleted, "grace_period", f.orphanGracePeriod)
+	}
+}
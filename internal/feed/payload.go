@@ -0,0 +1,99 @@
+package feed
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+
+	"rss-fetcher/internal/webhook"
+)
+
+// newPayload builds the webhook payload for item of feed.
+func newPayload(feed *gofeed.Feed, item *gofeed.Item) webhook.Payload {
+	payload := webhook.Payload{
+		FeedTitle:    feed.Title,
+		ItemTitle:    item.Title,
+		ItemURL:      item.Link,
+		PublishedAt:  *item.PublishedParsed,
+		FeedLink:     feed.Link,
+		FeedLanguage: feed.Language,
+		ItemGUID:     item.GUID,
+		Categories:   item.Categories,
+		Description:  item.Description,
+		Content:      item.Content,
+		Thumbnail:    thumbnailOf(item),
+	}
+	if feed.Image != nil {
+		payload.FeedImage = feed.Image.URL
+	}
+	if item.UpdatedParsed != nil {
+		payload.UpdatedAt = *item.UpdatedParsed
+	}
+
+	authors := item.Authors
+	if len(authors) == 0 && item.Author != nil {
+		authors = []*gofeed.Person{item.Author}
+	}
+	for _, author := range authors {
+		if author != nil && (author.Name != "" || author.Email != "") {
+			payload.Authors = append(payload.Authors, webhook.Author{Name: author.Name, Email: author.Email})
+		}
+	}
+
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil || enclosure.URL == "" {
+			continue
+		}
+		length, _ := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+		payload.Enclosures = append(payload.Enclosures, webhook.Enclosure{
+			URL:    enclosure.URL,
+			Type:   enclosure.Type,
+			Length: max(length, 0),
+		})
+	}
+	return payload
+}
+
+// thumbnailOf picks an image for item, preferring explicit thumbnails.
+func thumbnailOf(item *gofeed.Item) string {
+	media := item.Extensions["media"]
+	if url := mediaThumbnail(media); url != "" {
+		return url
+	}
+	for _, group := range media["group"] {
+		if url := mediaThumbnail(group.Children); url != "" {
+			return url
+		}
+	}
+	for _, enclosure := range item.Enclosures {
+		if enclosure != nil && strings.HasPrefix(enclosure.Type, "image/") && enclosure.URL != "" {
+			return enclosure.URL
+		}
+	}
+	if item.ITunesExt != nil && item.ITunesExt.Image != "" {
+		return item.ITunesExt.Image
+	}
+	if item.Image != nil {
+		return item.Image.URL
+	}
+	return ""
+}
+
+// mediaThumbnail returns the first media thumbnail or image in elements.
+func mediaThumbnail(elements map[string][]ext.Extension) string {
+	for _, thumbnail := range elements["thumbnail"] {
+		if url := thumbnail.Attrs["url"]; url != "" {
+			return url
+		}
+	}
+	for _, content := range elements["content"] {
+		if strings.HasPrefix(content.Attrs["type"], "image/") || content.Attrs["medium"] == "image" {
+			if url := content.Attrs["url"]; url != "" {
+				return url
+			}
+		}
+	}
+	return ""
+}
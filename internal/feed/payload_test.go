@@ -0,0 +1,87 @@
+package feed
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestNewPayloadFromAtomWithMediaGroup(t *testing.T) {
+	feed, err := gofeed.NewParser().Parse(strings.NewReader(`<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/" xml:lang="ja">
+<title>Channel</title>
+<link rel="alternate" href="https://www.youtube.com/channel/abc"/>
+<entry>
+<id>yt:video:xyz</id>
+<title>Video</title>
+<link rel="alternate" href="https://www.youtube.com/watch?v=xyz"/>
+<author><name>Alice</name></author>
+<published>2026-04-29T12:00:00+00:00</published>
+<updated>2026-04-29T13:00:00+00:00</updated>
+<media:group>
+<media:title>Video</media:title>
+<media:thumbnail url="https://i.ytimg.com/vi/xyz/hqdefault.jpg" width="480" height="360"/>
+<media:description>About the video</media:description>
+</media:group>
+</entry>
+</feed>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := itemsWithPublishedTime(feed.Items)
+	payload := newPayload(feed, items[0])
+	if payload.ItemGUID != "yt:video:xyz" || payload.FeedLink != "https://www.youtube.com/channel/abc" || payload.FeedLanguage != "ja" {
+		t.Fatalf("payload feed/guid fields = %+v", payload)
+	}
+	if payload.Thumbnail != "https://i.ytimg.com/vi/xyz/hqdefault.jpg" {
+		t.Fatalf("Thumbnail = %q, want media:group thumbnail", payload.Thumbnail)
+	}
+	if len(payload.Authors) != 1 || payload.Authors[0].Name != "Alice" {
+		t.Fatalf("Authors = %+v", payload.Authors)
+	}
+	if want := time.Date(2026, 4, 29, 13, 0, 0, 0, time.UTC); !payload.UpdatedAt.Equal(want) {
+		t.Fatalf("UpdatedAt = %s, want %s", payload.UpdatedAt, want)
+	}
+}
+
+func TestNewPayloadFromRSSWithEnclosures(t *testing.T) {
+	feed, err := gofeed.NewParser().Parse(strings.NewReader(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+<title>Podcast</title>
+<link>https://example.com/</link>
+<image><url>https://example.com/logo.png</url><title>Podcast</title><link>https://example.com/</link></image>
+<item>
+<title>Episode 1</title>
+<link>https://example.com/1</link>
+<guid>episode-1</guid>
+<category>news</category>
+<description>Summary</description>
+<pubDate>Wed, 29 Apr 2026 12:00:00 GMT</pubDate>
+<enclosure url="https://example.com/1.mp3" type="audio/mpeg" length="1234"/>
+<itunes:image href="https://example.com/1.jpg"/>
+</item>
+</channel>
+</rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := itemsWithPublishedTime(feed.Items)
+	payload := newPayload(feed, items[0])
+	if payload.FeedImage != "https://example.com/logo.png" || payload.ItemGUID != "episode-1" || payload.Description != "Summary" {
+		t.Fatalf("payload fields = %+v", payload)
+	}
+	if len(payload.Categories) != 1 || payload.Categories[0] != "news" {
+		t.Fatalf("Categories = %v", payload.Categories)
+	}
+	if len(payload.Enclosures) != 1 || payload.Enclosures[0].Length != 1234 || payload.Enclosures[0].Type != "audio/mpeg" {
+		t.Fatalf("Enclosures = %+v", payload.Enclosures)
+	}
+	if payload.Thumbnail != "https://example.com/1.jpg" {
+		t.Fatalf("Thumbnail = %q, want itunes:image", payload.Thumbnail)
+	}
+}
@@ -0,0 +1,108 @@
+package feed
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// hostLimiter keeps feed fetches polite towards each host: at most perHost
+// requests in flight and at least delay between request starts. Zero
+// values disable the respective limit.
+type hostLimiter struct {
+	perHost int
+	delay   time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlot
+}
+
+type hostSlot struct {
+	sem  chan struct{}
+	next time.Time
+}
+
+func newHostLimiter(perHost int, delay time.Duration) *hostLimiter {
+	return &hostLimiter{
+		perHost: perHost,
+		delay:   delay,
+		hosts:   make(map[string]*hostSlot),
+	}
+}
+
+// acquire blocks until a request to host may start. The returned release
+// must be called once the request has finished.
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	l.mu.Lock()
+	slot, ok := l.hosts[host]
+	if !ok {
+		slot = &hostSlot{}
+		if l.perHost > 0 {
+			slot.sem = make(chan struct{}, l.perHost)
+		}
+		l.hosts[host] = slot
+	}
+	l.mu.Unlock()
+
+	release := func() {}
+	if slot.sem != nil {
+		select {
+		case slot.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		release = func() { <-slot.sem }
+	}
+
+	if l.delay > 0 {
+		// Reserve the next start time, then wait for it outside the lock.
+		l.mu.Lock()
+		now := time.Now()
+		start := slot.next
+		if start.Before(now) {
+			start = now
+		}
+		slot.next = start.Add(l.delay)
+		l.mu.Unlock()
+
+		if err := sleepCtx(ctx, start.Sub(now)); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
+}
+
+// jitterOffset spreads feeds deterministically over [0, jitter) so that
+// each feed keeps a stable slot within the interval.
+func jitterOffset(feedKey string, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(xxhash.Sum64String(feedKey) % uint64(jitter))
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
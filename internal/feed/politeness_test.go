@@ -0,0 +1,100 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestRunOnceLimitsConcurrentFetchesPerHost(t *testing.T) {
+	var inFlight, maxInFlight, requests atomic.Int64
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			prev := maxInFlight.Load()
+			if n <= prev || maxInFlight.CompareAndSwap(prev, n) {
+				break
+			}
+		}
+		requests.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{{Title: "old", PublishedAt: time.Now().Add(-time.Hour)}}))
+	}))
+	defer feedServer.Close()
+
+	fetcher := NewFetcher(state.NewMemoryStore(), webhook.NewClient(), nil, &config.FeedsConfig{
+		SkipInitialNotify:               true,
+		InitialWarmupStableObservations: 2,
+		Concurrency: config.ConcurrencyConfig{
+			MaxWorkers: 8,
+			PerHost:    2,
+		},
+	})
+
+	feeds := make([]config.Feed, 8)
+	for i := range feeds {
+		feeds[i] = config.Feed{URL: fmt.Sprintf("%s/feed/%d.xml", feedServer.URL, i)}
+	}
+	fetcher.runOnce(context.Background(), feeds)
+
+	if got := requests.Load(); got != int64(len(feeds)) {
+		t.Fatalf("requests = %d, want %d", got, len(feeds))
+	}
+	if got := maxInFlight.Load(); got > 2 {
+		t.Fatalf("max concurrent requests to one host = %d, want <= 2", got)
+	}
+}
+
+func TestHostLimiterSpacesRequestStarts(t *testing.T) {
+	limiter := newHostLimiter(0, 30*time.Millisecond)
+
+	start := time.Now()
+	for range 3 {
+		release, err := limiter.acquire(context.Background(), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Fatalf("three requests started within %s, want >= 60ms", elapsed)
+	}
+
+	// Other hosts are not delayed.
+	start = time.Now()
+	release, err := limiter.acquire(context.Background(), "other.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Fatalf("first request to another host waited %s", elapsed)
+	}
+}
+
+func TestJitterOffsetIsStableAndBounded(t *testing.T) {
+	jitter := time.Minute
+	for i := range 100 {
+		key := fmt.Sprintf("https://example.com/%d.xml", i)
+		offset := jitterOffset(key, jitter)
+		if offset < 0 || offset >= jitter {
+			t.Fatalf("offset for %s = %s, want within [0, %s)", key, offset, jitter)
+		}
+		if again := jitterOffset(key, jitter); again != offset {
+			t.Fatalf("offset for %s changed from %s to %s", key, offset, again)
+		}
+	}
+	if got := jitterOffset("https://example.com/rss.xml", 0); got != 0 {
+		t.Fatalf("offset without jitter = %s, want 0", got)
+	}
+}
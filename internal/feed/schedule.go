@@ -0,0 +1,262 @@
+package feed
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"github.com/mmcdole/gofeed/rss"
+
+	"rss-fetcher/internal/state"
+)
+
+// maxItemHistory is how many recent publish times are kept per feed to
+// learn its posting cadence.
+const maxItemHistory = 20
+
+// feedHints are the publisher's polling hints from the feed document and
+// the HTTP response.
+type feedHints struct {
+	// minInterval is the longest of RSS <ttl>, sy:updatePeriod divided by
+	// sy:updateFrequency, and the HTTP freshness lifetime.
+	minInterval time.Duration
+	skipHours   map[int]bool // RSS <skipHours>, in GMT
+	skipDays    map[time.Weekday]bool
+	// hub and self are the advertised WebSub hub and topic URLs.
+	hub  string
+	self string
+}
+
+// parseHints reads the hints of feed, fetched from base with header.
+func parseHints(feed *gofeed.Feed, header http.Header, base *url.URL, now time.Time) feedHints {
+	hints := feedHints{}
+	raise := func(d time.Duration) {
+		if d > hints.minInterval {
+			hints.minInterval = d
+		}
+	}
+
+	if original, ok := feed.OriginalFeed().(*rss.Feed); ok {
+		if ttl, err := strconv.Atoi(strings.TrimSpace(original.TTL)); err == nil && ttl > 0 {
+			raise(time.Duration(ttl) * time.Minute)
+		}
+		for _, h := range original.SkipHours {
+			if hour, err := strconv.Atoi(strings.TrimSpace(h)); err == nil && hour >= 0 && hour < 24 {
+				if hints.skipHours == nil {
+					hints.skipHours = make(map[int]bool)
+				}
+				hints.skipHours[hour] = true
+			}
+		}
+		for _, d := range original.SkipDays {
+			if day, ok := parseWeekday(d); ok {
+				if hints.skipDays == nil {
+					hints.skipDays = make(map[time.Weekday]bool)
+				}
+				hints.skipDays[day] = true
+			}
+		}
+	}
+
+	if sy, ok := feed.Extensions["sy"]; ok {
+		period := syndicationPeriod(extensionValue(sy, "updatePeriod"))
+		frequency, err := strconv.Atoi(extensionValue(sy, "updateFrequency"))
+		if err != nil || frequency < 1 {
+			frequency = 1
+		}
+		if period > 0 {
+			raise(period / time.Duration(frequency))
+		}
+	}
+
+	raise(freshnessLifetime(header, now))
+	hints.hub, hints.self = discoverHub(feed, header, base)
+	return hints
+}
+
+func extensionValue(ext map[string][]ext.Extension, name string) string {
+	if values := ext[name]; len(values) > 0 {
+		return strings.TrimSpace(values[0].Value)
+	}
+	return ""
+}
+
+func syndicationPeriod(period string) time.Duration {
+	switch strings.ToLower(period) {
+	case "hourly":
+		return time.Hour
+	case "daily":
+		return 24 * time.Hour
+	case "weekly":
+		return 7 * 24 * time.Hour
+	case "monthly":
+		return 30 * 24 * time.Hour
+	case "yearly":
+		return 365 * 24 * time.Hour
+	}
+	return 0
+}
+
+// freshnessLifetime returns how long the response may be cached according
+// to Cache-Control max-age or, failing that, Expires.
+func freshnessLifetime(header http.Header, now time.Time) time.Duration {
+	if header == nil {
+		return 0
+	}
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds > 0 {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil && expires.After(now) {
+		return expires.Sub(now)
+	}
+	return 0
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(strings.TrimSpace(s), d.String()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// mergeHistory adds the publish times of items to history and keeps the
+// most recent maxItemHistory distinct times in ascending order.
+func mergeHistory(history []time.Time, items []*gofeed.Item) []time.Time {
+	merged := slices.Clone(history)
+	for _, item := range items {
+		merged = append(merged, item.PublishedParsed.UTC())
+	}
+	slices.SortFunc(merged, func(a, b time.Time) int { return a.Compare(b) })
+	merged = slices.CompactFunc(merged, func(a, b time.Time) bool { return a.Equal(b) })
+	if len(merged) > maxItemHistory {
+		merged = merged[len(merged)-maxItemHistory:]
+	}
+	return merged
+}
+
+// pollInterval picks how long to wait before polling a feed again. Feeds
+// are polled about twice per typical gap between posts; the longer a feed
+// has been silent, the further polling backs off. Publisher hints act as a
+// floor, and the result is clamped to [minInterval, maxInterval].
+func pollInterval(hints feedHints, history []time.Time, now time.Time, fallback, minInterval, maxInterval time.Duration) time.Duration {
+	interval := fallback
+	if len(history) >= 2 {
+		gaps := make([]time.Duration, 0, len(history)-1)
+		for i := 1; i < len(history); i++ {
+			gaps = append(gaps, history[i].Sub(history[i-1]))
+		}
+		slices.Sort(gaps)
+		interval = gaps[len(gaps)/2] / 2
+	}
+	if len(history) > 0 {
+		if idle := now.Sub(history[len(history)-1]) / 4; idle > interval {
+			interval = idle
+		}
+	}
+	if hints.minInterval > interval {
+		interval = hints.minInterval
+	}
+	return min(max(interval, minInterval), maxInterval)
+}
+
+// skipForward moves t out of the hours and days the publisher asked
+// clients to skip.
+func skipForward(t time.Time, hints feedHints) time.Time {
+	if len(hints.skipHours) == 0 && len(hints.skipDays) == 0 {
+		return t
+	}
+	for range 24 * 7 {
+		gmt := t.UTC()
+		if !hints.skipHours[gmt.Hour()] && !hints.skipDays[gmt.Weekday()] {
+			return t
+		}
+		t = gmt.Truncate(time.Hour).Add(time.Hour)
+	}
+	// Every hour is skipped; ignore the hint rather than never polling.
+	return t
+}
+
+// pollResult is what a successful fetch observed about the feed.
+type pollResult struct {
+	hints   feedHints
+	history []time.Time
+	// resolvedURL is the feed URL discovered from the configured page, or
+	// empty if the configured URL is a feed itself.
+	resolvedURL string
+	// movedTo is where the configured URL permanently redirects, if it
+	// does.
+	movedTo string
+	// staleSince is when the feed was found stale, or zero.
+	staleSince time.Time
+	// fingerprints are the fingerprints of the fetched items.
+	fingerprints map[string]state.ItemFingerprint
+}
+
+// adaptiveScheduler tracks when each feed is next due in adaptive mode.
+// The schedule is kept in memory: after a restart every feed is polled
+// once, at its jitter offset, and rescheduled from its stored history.
+type adaptiveScheduler struct {
+	fallback    time.Duration
+	minInterval time.Duration
+	maxInterval time.Duration
+	jitter      time.Duration
+
+	mu      sync.Mutex
+	due     map[string]time.Time
+	started time.Time // First isDue call, which the jitter offsets count from
+}
+
+func newAdaptiveScheduler(fallback, minInterval, maxInterval, jitter time.Duration) *adaptiveScheduler {
+	return &adaptiveScheduler{
+		fallback:    fallback,
+		minInterval: minInterval,
+		maxInterval: maxInterval,
+		jitter:      jitter,
+		due:         make(map[string]time.Time),
+	}
+}
+
+func (s *adaptiveScheduler) isDue(feedKey string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started.IsZero() {
+		s.started = now
+	}
+	due, ok := s.due[feedKey]
+	if !ok {
+		due = s.started.Add(jitterOffset(feedKey, s.jitter))
+	}
+	return !now.Before(due)
+}
+
+// schedule records when feedKey is next due. A nil poll means the fetch
+// failed, in which case the feed is retried after the fallback interval.
+func (s *adaptiveScheduler) schedule(feedKey string, poll *pollResult, now time.Time) time.Time {
+	var next time.Time
+	if poll == nil {
+		next = now.Add(min(max(s.fallback, s.minInterval), s.maxInterval))
+	} else {
+		next = skipForward(now.Add(pollInterval(poll.hints, poll.history, now, s.fallback, s.minInterval, s.maxInterval)), poll.hints)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.due[feedKey] = next
+	return next
+}
@@ -0,0 +1,142 @@
+package feed
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestParseHintsReadsFeedAndHTTPHints(t *testing.T) {
+	parser := gofeed.NewParser()
+	parser.KeepOriginalFeed = true
+	feed, err := parser.Parse(strings.NewReader(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+<channel>
+<title>Example</title>
+<ttl>30</ttl>
+<sy:updatePeriod>daily</sy:updatePeriod>
+<sy:updateFrequency>24</sy:updateFrequency>
+<skipHours><hour>0</hour><hour>1</hour></skipHours>
+<skipDays><day>Sunday</day></skipDays>
+</channel>
+</rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+	hints := parseHints(feed, http.Header{"Cache-Control": {"public, max-age=600"}}, nil, now)
+	if hints.minInterval != time.Hour {
+		t.Fatalf("minInterval = %s, want 1h from sy:updatePeriod/updateFrequency", hints.minInterval)
+	}
+	if !hints.skipHours[0] || !hints.skipHours[1] || hints.skipHours[2] {
+		t.Fatalf("skipHours = %v, want 0 and 1", hints.skipHours)
+	}
+	if !hints.skipDays[time.Sunday] || len(hints.skipDays) != 1 {
+		t.Fatalf("skipDays = %v, want Sunday", hints.skipDays)
+	}
+
+	hints = parseHints(&gofeed.Feed{}, http.Header{"Expires": {now.Add(2 * time.Hour).Format(http.TimeFormat)}}, nil, now)
+	if hints.minInterval != 2*time.Hour {
+		t.Fatalf("minInterval = %s, want 2h from Expires", hints.minInterval)
+	}
+}
+
+func TestPollIntervalFollowsCadenceWithinBounds(t *testing.T) {
+	now := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+	hourly := []time.Time{now.Add(-3 * time.Hour), now.Add(-2 * time.Hour), now.Add(-time.Hour)}
+
+	if got := pollInterval(feedHints{}, hourly, now, 10*time.Minute, time.Minute, 24*time.Hour); got != 30*time.Minute {
+		t.Fatalf("interval for hourly feed = %s, want 30m", got)
+	}
+	if got := pollInterval(feedHints{minInterval: 2 * time.Hour}, hourly, now, 10*time.Minute, time.Minute, 24*time.Hour); got != 2*time.Hour {
+		t.Fatalf("interval with 2h hint = %s, want 2h", got)
+	}
+	if got := pollInterval(feedHints{}, hourly, now, 10*time.Minute, time.Hour, 24*time.Hour); got != time.Hour {
+		t.Fatalf("interval below min = %s, want min 1h", got)
+	}
+
+	dormant := []time.Time{now.Add(-100 * 24 * time.Hour), now.Add(-99 * 24 * time.Hour)}
+	if got := pollInterval(feedHints{}, dormant, now, 10*time.Minute, time.Minute, 24*time.Hour); got != 24*time.Hour {
+		t.Fatalf("interval for dormant feed = %s, want max 24h", got)
+	}
+
+	if got := pollInterval(feedHints{}, nil, now, 10*time.Minute, time.Minute, 24*time.Hour); got != 10*time.Minute {
+		t.Fatalf("interval without history = %s, want fallback 10m", got)
+	}
+}
+
+func TestSkipForwardLeavesSkippedHoursAndDays(t *testing.T) {
+	hints := feedHints{
+		skipHours: map[int]bool{0: true, 1: true},
+		skipDays:  map[time.Weekday]bool{time.Sunday: true},
+	}
+
+	// Sunday is skipped entirely, and so are the first two hours of Monday.
+	got := skipForward(time.Date(2026, 5, 3, 9, 30, 0, 0, time.UTC), hints)
+	if want := time.Date(2026, 5, 4, 2, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("skipForward = %s, want %s", got, want)
+	}
+
+	allowed := time.Date(2026, 5, 4, 12, 15, 0, 0, time.UTC)
+	if got := skipForward(allowed, hints); !got.Equal(allowed) {
+		t.Fatalf("skipForward of allowed time = %s, want unchanged", got)
+	}
+}
+
+func TestMergeHistoryKeepsRecentDistinctTimes(t *testing.T) {
+	base := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+	var history []time.Time
+	for i := range maxItemHistory {
+		history = append(history, base.Add(time.Duration(i)*time.Hour))
+	}
+	newest := base.Add(100 * time.Hour)
+	duplicate := history[len(history)-1]
+
+	got := mergeHistory(history, []*gofeed.Item{{PublishedParsed: &newest}, {PublishedParsed: &duplicate}})
+	if len(got) != maxItemHistory {
+		t.Fatalf("history length = %d, want %d", len(got), maxItemHistory)
+	}
+	if !got[0].Equal(history[1]) || !got[len(got)-1].Equal(newest) {
+		t.Fatalf("history = %v..%v, want oldest dropped and newest appended", got[0], got[len(got)-1])
+	}
+}
+
+func TestAdaptiveSchedulerOnlyPollsDueFeeds(t *testing.T) {
+	s := newAdaptiveScheduler(10*time.Minute, 5*time.Minute, time.Hour, 0)
+	now := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+
+	if !s.isDue("https://example.com/rss.xml", now) {
+		t.Fatal("unscheduled feed is not due")
+	}
+	next := s.schedule("https://example.com/rss.xml", nil, now)
+	if want := now.Add(10 * time.Minute); !next.Equal(want) {
+		t.Fatalf("next poll after failure = %s, want fallback %s", next, want)
+	}
+	if s.isDue("https://example.com/rss.xml", now.Add(5*time.Minute)) {
+		t.Fatal("feed is due before its scheduled time")
+	}
+	if !s.isDue("https://example.com/rss.xml", next) {
+		t.Fatal("feed is not due at its scheduled time")
+	}
+}
+
+func TestAdaptiveSchedulerOffsetsFirstPollsByJitter(t *testing.T) {
+	s := newAdaptiveScheduler(10*time.Minute, 5*time.Minute, time.Hour, 4*time.Minute)
+	now := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+	feedKey := "https://example.com/rss.xml"
+	offset := jitterOffset(feedKey, 4*time.Minute)
+	if offset == 0 {
+		t.Fatal("test feed has no jitter offset")
+	}
+
+	if s.isDue(feedKey, now) {
+		t.Fatal("feed is due before its jitter offset")
+	}
+	if !s.isDue(feedKey, now.Add(offset)) {
+		t.Fatal("feed is not due at its jitter offset")
+	}
+}
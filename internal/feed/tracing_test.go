@@ -0,0 +1,77 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestProcessFeedTracesDeliveryAndPropagatesContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	baseline := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{{Title: "traced", PublishedAt: baseline.Add(time.Minute)}}))
+	}))
+	defer feedServer.Close()
+
+	traceparent := make(chan string, 1)
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent <- r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	store := state.NewMemoryStore()
+	if err := store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(baseline)); err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewFetcher(store, webhook.NewClient(), []config.Webhook{{Name: "traced", URL: webhookServer.URL}}, &config.FeedsConfig{})
+	fetcher.runOnce(context.Background(), []config.Feed{{Name: "traced", URL: feedServer.URL}})
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{"rss.cycle", "rss.process_feed", "rss.fetch", "state.get", "rss.deliver_item", "webhook.send", "state.compare_and_set"} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("missing span %q", name)
+		}
+	}
+	send, ok := spans["webhook.send"]
+	if !ok {
+		t.FailNow()
+	}
+	if send.Parent().SpanID() != spans["rss.deliver_item"].SpanContext().SpanID() {
+		t.Errorf("webhook.send is not a child of rss.deliver_item")
+	}
+	if send.SpanContext().TraceID() != spans["rss.cycle"].SpanContext().TraceID() {
+		t.Errorf("webhook.send is not part of the cycle's trace")
+	}
+
+	header := <-traceparent
+	if !strings.Contains(header, send.SpanContext().TraceID().String()) || !strings.Contains(header, send.SpanContext().SpanID().String()) {
+		t.Fatalf("traceparent = %q, want trace %s span %s", header, send.SpanContext().TraceID(), send.SpanContext().SpanID())
+	}
+}
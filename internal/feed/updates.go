@@ -0,0 +1,131 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/mmcdole/gofeed"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+// itemID identifies item within its feed.
+func itemID(item *gofeed.Item) string {
+	id := item.GUID
+	if id == "" {
+		id = item.Link
+	}
+	if id == "" {
+		id = item.Title + "@" + item.PublishedParsed.UTC().Format(time.RFC3339Nano)
+	}
+	return id
+}
+
+// itemFingerprint hashes the parts of item a notification is about.
+func itemFingerprint(item *gofeed.Item) string {
+	h := xxhash.New()
+	for _, part := range []string{item.Title, item.Link, item.Description, item.Content, item.Updated} {
+		h.WriteString(part)
+		h.WriteString("\x00")
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// itemUpdate is a seen item whose fingerprint changed.
+type itemUpdate struct {
+	id       string
+	item     *gofeed.Item
+	previous state.ItemFingerprint
+}
+
+// trackItems returns the fingerprints to store and the items that changed.
+func trackItems(stored map[string]state.ItemFingerprint, items []*gofeed.Item, pushed bool) (map[string]state.ItemFingerprint, []itemUpdate) {
+	if len(items) == 0 {
+		if pushed {
+			return stored, nil
+		}
+		return nil, nil
+	}
+	fingerprints := make(map[string]state.ItemFingerprint, len(items))
+	// Pushed content may carry only the changed entries.
+	if pushed {
+		maps.Copy(fingerprints, stored)
+	}
+	var updates []itemUpdate
+	for _, item := range items {
+		id := itemID(item)
+		fp := state.ItemFingerprint{Hash: itemFingerprint(item), Title: item.Title}
+		if previous, ok := stored[id]; ok {
+			fp.Updates = previous.Updates
+			if previous.Hash != fp.Hash {
+				updates = append(updates, itemUpdate{id: id, item: item, previous: previous})
+			}
+		}
+		fingerprints[id] = fp
+	}
+	return fingerprints, updates
+}
+
+// notifiesUpdates reports whether changed items of feedConfig are notified.
+func (f *Fetcher) notifiesUpdates(feedConfig config.Feed) bool {
+	return f.notifyOnUpdate || feedConfig.NotifyOnUpdate
+}
+
+// notifyUpdates notifies updated items within the per-item and per-run caps.
+func (f *Fetcher) notifyUpdates(ctx context.Context, feedConfig config.Feed, logger *slog.Logger, feed *gofeed.Feed, updates []itemUpdate, poll *pollResult) {
+	if len(updates) == 0 {
+		return
+	}
+	feedLabel := f.metricLabel(feedConfig)
+	metricItemUpdates.WithLabelValues(feedLabel).Add(float64(len(updates)))
+	if !f.notifiesUpdates(feedConfig) {
+		logger.Debug("Items updated", "count", len(updates))
+		return
+	}
+	if f.maxNotificationsPerFeedPerRun > 0 && len(updates) > f.maxNotificationsPerFeedPerRun {
+		metricFilteredItems.WithLabelValues(feedLabel, "update_burst").Add(float64(len(updates)))
+		logger.Warn("Too many updated items; recorded without notifying", "count", len(updates), "limit", f.maxNotificationsPerFeedPerRun)
+		return
+	}
+
+	// Oldest first, like new items.
+	slices.SortFunc(updates, func(a, b itemUpdate) int { return a.item.PublishedParsed.Compare(*b.item.PublishedParsed) })
+	held := make(heldLookup)
+	for i, update := range updates {
+		fp := poll.fingerprints[update.id]
+		if f.maxUpdatesPerItem > 0 && fp.Updates >= f.maxUpdatesPerItem {
+			metricFilteredItems.WithLabelValues(feedLabel, "update_cap").Inc()
+			logger.Info("Item update not notified; per-item limit reached", "title", update.item.Title, "limit", f.maxUpdatesPerItem)
+			continue
+		}
+		payload := newPayload(feed, update.item)
+		payload.Event = webhook.EventUpdated
+		if update.previous.Title != update.item.Title {
+			payload.PreviousTitle = update.previous.Title
+		}
+		for _, wh := range f.webhooks {
+			id := queuedItemID(feedConfig.Key(), update.item) + " " + webhook.EventUpdated
+			if err := f.deliver(ctx, logger, wh, id, payload, time.Now(), held); err != nil {
+				logger.Error("Failed to post webhook", "name", wh.Name, "item", update.item.Title, "error", err)
+			}
+		}
+		// Updates whose delivery may have been interrupted keep their old
+		// fingerprint, so that they are detected again on the next run.
+		if ctx.Err() != nil {
+			for _, pending := range updates[i:] {
+				poll.fingerprints[pending.id] = pending.previous
+			}
+			return
+		}
+		fp.Updates++
+		poll.fingerprints[update.id] = fp
+		logger.Info("Notified updated item", "title", update.item.Title, "previous_title", payload.PreviousTitle)
+	}
+}
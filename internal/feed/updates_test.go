@@ -0,0 +1,146 @@
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/webhook"
+)
+
+func TestUpdatedItemsAreNotifiedUpToPerItemCap(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		global      bool
+		feed        bool
+		wantUpdates int
+	}{
+		{name: "disabled"},
+		{name: "global", global: true, wantUpdates: 1},
+		{name: "per feed", feed: true, wantUpdates: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			published := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+			var mu sync.Mutex
+			title := "first"
+			feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				w.Header().Set("Content-Type", "application/rss+xml")
+				fmt.Fprint(w, rssFeed([]rssItem{{Title: title, PublishedAt: published}}))
+			}))
+			defer feedServer.Close()
+			setTitle := func(s string) {
+				mu.Lock()
+				defer mu.Unlock()
+				title = s
+			}
+
+			var received []webhook.Payload
+			webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var payload webhook.Payload
+				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+					t.Errorf("decode payload: %v", err)
+				}
+				mu.Lock()
+				received = append(received, payload)
+				mu.Unlock()
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer webhookServer.Close()
+
+			store := state.NewMemoryStore()
+			if err := store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(published)); err != nil {
+				t.Fatal(err)
+			}
+			fetcher := NewFetcher(store, webhook.NewClient(), []config.Webhook{{Name: "test", URL: webhookServer.URL}}, &config.FeedsConfig{
+				InitialWarmupStableObservations: 2,
+				MaxNotificationsPerFeedPerRun:   10,
+				NotifyOnUpdate:                  tc.global,
+				MaxUpdateNotificationsPerItem:   1,
+			})
+			feedConfig := config.Feed{URL: feedServer.URL, NotifyOnUpdate: tc.feed}
+
+			// The first run only records what the item looks like.
+			fetcher.ProcessFeed(context.Background(), feedConfig)
+			setTitle("second")
+			fetcher.ProcessFeed(context.Background(), feedConfig)
+			// Over the cap, the update is recorded without a notification.
+			setTitle("third")
+			fetcher.ProcessFeed(context.Background(), feedConfig)
+
+			if len(received) != tc.wantUpdates {
+				t.Fatalf("notifications = %+v, want %d", received, tc.wantUpdates)
+			}
+			if tc.wantUpdates > 0 {
+				got := received[0]
+				if got.Event != webhook.EventUpdated || got.ItemTitle != "second" || got.PreviousTitle != "first" {
+					t.Fatalf("update payload = %+v, want event updated from first to second", got)
+				}
+			}
+			st, err := store.GetFeedState(context.Background(), feedServer.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fp := st.Fingerprints["https://example.com/0"]; fp.Title != "third" || fp.Updates != tc.wantUpdates {
+				t.Fatalf("stored fingerprint = %+v, want title third with %d updates", fp, tc.wantUpdates)
+			}
+		})
+	}
+}
+
+func TestPushedEntryKeepsFingerprintsOfOtherItems(t *testing.T) {
+	published := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	var mu sync.Mutex
+	titles := []string{"a", "b"}
+	feedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, rssFeed([]rssItem{{Title: titles[0], PublishedAt: published}, {Title: titles[1], PublishedAt: published}}))
+	}))
+	defer feedServer.Close()
+
+	var received []webhook.Payload
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload webhook.Payload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer webhookServer.Close()
+
+	store := state.NewMemoryStore()
+	if err := store.SetFeedState(context.Background(), feedServer.URL, state.NewReadyState(published)); err != nil {
+		t.Fatal(err)
+	}
+	fetcher := NewFetcher(store, webhook.NewClient(), []config.Webhook{{Name: "test", URL: webhookServer.URL}}, &config.FeedsConfig{
+		InitialWarmupStableObservations: 2,
+		MaxNotificationsPerFeedPerRun:   10,
+		NotifyOnUpdate:                  true,
+	})
+	feedConfig := config.Feed{URL: feedServer.URL}
+
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+	// Hubs often push only the entry that changed.
+	fetcher.ProcessPushedFeed(context.Background(), feedConfig, []byte(rssFeed([]rssItem{{Title: "a", PublishedAt: published}})))
+	mu.Lock()
+	titles[1] = "b edited"
+	mu.Unlock()
+	fetcher.ProcessFeed(context.Background(), feedConfig)
+
+	if len(received) != 1 || received[0].ItemTitle != "b edited" || received[0].PreviousTitle != "b" {
+		t.Fatalf("notifications = %+v, want the update of b", received)
+	}
+}
@@ -0,0 +1,61 @@
+package feed
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
+)
+
+// discoverHub returns the WebSub hub and self URLs a feed advertises, from
+// HTTP Link headers, Atom <link> elements or atom:link elements in RSS,
+// resolved against base, the URL the feed was fetched from. Headers take
+// precedence, as recommended by the WebSub specification.
+func discoverHub(feed *gofeed.Feed, header http.Header, base *url.URL) (hub, self string) {
+	set := func(rel, href string) {
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if err != nil || ref.String() == "" {
+			return
+		}
+		if base != nil {
+			ref = base.ResolveReference(ref)
+		}
+		href = ref.String()
+		for _, r := range strings.Fields(strings.ToLower(rel)) {
+			switch {
+			case r == "hub" && hub == "":
+				hub = href
+			case r == "self" && self == "":
+				self = href
+			}
+		}
+	}
+
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			target, params, _ := strings.Cut(link, ";")
+			target = strings.TrimSpace(target)
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range strings.Split(params, ";") {
+				name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(name, "rel") {
+					set(strings.Trim(value, `"`), strings.Trim(target, "<>"))
+				}
+			}
+		}
+	}
+
+	if original, ok := feed.OriginalFeed().(*atom.Feed); ok {
+		for _, link := range original.Links {
+			set(link.Rel, link.Href)
+		}
+	}
+	for _, link := range feed.Extensions["atom"]["link"] {
+		set(link.Attrs["rel"], link.Attrs["href"])
+	}
+	return hub, self
+}
@@ -0,0 +1,74 @@
+package feed
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestDiscoverHubFromHeadersAndFeedLinks(t *testing.T) {
+	parser := gofeed.NewParser()
+	parser.KeepOriginalFeed = true
+
+	rssDoc, err := parser.Parse(strings.NewReader(`<?xml version="1.0"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+<title>Example</title>
+<atom:link rel="hub" href="https://hub.example.com/"/>
+<atom:link rel="self" href="https://example.com/rss.xml"/>
+</channel>
+</rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hub, self := discoverHub(rssDoc, nil, nil); hub != "https://hub.example.com/" || self != "https://example.com/rss.xml" {
+		t.Fatalf("RSS discoverHub = %q, %q", hub, self)
+	}
+
+	atomDoc, err := parser.Parse(strings.NewReader(`<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<title>Example</title>
+<link rel="hub" href="https://pubsubhubbub.appspot.com"/>
+<link rel="self" href="https://example.com/atom.xml"/>
+</feed>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{"Link": {`<https://header-hub.example.com/>; rel="hub", <https://example.com/canonical.xml>; rel="self"`}}
+	if hub, self := discoverHub(atomDoc, header, nil); hub != "https://header-hub.example.com/" || self != "https://example.com/canonical.xml" {
+		t.Fatalf("Atom discoverHub with Link header = %q, %q", hub, self)
+	}
+	if hub, _ := discoverHub(atomDoc, nil, nil); hub != "https://pubsubhubbub.appspot.com" {
+		t.Fatalf("Atom discoverHub = %q", hub)
+	}
+}
+
+func TestDiscoverHubResolvesRelativeLinks(t *testing.T) {
+	parser := gofeed.NewParser()
+	parser.KeepOriginalFeed = true
+
+	doc, err := parser.Parse(strings.NewReader(`<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<title>Example</title>
+<link rel="hub" href="/websub"/>
+<link rel="self" href="atom.xml"/>
+</feed>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := url.Parse("https://example.com/feeds/index.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hub, self := discoverHub(doc, nil, base); hub != "https://example.com/websub" || self != "https://example.com/feeds/atom.xml" {
+		t.Fatalf("discoverHub = %q, %q", hub, self)
+	}
+
+	header := http.Header{"Link": {`<../hub>; rel="hub"`}}
+	if hub, _ := discoverHub(doc, header, base); hub != "https://example.com/hub" {
+		t.Fatalf("discoverHub with Link header = %q", hub)
+	}
+}
@@ -0,0 +1,144 @@
+// Package logging builds the server's logger from the log config. The
+// level is held in a slog.LevelVar so it can be changed while running, and
+// single loggers can be made verbose for feeds marked debug.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+
+	"rss-fetcher/internal/config"
+)
+
+// Logger is the server's logger together with its adjustable level.
+type Logger struct {
+	*slog.Logger
+	level *slog.LevelVar
+
+	mu         sync.Mutex
+	configured slog.Level
+}
+
+// New returns a logger writing to w as cfg describes. cfg is expected to
+// have passed config validation.
+func New(cfg config.LogConfig, w io.Writer) (*Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("log.level: %w", err)
+	}
+	// The inner handler passes everything; levelHandler does the filtering
+	// so that verbose loggers can lower it.
+	opts := &slog.HandlerOptions{Level: slog.Level(-128)}
+	var inner slog.Handler
+	switch cfg.Format {
+	case "json", "":
+		inner = slog.NewJSONHandler(w, opts)
+	case "text", "logfmt":
+		// slog's text handler writes logfmt.
+		inner = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log.format %q", cfg.Format)
+	}
+	levelVar := new(slog.LevelVar)
+	levelVar.Set(level)
+	return &Logger{
+		Logger:     slog.New(&levelHandler{inner: inner, level: levelVar}),
+		level:      levelVar,
+		configured: level,
+	}, nil
+}
+
+// Level returns the current level.
+func (l *Logger) Level() slog.Level {
+	return l.level.Level()
+}
+
+// SetLevel changes the level of l and of every logger derived from it.
+func (l *Logger) SetLevel(level slog.Level) {
+	l.level.Set(level)
+	l.Info("Log level changed", "level", level)
+}
+
+// ToggleDebug switches between the debug level and the configured level.
+func (l *Logger) ToggleDebug() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.level.Level() > slog.LevelDebug {
+		l.SetLevel(slog.LevelDebug)
+	} else {
+		l.SetLevel(l.configured)
+	}
+}
+
+// Verbose returns logger with debug logs enabled regardless of the current
+// level. Loggers not built by New are returned unchanged.
+func Verbose(logger *slog.Logger) *slog.Logger {
+	h, ok := logger.Handler().(*levelHandler)
+	if !ok {
+		return logger
+	}
+	return slog.New(&levelHandler{inner: h.inner, level: minLevel{h.level, slog.LevelDebug}})
+}
+
+// ServeHTTP reports the current level on GET and sets it on PUT or POST,
+// with the level name ("debug", "info", ...) as the request body.
+func (l *Logger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		body, err := io.ReadAll(io.LimitReader(r.Body, 64))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(strings.TrimSpace(string(body)))); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		l.SetLevel(level)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, strings.ToLower(l.Level().String()))
+}
+
+// levelHandler filters records below level before passing them on.
+type levelHandler struct {
+	inner slog.Handler
+	level slog.Leveler
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{inner: h.inner.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{inner: h.inner.WithGroup(name), level: h.level}
+}
+
+// minLevel is the lower of a changing level and a fixed one.
+type minLevel struct {
+	level slog.Leveler
+	min   slog.Level
+}
+
+func (m minLevel) Level() slog.Level {
+	return min(m.level.Level(), m.min)
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rss-fetcher/internal/config"
+)
+
+func TestVerboseLoggerLogsDebugBelowLevel(t *testing.T) {
+	var out bytes.Buffer
+	l, err := New(config.LogConfig{Level: "info", Format: "logfmt"}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feedLogger := l.With("feed", "quiet")
+	debugLogger := Verbose(l.With("feed", "noisy"))
+
+	feedLogger.Debug("hidden")
+	debugLogger.Debug("shown")
+	if got := out.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "msg=shown feed=noisy") {
+		t.Fatalf("output = %q, want only the verbose logger's debug line", got)
+	}
+
+	out.Reset()
+	l.SetLevel(slog.LevelError)
+	debugLogger.Info("still shown")
+	feedLogger.Warn("now hidden")
+	if got := out.String(); !strings.Contains(got, "still shown") || strings.Contains(got, "now hidden") {
+		t.Fatalf("output = %q after raising the level", got)
+	}
+}
+
+func TestLevelEndpointAndToggle(t *testing.T) {
+	l, err := New(config.LogConfig{Level: "warn", Format: "json"}, &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/log/level", strings.NewReader("debug\n")))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "debug" {
+		t.Fatalf("PUT = %d %q", rec.Code, rec.Body.String())
+	}
+	if !l.Enabled(t.Context(), slog.LevelDebug) {
+		t.Fatal("debug not enabled after PUT")
+	}
+
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/admin/log/level", strings.NewReader("loud")))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("PUT of unknown level = %d, want 400", rec.Code)
+	}
+
+	l.ToggleDebug()
+	if got := l.Level(); got != slog.LevelWarn {
+		t.Fatalf("level after toggling from debug = %s, want the configured WARN", got)
+	}
+	l.ToggleDebug()
+	if got := l.Level(); got != slog.LevelDebug {
+		t.Fatalf("level after toggling again = %s, want DEBUG", got)
+	}
+}
@@ -0,0 +1,177 @@
+// Package netpolicy keeps outgoing requests away from internal networks.
+package netpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"rss-fetcher/internal/config"
+)
+
+// ErrBlocked is wrapped by dial errors for addresses the policy refuses.
+var ErrBlocked = errors.New("address blocked by network policy")
+
+var metricBlocked = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "rss_network_policy_blocked_total",
+	Help: "Connections refused by the network policy",
+})
+
+// blockedPrefixes are ranges refused on top of loopback, private,
+// link-local, multicast and unspecified addresses.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"), // Shared address space, incl. some cloud metadata services
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments, incl. some cloud metadata services
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("fec0::/10"),     // Deprecated site-local
+}
+
+// nat64Prefix embeds IPv4 addresses, which are checked in turn.
+var nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// Policy refuses connections to internal addresses. Addresses are checked
+// when connecting, after DNS resolution, so a name cannot be rebound to an
+// internal address between a check and its use. A nil *Policy allows
+// everything.
+type Policy struct {
+	allowPrefixes []netip.Prefix
+	allowHosts    map[string]bool
+	dialer        *net.Dialer
+}
+
+// New returns the policy described by cfg, or nil if it is disabled.
+func New(cfg config.NetworkPolicyConfig) (*Policy, error) {
+	if !cfg.BlockPrivate {
+		return nil, nil
+	}
+	p := &Policy{
+		allowHosts: make(map[string]bool),
+		dialer:     &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+	}
+	for _, entry := range cfg.Allow {
+		entry = strings.TrimSpace(entry)
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			p.allowPrefixes = append(p.allowPrefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			p.allowPrefixes = append(p.allowPrefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else if entry != "" && !strings.ContainsAny(entry, "/ ") {
+			p.allowHosts[normalizeHost(entry)] = true
+		} else {
+			return nil, fmt.Errorf("invalid network policy allow entry %q: must be a CIDR, IP address or host name", entry)
+		}
+	}
+	return p, nil
+}
+
+// Apply makes t dial through the policy. Requests that t sends through a
+// proxy are checked by destination host before they reach the proxy, which
+// resolves and connects on its own.
+func (p *Policy) Apply(t *http.Transport) {
+	if p == nil {
+		return
+	}
+	t.DialContext = p.DialContext
+	if proxy := t.Proxy; proxy != nil {
+		t.Proxy = func(req *http.Request) (*url.URL, error) {
+			proxyURL, err := proxy(req)
+			if err != nil || proxyURL == nil {
+				return proxyURL, err
+			}
+			if err := p.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+				return nil, err
+			}
+			return proxyURL, nil
+		}
+	}
+}
+
+// checkHost fails with ErrBlocked unless host is allowlisted or all of its
+// addresses are allowed. Unlike DialContext, this check precedes the
+// connection, so a name could still be rebound in between.
+func (p *Policy) checkHost(ctx context.Context, host string) error {
+	if p.allowHosts[normalizeHost(host)] {
+		return nil
+	}
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else if addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host); err != nil {
+		metricBlocked.Inc()
+		return fmt.Errorf("%w: cannot resolve %s to check it: %w", ErrBlocked, host, err)
+	}
+	for _, addr := range addrs {
+		if !p.Allowed(addr) {
+			metricBlocked.Inc()
+			return fmt.Errorf("%w: %s resolves to %s", ErrBlocked, host, addr)
+		}
+	}
+	return nil
+}
+
+// DialContext connects like net.Dialer.DialContext, failing with ErrBlocked
+// for refused addresses. Allowlisted host names are not checked.
+func (p *Policy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if p.allowHosts[normalizeHost(host)] {
+		return p.dialer.DialContext(ctx, network, address)
+	}
+
+	dialer := *p.dialer
+	dialer.ControlContext = func(_ context.Context, _, resolved string, _ syscall.RawConn) error {
+		ipPort, err := netip.ParseAddrPort(resolved)
+		if err != nil {
+			return err
+		}
+		if !p.Allowed(ipPort.Addr()) {
+			metricBlocked.Inc()
+			return fmt.Errorf("%w: %s resolves to %s", ErrBlocked, host, ipPort.Addr())
+		}
+		return nil
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// Allowed reports whether connections to addr are permitted.
+func (p *Policy) Allowed(addr netip.Addr) bool {
+	if p == nil {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.allowPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if nat64Prefix.Contains(addr) {
+		embedded := addr.As16()
+		return p.Allowed(netip.AddrFrom4([4]byte(embedded[12:])))
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,129 @@
+package netpolicy
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+
+	"rss-fetcher/internal/config"
+)
+
+func TestAllowedBlocksInternalAddresses(t *testing.T) {
+	policy, err := New(config.NetworkPolicyConfig{BlockPrivate: true, Allow: []string{"10.1.0.0/16", "192.168.0.10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, want := range map[string]bool{
+		"93.184.215.14":         true,
+		"2606:2800:21f:cb07::1": true,
+		"127.0.0.1":             false,
+		"::1":                   false,
+		"10.0.0.1":              false,
+		"172.16.5.4":            false,
+		"192.168.0.11":          false,
+		"169.254.169.254":       false,
+		"100.100.100.200":       false,
+		"0.0.0.0":               false,
+		"fd00:ec2::254":         false,
+		"fe80::1":               false,
+		"::ffff:127.0.0.1":      false,
+		"64:ff9b::a9fe:a9fe":    false, // NAT64 of 169.254.169.254
+		"10.1.2.3":              true,
+		"192.168.0.10":          true,
+		"::ffff:192.168.0.10":   true,
+		"64:ff9b::5db8:d70e":    true,
+	} {
+		if got := policy.Allowed(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Allowed(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestDialBlocksResolvedAddressUnlessAllowlisted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+
+	for _, tc := range []struct {
+		allow   []string
+		url     string
+		blocked bool
+	}{
+		{nil, server.URL, true},
+		// Names are checked after resolution.
+		{nil, "http://localhost" + port, true},
+		{[]string{"127.0.0.0/8"}, server.URL, false},
+		{[]string{"LOCALHOST."}, "http://localhost" + port, false},
+	} {
+		policy, err := New(config.NetworkPolicyConfig{BlockPrivate: true, Allow: tc.allow})
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		policy.Apply(transport)
+		resp, err := (&http.Client{Transport: transport}).Get(tc.url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if blocked := errors.Is(err, ErrBlocked); blocked != tc.blocked {
+			t.Fatalf("allow=%v url=%s: err = %v, want blocked=%v", tc.allow, tc.url, err, tc.blocked)
+		}
+	}
+}
+
+func TestNewRejectsInvalidAllowEntries(t *testing.T) {
+	if _, err := New(config.NetworkPolicyConfig{BlockPrivate: true, Allow: []string{"10.0.0.0/33"}}); err == nil {
+		t.Fatal("expected an error for an invalid CIDR")
+	}
+	policy, err := New(config.NetworkPolicyConfig{Allow: []string{"10.0.0.0/33"}})
+	if err != nil || policy != nil {
+		t.Fatalf("disabled policy = %v, %v; want nil, nil", policy, err)
+	}
+}
+
+func TestProxiedRequestsAreCheckedByDestination(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.Host)
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse("http://localhost" + proxy.URL[strings.LastIndex(proxy.URL, ":"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The proxy itself is allowlisted; its destinations are not.
+	policy, err := New(config.NetworkPolicyConfig{BlockPrivate: true, Allow: []string{"localhost"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	policy.Apply(transport)
+	client := &http.Client{Transport: transport}
+
+	for _, tc := range []struct {
+		url     string
+		blocked bool
+	}{
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://10.0.0.1/", true},
+		{"http://127.0.0.1/", true},
+		{"http://93.184.215.14/", false},
+	} {
+		resp, err := client.Get(tc.url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		if blocked := errors.Is(err, ErrBlocked); blocked != tc.blocked {
+			t.Fatalf("url=%s: err = %v, want blocked=%v", tc.url, err, tc.blocked)
+		}
+	}
+	if len(proxied) != 1 || proxied[0] != "93.184.215.14" {
+		t.Fatalf("proxied hosts = %v, want only the public one", proxied)
+	}
+}
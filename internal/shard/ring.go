@@ -0,0 +1,67 @@
+// Package shard splits feeds between replicas that share a Valkey store.
+package shard
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// virtualNodes is the number of ring points per member. More points give a
+// more even split at the cost of a larger ring.
+const virtualNodes = 128
+
+// Ring is an immutable consistent-hash ring. Adding or removing a member
+// only moves the keys adjacent to that member's points.
+type Ring struct {
+	points  []uint64
+	owners  map[uint64]string
+	members []string
+}
+
+func NewRing(members []string) *Ring {
+	r := &Ring{owners: make(map[uint64]string, len(members)*virtualNodes)}
+	for _, member := range members {
+		if slices.Contains(r.members, member) {
+			continue
+		}
+		r.members = append(r.members, member)
+		for i := range virtualNodes {
+			point := hash(member + "#" + strconv.Itoa(i))
+			// On the (unlikely) collision keep the smaller member name so
+			// that every replica builds the same ring.
+			if owner, ok := r.owners[point]; ok && owner < member {
+				continue
+			}
+			r.owners[point] = member
+		}
+	}
+	for point := range r.owners {
+		r.points = append(r.points, point)
+	}
+	slices.Sort(r.points)
+	slices.Sort(r.members)
+	return r
+}
+
+// Owner returns the member responsible for key, or "" if the ring is empty.
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := hash(key)
+	i, _ := slices.BinarySearch(r.points, h)
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func (r *Ring) Members() []string {
+	return slices.Clone(r.members)
+}
+
+func hash(s string) uint64 {
+	return xxhash.Sum64String(s)
+}
@@ -0,0 +1,131 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRingSpreadsKeysAndMovesFewOnJoin(t *testing.T) {
+	keys := make([]string, 3000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("https://example.com/feed/%d.xml", i)
+	}
+
+	before := NewRing([]string{"a", "b", "c"})
+	counts := map[string]int{}
+	for _, key := range keys {
+		counts[before.Owner(key)]++
+	}
+	for _, member := range []string{"a", "b", "c"} {
+		// An even split is 1000; allow generous variance.
+		if counts[member] < 600 || counts[member] > 1400 {
+			t.Fatalf("member %s owns %d of %d keys: %v", member, counts[member], len(keys), counts)
+		}
+	}
+
+	after := NewRing([]string{"c", "a", "b", "d"})
+	moved := 0
+	for _, key := range keys {
+		owner := after.Owner(key)
+		if owner != before.Owner(key) {
+			if owner != "d" {
+				t.Fatalf("key %s moved from %s to %s, want moves only to the new member", key, before.Owner(key), owner)
+			}
+			moved++
+		}
+	}
+	// Ideally a quarter of the keys move to the new member.
+	if moved < 400 || moved > 1200 {
+		t.Fatalf("moved %d of %d keys on join", moved, len(keys))
+	}
+}
+
+func TestRingIsIndependentOfMemberOrder(t *testing.T) {
+	a := NewRing([]string{"x", "y", "z"})
+	b := NewRing([]string{"z", "x", "y", "x"})
+	for i := range 100 {
+		key := fmt.Sprintf("key-%d", i)
+		if a.Owner(key) != b.Owner(key) {
+			t.Fatalf("owner of %s differs: %s vs %s", key, a.Owner(key), b.Owner(key))
+		}
+	}
+}
+
+func TestShardersPartitionKeysExactlyOnce(t *testing.T) {
+	membership := &fakeMembership{expires: map[string]time.Time{}}
+	replicas := []*Sharder{
+		NewSharder("r1", membership, time.Second, time.Minute),
+		NewSharder("r2", membership, time.Second, time.Minute),
+		NewSharder("r3", membership, time.Second, time.Minute),
+	}
+	// Two passes: the first replicas to register only see themselves.
+	for range 2 {
+		for _, s := range replicas {
+			if err := s.Refresh(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i := range 500 {
+		key := fmt.Sprintf("https://example.com/feed/%d.xml", i)
+		owners := 0
+		for _, s := range replicas {
+			if s.Owns(key) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("key %s has %d owners, want 1", key, owners)
+		}
+	}
+
+	if err := membership.Leave(context.Background(), "r3"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range replicas[:2] {
+		if err := s.Refresh(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 500 {
+		key := fmt.Sprintf("https://example.com/feed/%d.xml", i)
+		if replicas[0].Owns(key) == replicas[1].Owns(key) {
+			t.Fatalf("key %s not owned by exactly one remaining replica", key)
+		}
+	}
+}
+
+type fakeMembership struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func (m *fakeMembership) Heartbeat(ctx context.Context, replicaID string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expires[replicaID] = time.Now().Add(ttl)
+	return nil
+}
+
+func (m *fakeMembership) Replicas(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for id, exp := range m.expires {
+		if time.Now().Before(exp) {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+func (m *fakeMembership) Leave(ctx context.Context, replicaID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.expires, replicaID)
+	return nil
+}
@@ -0,0 +1,112 @@
+package shard
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var metricReplicas = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "rss_shard_replicas",
+	Help: "The number of live replicas sharing the feed list",
+})
+
+// Membership tracks which replicas are alive. A replica stays a member for
+// ttl after its last heartbeat.
+type Membership interface {
+	Heartbeat(ctx context.Context, replicaID string, ttl time.Duration) error
+	Replicas(ctx context.Context) ([]string, error)
+	Leave(ctx context.Context, replicaID string) error
+}
+
+// Sharder keeps this replica registered and decides which feeds it owns.
+// Ownership is only a work split: replicas may briefly disagree while
+// membership changes, and the store's per-feed locks and compare-and-set
+// writes keep a feed from being processed twice during that handoff.
+type Sharder struct {
+	id         string
+	membership Membership
+	interval   time.Duration
+	ttl        time.Duration
+
+	mu   sync.RWMutex
+	ring *Ring
+}
+
+func NewSharder(id string, membership Membership, interval, ttl time.Duration) *Sharder {
+	return &Sharder{
+		id:         id,
+		membership: membership,
+		interval:   interval,
+		ttl:        ttl,
+		ring:       NewRing([]string{id}),
+	}
+}
+
+func (s *Sharder) ID() string {
+	return s.id
+}
+
+// Owns reports whether this replica is responsible for the feed key.
+func (s *Sharder) Owns(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ring.Owner(key) == s.id
+}
+
+// Refresh sends a heartbeat and rebuilds the ring from the live members.
+// On error the previous ring is kept.
+func (s *Sharder) Refresh(ctx context.Context) error {
+	if err := s.membership.Heartbeat(ctx, s.id, s.ttl); err != nil {
+		return err
+	}
+	members, err := s.membership.Replicas(ctx)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(members, s.id) {
+		members = append(members, s.id)
+	}
+	ring := NewRing(members)
+
+	s.mu.Lock()
+	previous := s.ring.Members()
+	s.ring = ring
+	s.mu.Unlock()
+
+	metricReplicas.Set(float64(len(ring.Members())))
+	if !slices.Equal(previous, ring.Members()) {
+		slog.Info("Shard membership changed; rebalancing feeds", "replica", s.id, "replicas", ring.Members())
+	}
+	return nil
+}
+
+// Run refreshes membership every interval until ctx is done, then
+// deregisters this replica so its feeds move immediately.
+func (s *Sharder) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			leaveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			if err := s.membership.Leave(leaveCtx, s.id); err != nil {
+				slog.Warn("Failed to leave shard membership", "replica", s.id, "error", err)
+			}
+			return
+		case <-ticker.C:
+			refreshCtx, cancel := context.WithTimeout(ctx, s.interval)
+			if err := s.Refresh(refreshCtx); err != nil {
+				slog.Error("Failed to refresh shard membership", "replica", s.id, "error", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltFeedsBucket = []byte("feeds")
+	// boltQueuesBucket holds a nested bucket of items by ID per queue.
+	boltQueuesBucket = []byte("queues")
+	// boltSeenBucket holds a nested bucket of seen entries by key per set.
+	boltSeenBucket = []byte("seen")
+	// boltSeenExpiryBucket indexes the entries of boltSeenBucket by expiry:
+	// a nested bucket per set holds the big-endian expiry in Unix
+	// nanoseconds followed by the key.
+	boltSeenExpiryBucket = []byte("seen_expiry")
+)
+
+// boltSeenPruneBatch bounds how many expired seen entries one claim
+// deletes, so that a claim costs the same however large its set grew.
+const boltSeenPruneBatch = 64
+
+// BoltStore persists feed states in a single local bbolt database file.
+// Every write runs in its own transaction, which bbolt commits atomically
+// and fsyncs before returning, so a crash never leaves a partial record.
+// bbolt operations are not interruptible, so contexts are only checked
+// before a transaction starts. The database file is locked by one process,
+// so locks only need to coordinate within that process.
+type BoltStore struct {
+	localLocker
+
+	db *bolt.DB
+}
+
+// ErrStoreInUse is returned by NewBoltStore when another process, such as
+// a running server, holds the file.
+var ErrStoreInUse = errors.New("bolt store is in use by another process")
+
+func NewBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create bolt store directory: %w", err)
+	}
+
+	// The file lock is exclusive; fail fast instead of hanging forever when
+	// another process (e.g. the previous pod during a rollout) still holds it.
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("failed to open bolt store %s: %w", path, ErrStoreInUse)
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open bolt store: %w", err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(boltFeedsBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(boltQueuesBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(boltSeenBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(boltSeenExpiryBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize bolt store: %w", err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) GetFeedState(ctx context.Context, feedURL string) (FeedState, error) {
+	states, err := s.GetFeedStates(ctx, []string{feedURL})
+	if err != nil {
+		return FeedState{}, err
+	}
+	st, ok := states[feedURL]
+	if !ok {
+		return FeedState{}, ErrNoState
+	}
+	return st, nil
+}
+
+func (s *BoltStore) SetFeedState(ctx context.Context, feedURL string, st FeedState) error {
+	return s.SetFeedStates(ctx, map[string]FeedState{feedURL: st})
+}
+
+func (s *BoltStore) CompareAndSetFeedState(ctx context.Context, feedURL string, expected *FeedState, next FeedState) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("bolt compare-and-set failed: %w", err)
+	}
+
+	encoded, err := EncodeFeedState(next)
+	if err != nil {
+		return fmt.Errorf("encode feed state failed: %w", err)
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltFeedsBucket)
+		var current FeedState
+		raw := b.Get([]byte(feedURL))
+		if raw != nil {
+			st, err := DecodeFeedState(string(raw))
+			if err != nil {
+				return fmt.Errorf("%w %q: %w", ErrInvalidState, raw, err)
+			}
+			current = st
+		}
+		if !casMatches(current, raw != nil, expected) {
+			return ErrConflict
+		}
+		return b.Put([]byte(feedURL), []byte(encoded))
+	})
+	if errors.Is(err, ErrConflict) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("bolt compare-and-set failed: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) CompareAndDeleteFeedState(ctx context.Context, feedURL string, expected FeedState) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("bolt compare-and-delete failed: %w", err)
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltFeedsBucket)
+		raw := b.Get([]byte(feedURL))
+		if raw == nil {
+			return ErrConflict
+		}
+		current, err := DecodeFeedState(string(raw))
+		if err != nil {
+			return fmt.Errorf("%w %q: %w", ErrInvalidState, raw, err)
+		}
+		if !casMatches(current, true, &expected) {
+			return ErrConflict
+		}
+		return b.Delete([]byte(feedURL))
+	})
+	if errors.Is(err, ErrConflict) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("bolt compare-and-delete failed: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) GetFeedStates(ctx context.Context, feedURLs []string) (map[string]FeedState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("bolt get failed: %w", err)
+	}
+
+	raw := make(map[string]string, len(feedURLs))
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltFeedsBucket)
+		for _, feedURL := range feedURLs {
+			if val := b.Get([]byte(feedURL)); val != nil {
+				raw[feedURL] = string(val)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("bolt get failed: %w", err)
+	}
+
+	out := make(map[string]FeedState, len(raw))
+	for feedURL, val := range raw {
+		st, err := DecodeFeedState(val)
+		if err != nil {
+			return nil, fmt.Errorf("%w for %q %q: %w", ErrInvalidState, feedURL, val, err)
+		}
+		out[feedURL] = st
+	}
+	return out, nil
+}
+
+func (s *BoltStore) SetFeedStates(ctx context.Context, states map[string]FeedState) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("bolt set failed: %w", err)
+	}
+
+	encoded := make(map[string]string, len(states))
+	for feedURL, st := range states {
+		val, err := EncodeFeedState(st)
+		if err != nil {
+			return fmt.Errorf("encode feed state for %q failed: %w", feedURL, err)
+		}
+		encoded[feedURL] = val
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltFeedsBucket)
+		for feedURL, val := range encoded {
+			if err := b.Put([]byte(feedURL), []byte(val)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("bolt set failed: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) ListFeeds(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("bolt list failed: %w", err)
+	}
+
+	var out []string
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltFeedsBucket).ForEach(func(k, _ []byte) error {
+			out = append(out, string(k))
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("bolt list failed: %w", err)
+	}
+	return out, nil
+}
+
+func (s *BoltStore) DeleteFeedState(ctx context.Context, feedURL string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("bolt delete failed: %w", err)
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltFeedsBucket).Delete([]byte(feedURL))
+	}); err != nil {
+		return fmt.Errorf("bolt delete failed: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) Enqueue(ctx context.Context, queue string, items ...QueuedItem) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("bolt enqueue failed: %w", err)
+	}
+
+	encoded := make(map[string][]byte, len(items))
+	for _, item := range items {
+		val, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("encode queued item %q failed: %w", item.ID, err)
+		}
+		encoded[item.ID] = val
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(boltQueuesBucket).CreateBucketIfNotExists([]byte(queue))
+		if err != nil {
+			return err
+		}
+		for id, val := range encoded {
+			if err := b.Put([]byte(id), val); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("bolt enqueue failed: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) ListQueue(ctx context.Context, queue string) ([]QueuedItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("bolt list queue failed: %w", err)
+	}
+
+	var out []QueuedItem
+	var undecodable []string
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltQueuesBucket).Bucket([]byte(queue))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(id, val []byte) error {
+			item, err := decodeQueuedItem(val)
+			if err != nil {
+				undecodable = append(undecodable, string(id))
+				return nil
+			}
+			out = append(out, item)
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("bolt list queue failed: %w", err)
+	}
+	dropUndecodable(ctx, queue, undecodable, s.RemoveFromQueue)
+	sortQueue(out)
+	return out, nil
+}
+
+func (s *BoltStore) RemoveFromQueue(ctx context.Context, queue string, ids ...string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("bolt remove from queue failed: %w", err)
+	}
+
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		queues := tx.Bucket(boltQueuesBucket)
+		b := queues.Bucket([]byte(queue))
+		if b == nil {
+			return nil
+		}
+		for _, id := range ids {
+			if err := b.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		if k, _ := b.Cursor().First(); k == nil {
+			return queues.DeleteBucket([]byte(queue))
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("bolt remove from queue failed: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) ListQueues(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("bolt list queues failed: %w", err)
+	}
+
+	var out []string
+	if err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltQueuesBucket).ForEachBucket(func(name []byte) error {
+			out = append(out, string(name))
+			return nil
+		})
+	}); err != nil {
+		return nil, fmt.Errorf("bolt list queues failed: %w", err)
+	}
+	return out, nil
+}
+
+// Claim prunes a bounded number of expired entries of set along the way,
+// oldest first, which keeps the set as small as its window allows. Entries
+// that cannot be decoded count as expired.
+func (s *BoltStore) Claim(ctx context.Context, set, key, owner string, ttl time.Duration) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", fmt.Errorf("bolt claim failed: %w", err)
+	}
+
+	now := time.Now()
+	claimed := owner
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(boltSeenBucket).CreateBucketIfNotExists([]byte(set))
+		if err != nil {
+			return err
+		}
+		index, err := tx.Bucket(boltSeenExpiryBucket).CreateBucketIfNotExists([]byte(set))
+		if err != nil {
+			return err
+		}
+		if err := pruneSeen(b, index, now); err != nil {
+			return err
+		}
+		if val := b.Get([]byte(key)); val != nil {
+			if entry, err := decodeSeenEntry(val); err == nil && now.Before(entry.Expires) {
+				claimed = entry.Owner
+				return nil
+			}
+		}
+		expires := now.Add(ttl)
+		val, err := json.Marshal(seenEntry{Owner: owner, Expires: expires})
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte(key), val); err != nil {
+			return err
+		}
+		return index.Put(seenExpiryKey(expires, key), nil)
+	}); err != nil {
+		return "", fmt.Errorf("bolt claim failed: %w", err)
+	}
+	return claimed, nil
+}
+
+// seenExpiryKey is the key of an entry in boltSeenExpiryBucket.
+func seenExpiryKey(expires time.Time, key string) []byte {
+	k := binary.BigEndian.AppendUint64(nil, uint64(expires.UnixNano()))
+	return append(k, key...)
+}
+
+// pruneSeen deletes up to boltSeenPruneBatch entries of b that expired by
+// now, along with their index records. An entry claimed again after it
+// expired has a later index record and is kept.
+func pruneSeen(b, index *bolt.Bucket, now time.Time) error {
+	c := index.Cursor()
+	for i := 0; i < boltSeenPruneBatch; i++ {
+		k, _ := c.First()
+		if k == nil {
+			return nil
+		}
+		if len(k) >= 8 && int64(binary.BigEndian.Uint64(k[:8])) > now.UnixNano() {
+			return nil
+		}
+		valid := len(k) >= 8
+		key := bytes.Clone(k[min(len(k), 8):])
+		if err := c.Delete(); err != nil {
+			return err
+		}
+		if !valid {
+			continue
+		}
+		if val := b.Get(key); val != nil {
+			if entry, err := decodeSeenEntry(val); err != nil || !now.Before(entry.Expires) {
+				if err := b.Delete(key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *BoltStore) Release(ctx context.Context, set, key, owner string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("bolt release failed: %w", err)
+	}
+	if err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltSeenBucket).Bucket([]byte(set))
+		if b == nil {
+			return nil
+		}
+		val := b.Get([]byte(key))
+		if val == nil {
+			return nil
+		}
+		if entry, err := decodeSeenEntry(val); err == nil && entry.Owner != owner {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	}); err != nil {
+		return fmt.Errorf("bolt release failed: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,115 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltStorePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "state.db")
+	ts := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetFeedState(context.Background(), "https://example.com/rss.xml"); !errors.Is(err, ErrNoState) {
+		t.Fatalf("GetFeedState on empty store error = %v, want ErrNoState", err)
+	}
+	if err := store.SetFeedState(context.Background(), "https://example.com/rss.xml", NewReadyState(ts)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	st, err := reopened.GetFeedState(context.Background(), "https://example.com/rss.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Status != StatusReady {
+		t.Fatalf("status = %q, want %q", st.Status, StatusReady)
+	}
+	if !st.LastPublishedAt.Equal(ts) {
+		t.Fatalf("last published at = %s, want %s", st.LastPublishedAt, ts)
+	}
+}
+
+func TestBoltStoreClaimSkipsUndecodableAndPrunesExpiredEntries(t *testing.T) {
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if _, err := store.Claim(ctx, "dedup:a", "url:expired", "feed-a 1", time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Claim(ctx, "dedup:a", "url:bad", "feed-a 2", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSeenBucket).Bucket([]byte("dedup:a")).Put([]byte("url:bad"), []byte("not json"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// The undecodable entry is claimed anew instead of failing every claim.
+	if got, err := store.Claim(ctx, "dedup:a", "url:bad", "feed-b 1", time.Minute); err != nil || got != "feed-b 1" {
+		t.Fatalf("claim of undecodable entry = %q, %v; want feed-b 1", got, err)
+	}
+	if err := store.db.View(func(tx *bolt.Tx) error {
+		if val := tx.Bucket(boltSeenBucket).Bucket([]byte("dedup:a")).Get([]byte("url:expired")); val != nil {
+			t.Errorf("expired entry %q was not pruned", val)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoltStoreListQueueRemovesUndecodableItems(t *testing.T) {
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if err := store.Enqueue(ctx, "digest:a", QueuedItem{ID: "good", QueuedAt: time.Now(), Data: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltQueuesBucket).Bucket([]byte("digest:a")).Put([]byte("bad"), []byte("not json"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		items, err := store.ListQueue(ctx, "digest:a")
+		if err != nil || len(items) != 1 || items[0].ID != "good" {
+			t.Fatalf("ListQueue = %+v, %v; want only the decodable item", items, err)
+		}
+	}
+	if err := store.db.View(func(tx *bolt.Tx) error {
+		if val := tx.Bucket(boltQueuesBucket).Bucket([]byte("digest:a")).Get([]byte("bad")); val != nil {
+			t.Errorf("undecodable item %q was not removed", val)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
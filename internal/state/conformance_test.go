@@ -0,0 +1,56 @@
+package state_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"rss-fetcher/internal/state"
+	"rss-fetcher/internal/state/statetest"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	statetest.Run(t, func(t *testing.T) state.Store {
+		return state.NewMemoryStore()
+	})
+}
+
+func TestBoltStoreConformance(t *testing.T) {
+	statetest.Run(t, func(t *testing.T) state.Store {
+		store, err := state.NewBoltStore(filepath.Join(t.TempDir(), "state.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestValkeyStoreConformance(t *testing.T) {
+	statetest.Run(t, func(t *testing.T) state.Store {
+		srv := miniredis.RunT(t)
+		// miniredis only expires keys when told time has passed.
+		stop := make(chan struct{})
+		t.Cleanup(func() { close(stop) })
+		go func() {
+			ticker := time.NewTicker(10 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					srv.FastForward(10 * time.Millisecond)
+				}
+			}
+		}()
+		store, err := state.NewValkeyStore(srv.Addr(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
@@ -0,0 +1,153 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GCResult summarizes one CollectOrphans pass.
+type GCResult struct {
+	Orphaned int // States still orphaned after this pass
+	Marked   int // States newly marked as orphaned
+	Restored int // Orphaned states whose feed is configured again
+	Deleted  int // Orphaned states removed after the grace period
+}
+
+// CollectOrphans reconciles stored states with the configured feed keys.
+// A state whose key is not in active is marked orphaned; once it has been
+// orphaned for gracePeriod it is deleted so that re-adding the feed later
+// starts a fresh warmup instead of resuming from a stale baseline. A
+// gracePeriod of 0 keeps orphaned states forever. States of feeds that
+// come back before they are deleted are unmarked and resume as before.
+func CollectOrphans(ctx context.Context, store Store, active []string, gracePeriod time.Duration, now time.Time) (GCResult, error) {
+	var result GCResult
+
+	keys, err := store.ListFeeds(ctx)
+	if err != nil {
+		return result, err
+	}
+	configured := make(map[string]bool, len(active))
+	for _, key := range active {
+		configured[key] = true
+	}
+
+	for batch := range slices.Chunk(keys, transferBatchSize) {
+		states, err := store.GetFeedStates(ctx, batch)
+		if errors.Is(err, ErrInvalidState) {
+			states, err = getDecodableStates(ctx, store, batch)
+		}
+		if err != nil {
+			return result, err
+		}
+
+		deletes := make(map[string]FeedState)
+		for key, st := range states {
+			next := st
+			switch {
+			case configured[key] && !st.OrphanedAt.IsZero():
+				next.OrphanedAt = time.Time{}
+			case configured[key]:
+				continue
+			case st.OrphanedAt.IsZero():
+				next.OrphanedAt = now
+			case gracePeriod > 0 && now.Sub(st.OrphanedAt) >= gracePeriod:
+				deletes[key] = st
+				continue
+			default:
+				result.Orphaned++
+				continue
+			}
+
+			// Another replica may be processing or reconciling the same
+			// feed; leave conflicting states to the next pass.
+			if err := store.CompareAndSetFeedState(ctx, key, &st, next); errors.Is(err, ErrConflict) {
+				continue
+			} else if err != nil {
+				return result, err
+			}
+			if next.OrphanedAt.IsZero() {
+				result.Restored++
+			} else {
+				result.Marked++
+				result.Orphaned++
+			}
+		}
+
+		// A feed added again and processed since the read keeps its state.
+		for key, st := range deletes {
+			if err := store.CompareAndDeleteFeedState(ctx, key, st); errors.Is(err, ErrConflict) {
+				continue
+			} else if err != nil {
+				return result, err
+			}
+			result.Deleted++
+		}
+	}
+	return result, nil
+}
+
+// getDecodableStates reads the states of keys one by one, logging and
+// skipping those that cannot be decoded.
+func getDecodableStates(ctx context.Context, store Store, keys []string) (map[string]FeedState, error) {
+	states := make(map[string]FeedState, len(keys))
+	for _, key := range keys {
+		st, err := store.GetFeedState(ctx, key)
+		switch {
+		case errors.Is(err, ErrNoState):
+		case errors.Is(err, ErrInvalidState):
+			slog.Warn("Skipping undecodable feed state", "feed", key, "error", err)
+		case err != nil:
+			return nil, err
+		default:
+			states[key] = st
+		}
+	}
+	return states, nil
+}
+
+// CollectOrphanQueues deletes the queues whose names start with one of
+// prefixes but are not in active, e.g. the digests of webhooks that were
+// removed or renamed, once their newest item has been queued for
+// gracePeriod. Queues carry no orphan mark, so the age of their newest item
+// stands in for the time they were orphaned. A gracePeriod of 0 keeps them
+// forever. It returns the number of queues deleted.
+func CollectOrphanQueues(ctx context.Context, queue Queue, prefixes, active []string, gracePeriod time.Duration, now time.Time) (int, error) {
+	if gracePeriod <= 0 {
+		return 0, nil
+	}
+	names, err := queue.ListQueues(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, name := range names {
+		owned := slices.ContainsFunc(prefixes, func(prefix string) bool {
+			return strings.HasPrefix(name, prefix)
+		})
+		if !owned || slices.Contains(active, name) {
+			continue
+		}
+
+		items, err := queue.ListQueue(ctx, name)
+		if err != nil {
+			return deleted, err
+		}
+		if len(items) == 0 || now.Sub(items[len(items)-1].QueuedAt) < gracePeriod {
+			continue
+		}
+		ids := make([]string, 0, len(items))
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		if err := queue.RemoveFromQueue(ctx, name, ids...); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,204 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCollectOrphansMarksThenDeletesAfterGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	if err := store.SetFeedStates(ctx, map[string]FeedState{
+		"https://example.com/kept.xml":    NewReadyState(now),
+		"https://example.com/removed.xml": NewReadyState(now),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	active := []string{"https://example.com/kept.xml"}
+
+	result, err := CollectOrphans(ctx, store, active, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Marked != 1 || result.Orphaned != 1 || result.Deleted != 0 {
+		t.Fatalf("first pass = %+v, want 1 marked and orphaned", result)
+	}
+
+	result, err = CollectOrphans(ctx, store, active, time.Hour, now.Add(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Marked != 0 || result.Orphaned != 1 || result.Deleted != 0 {
+		t.Fatalf("pass within grace period = %+v, want 1 orphaned", result)
+	}
+
+	result, err = CollectOrphans(ctx, store, active, time.Hour, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Orphaned != 0 || result.Deleted != 1 {
+		t.Fatalf("pass after grace period = %+v, want 1 deleted", result)
+	}
+	if _, err := store.GetFeedState(ctx, "https://example.com/removed.xml"); !errors.Is(err, ErrNoState) {
+		t.Fatalf("GetFeedState of deleted orphan error = %v, want ErrNoState", err)
+	}
+	if _, err := store.GetFeedState(ctx, "https://example.com/kept.xml"); err != nil {
+		t.Fatalf("GetFeedState of configured feed error = %v", err)
+	}
+}
+
+func TestCollectOrphansRestoresReaddedFeed(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	if err := store.SetFeedState(ctx, "https://example.com/rss.xml", NewReadyState(now)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CollectOrphans(ctx, store, nil, 0, now); err != nil {
+		t.Fatal(err)
+	}
+	result, err := CollectOrphans(ctx, store, []string{"https://example.com/rss.xml"}, 0, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Restored != 1 || result.Orphaned != 0 {
+		t.Fatalf("result = %+v, want 1 restored", result)
+	}
+	st, err := store.GetFeedState(ctx, "https://example.com/rss.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.OrphanedAt.IsZero() {
+		t.Fatalf("orphaned at = %s, want zero", st.OrphanedAt)
+	}
+}
+
+func TestCollectOrphanQueuesDeletesUnconfiguredQueuesAfterGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	for _, name := range []string{"digest:kept", "digest:removed", "held:removed", "bursts"} {
+		if err := store.Enqueue(ctx, name,
+			QueuedItem{ID: "old", QueuedAt: now.Add(-2 * time.Hour), Data: []byte(`{}`)},
+			QueuedItem{ID: "new", QueuedAt: now.Add(-30 * time.Minute), Data: []byte(`{}`)},
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prefixes := []string{"digest:", "held:"}
+	active := []string{"digest:kept", "held:kept"}
+
+	deleted, err := CollectOrphanQueues(ctx, store, prefixes, active, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 {
+		t.Fatalf("deleted within grace period = %d, want 0", deleted)
+	}
+
+	deleted, err = CollectOrphanQueues(ctx, store, prefixes, active, time.Hour, now.Add(30*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Fatalf("deleted after grace period = %d, want 2", deleted)
+	}
+	queues, err := store.ListQueues(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(queues, []string{"bursts", "digest:kept"}) {
+		t.Fatalf("remaining queues = %v, want [bursts digest:kept]", queues)
+	}
+}
+
+func TestCollectOrphanQueuesKeepsQueuesWithoutGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	if err := store.Enqueue(ctx, "digest:removed", QueuedItem{ID: "a", QueuedAt: now.Add(-24 * time.Hour), Data: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := CollectOrphanQueues(ctx, store, []string{"digest:"}, nil, 0, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 {
+		t.Fatalf("deleted = %d, want 0", deleted)
+	}
+}
+
+func TestCollectOrphansSkipsUndecodableStates(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.SetFeedState(ctx, "https://example.com/removed.xml", NewReadyState(now)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltFeedsBucket).Put([]byte("https://example.com/corrupt.xml"), []byte("{"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := CollectOrphans(ctx, store, nil, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Marked != 1 {
+		t.Fatalf("result = %+v, want the decodable state marked", result)
+	}
+}
+
+// rewritingStore stands in for a feed that is added again and processed
+// between CollectOrphans reading its state and deleting it.
+type rewritingStore struct {
+	*MemoryStore
+	key  string
+	next FeedState
+}
+
+func (s *rewritingStore) GetFeedStates(ctx context.Context, keys []string) (map[string]FeedState, error) {
+	states, err := s.MemoryStore.GetFeedStates(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	return states, s.MemoryStore.SetFeedState(ctx, s.key, s.next)
+}
+
+func TestCollectOrphansKeepsStateRewrittenSinceRead(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+	key := "https://example.com/readded.xml"
+	orphaned := NewReadyState(now)
+	orphaned.OrphanedAt = now.Add(-2 * time.Hour)
+	fresh := NewReadyState(now.Add(time.Minute))
+	store := &rewritingStore{MemoryStore: NewMemoryStore(), key: key, next: fresh}
+	if err := store.MemoryStore.SetFeedState(ctx, key, orphaned); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := CollectOrphans(ctx, store, nil, time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Deleted != 0 {
+		t.Fatalf("result = %+v, want nothing deleted", result)
+	}
+	if _, err := store.GetFeedState(ctx, key); err != nil {
+		t.Fatalf("GetFeedState of rewritten state error = %v", err)
+	}
+}
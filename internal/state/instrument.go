@@ -0,0 +1,188 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	metricOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rss_store_operation_duration_seconds",
+		Help:    "Latency of state store operations",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation"})
+
+	metricOperationErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_store_operation_errors_total",
+		Help: "State store operations that failed, excluding missing states and compare-and-set conflicts",
+	}, []string{"operation"})
+)
+
+var tracer = otel.Tracer("rss-fetcher/internal/state")
+
+// instrumentedStore records the latency and failures of a Store's
+// operations in metrics and trace spans.
+type instrumentedStore struct {
+	Store
+}
+
+// Instrument returns store with operation metrics and tracing. The
+// returned Store does not implement the optional interfaces of store (such
+// as Locker), so callers look those up on store itself.
+func Instrument(store Store) Store {
+	return instrumentedStore{store}
+}
+
+// instrumentedQueue records the latency and failures of a Queue's
+// operations like instrumentedStore.
+type instrumentedQueue struct {
+	Queue
+}
+
+// InstrumentQueue returns queue with operation metrics and tracing.
+func InstrumentQueue(queue Queue) Queue {
+	return instrumentedQueue{queue}
+}
+
+// instrumentedSeenSet records the latency and failures of a SeenSet's
+// operations like instrumentedStore.
+type instrumentedSeenSet struct {
+	SeenSet
+}
+
+// InstrumentSeenSet returns set with operation metrics and tracing.
+func InstrumentSeenSet(set SeenSet) SeenSet {
+	return instrumentedSeenSet{set}
+}
+
+// startOperation starts timing a store operation. The returned function
+// records its outcome.
+func startOperation(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, span := tracer.Start(ctx, "state."+operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		metricOperationDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+		if err != nil && !errors.Is(err, ErrNoState) && !errors.Is(err, ErrConflict) {
+			metricOperationErrors.WithLabelValues(operation).Inc()
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else if err != nil {
+			span.SetAttributes(attribute.String("rss.state.result", err.Error()))
+		}
+		span.End()
+	}
+}
+
+func keyAttribute(feedURL string) attribute.KeyValue {
+	return attribute.String("rss.feed.key", feedURL)
+}
+
+func (s instrumentedStore) GetFeedState(ctx context.Context, feedURL string) (FeedState, error) {
+	ctx, done := startOperation(ctx, "get", keyAttribute(feedURL))
+	st, err := s.Store.GetFeedState(ctx, feedURL)
+	done(err)
+	return st, err
+}
+
+func (s instrumentedStore) SetFeedState(ctx context.Context, feedURL string, st FeedState) error {
+	ctx, done := startOperation(ctx, "set", keyAttribute(feedURL))
+	err := s.Store.SetFeedState(ctx, feedURL, st)
+	done(err)
+	return err
+}
+
+func (s instrumentedStore) CompareAndSetFeedState(ctx context.Context, feedURL string, expected *FeedState, next FeedState) error {
+	ctx, done := startOperation(ctx, "compare_and_set", keyAttribute(feedURL))
+	err := s.Store.CompareAndSetFeedState(ctx, feedURL, expected, next)
+	done(err)
+	return err
+}
+
+func (s instrumentedStore) GetFeedStates(ctx context.Context, feedURLs []string) (map[string]FeedState, error) {
+	ctx, done := startOperation(ctx, "get_many", attribute.Int("rss.feeds", len(feedURLs)))
+	states, err := s.Store.GetFeedStates(ctx, feedURLs)
+	done(err)
+	return states, err
+}
+
+func (s instrumentedStore) SetFeedStates(ctx context.Context, states map[string]FeedState) error {
+	ctx, done := startOperation(ctx, "set_many", attribute.Int("rss.feeds", len(states)))
+	err := s.Store.SetFeedStates(ctx, states)
+	done(err)
+	return err
+}
+
+func (s instrumentedStore) ListFeeds(ctx context.Context) ([]string, error) {
+	ctx, done := startOperation(ctx, "list")
+	keys, err := s.Store.ListFeeds(ctx)
+	done(err)
+	return keys, err
+}
+
+func (s instrumentedStore) DeleteFeedState(ctx context.Context, feedURL string) error {
+	ctx, done := startOperation(ctx, "delete", keyAttribute(feedURL))
+	err := s.Store.DeleteFeedState(ctx, feedURL)
+	done(err)
+	return err
+}
+
+func (s instrumentedStore) CompareAndDeleteFeedState(ctx context.Context, feedURL string, expected FeedState) error {
+	ctx, done := startOperation(ctx, "compare_and_delete", keyAttribute(feedURL))
+	err := s.Store.CompareAndDeleteFeedState(ctx, feedURL, expected)
+	done(err)
+	return err
+}
+
+func queueAttribute(queue string) attribute.KeyValue {
+	return attribute.String("rss.queue", queue)
+}
+
+func (q instrumentedQueue) Enqueue(ctx context.Context, queue string, items ...QueuedItem) error {
+	ctx, done := startOperation(ctx, "enqueue", queueAttribute(queue), attribute.Int("rss.items", len(items)))
+	err := q.Queue.Enqueue(ctx, queue, items...)
+	done(err)
+	return err
+}
+
+func (q instrumentedQueue) ListQueue(ctx context.Context, queue string) ([]QueuedItem, error) {
+	ctx, done := startOperation(ctx, "list_queue", queueAttribute(queue))
+	items, err := q.Queue.ListQueue(ctx, queue)
+	done(err)
+	return items, err
+}
+
+func (q instrumentedQueue) RemoveFromQueue(ctx context.Context, queue string, ids ...string) error {
+	ctx, done := startOperation(ctx, "remove_from_queue", queueAttribute(queue), attribute.Int("rss.items", len(ids)))
+	err := q.Queue.RemoveFromQueue(ctx, queue, ids...)
+	done(err)
+	return err
+}
+
+func (q instrumentedQueue) ListQueues(ctx context.Context) ([]string, error) {
+	ctx, done := startOperation(ctx, "list_queues")
+	queues, err := q.Queue.ListQueues(ctx)
+	done(err)
+	return queues, err
+}
+
+func (s instrumentedSeenSet) Claim(ctx context.Context, set, key, owner string, ttl time.Duration) (string, error) {
+	ctx, done := startOperation(ctx, "claim", attribute.String("rss.set", set))
+	claimed, err := s.SeenSet.Claim(ctx, set, key, owner, ttl)
+	done(err)
+	return claimed, err
+}
+
+func (s instrumentedSeenSet) Release(ctx context.Context, set, key, owner string) error {
+	ctx, done := startOperation(ctx, "release", attribute.String("rss.set", set))
+	err := s.SeenSet.Release(ctx, set, key, owner)
+	done(err)
+	return err
+}
@@ -0,0 +1,70 @@
+package state
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLocked is returned by Locker.TryLock when the lease is held by
+// another owner.
+var ErrLocked = errors.New("lock is held by another owner")
+
+// Locker coordinates exclusive work between fetcher processes that share
+// a store. TryLock acquires the named lease for ttl without waiting. The
+// returned unlock releases the lease only while it is still owned by the
+// caller, so a holder whose lease expired cannot release a successor's.
+type Locker interface {
+	TryLock(ctx context.Context, name string, ttl time.Duration) (unlock func(context.Context) error, err error)
+}
+
+func newLockToken() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// NewLocalLocker returns a Locker whose leases are only seen by the
+// current process.
+func NewLocalLocker() Locker {
+	return &localLocker{}
+}
+
+// localLocker implements Locker for backends that are only ever opened
+// by a single process.
+type localLocker struct {
+	mu     sync.Mutex
+	leases map[string]localLease
+}
+
+type localLease struct {
+	token   string
+	expires time.Time
+}
+
+func (l *localLocker) TryLock(ctx context.Context, name string, ttl time.Duration) (func(context.Context) error, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if lease, ok := l.leases[name]; ok && now.Before(lease.expires) {
+		return nil, ErrLocked
+	}
+	if l.leases == nil {
+		l.leases = make(map[string]localLease)
+	}
+	token := newLockToken()
+	l.leases[name] = localLease{token: token, expires: now.Add(ttl)}
+
+	return func(context.Context) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if lease, ok := l.leases[name]; ok && lease.token == token {
+			delete(l.leases, name)
+		}
+		return nil
+	}, nil
+}
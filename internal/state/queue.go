@@ -0,0 +1,109 @@
+package state
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// QueuedItem is a notification held in a Queue for later delivery.
+type QueuedItem struct {
+	ID       string          `json:"id"`
+	QueuedAt time.Time       `json:"queued_at"`
+	Data     json.RawMessage `json:"data"` // Opaque to the store
+}
+
+// Queue holds notifications durably until they are delivered, e.g. as a
+// digest. Items are keyed by ID within a named queue, so enqueueing an item
+// again replaces it and a retried run does not queue it twice.
+//
+// ListQueue returns the items oldest first (ties broken by ID), or none if
+// the queue does not exist. Stored items that cannot be decoded are logged
+// and removed rather than blocking the queue. RemoveFromQueue ignores IDs
+// that are not queued; a queue whose last item is removed ceases to exist.
+// ListQueues returns the names of the queues that exist.
+type Queue interface {
+	Enqueue(ctx context.Context, queue string, items ...QueuedItem) error
+	ListQueue(ctx context.Context, queue string) ([]QueuedItem, error)
+	RemoveFromQueue(ctx context.Context, queue string, ids ...string) error
+	ListQueues(ctx context.Context) ([]string, error)
+}
+
+func sortQueue(items []QueuedItem) {
+	slices.SortFunc(items, func(a, b QueuedItem) int {
+		return cmp.Or(a.QueuedAt.Compare(b.QueuedAt), cmp.Compare(a.ID, b.ID))
+	})
+}
+
+// dropUndecodable logs the queued items listed under ids that could not be
+// decoded and removes them with remove.
+func dropUndecodable(ctx context.Context, queue string, ids []string, remove func(context.Context, string, ...string) error) {
+	if len(ids) == 0 {
+		return
+	}
+	slog.Warn("Removing undecodable queued items", "queue", queue, "ids", ids)
+	if err := remove(ctx, queue, ids...); err != nil {
+		slog.Warn("Failed to remove undecodable queued items", "queue", queue, "error", err)
+	}
+}
+
+func decodeQueuedItem(raw []byte) (QueuedItem, error) {
+	var item QueuedItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return QueuedItem{}, fmt.Errorf("invalid queued item %q: %w", raw, err)
+	}
+	return item, nil
+}
+
+func (s *MemoryStore) Enqueue(ctx context.Context, queue string, items ...QueuedItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queues == nil {
+		s.queues = make(map[string]map[string]QueuedItem)
+	}
+	q := s.queues[queue]
+	if q == nil {
+		q = make(map[string]QueuedItem)
+		s.queues[queue] = q
+	}
+	for _, item := range items {
+		item.Data = slices.Clone(item.Data)
+		q[item.ID] = item
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListQueue(ctx context.Context, queue string) ([]QueuedItem, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]QueuedItem, 0, len(s.queues[queue]))
+	for _, item := range s.queues[queue] {
+		item.Data = slices.Clone(item.Data)
+		out = append(out, item)
+	}
+	sortQueue(out)
+	return out, nil
+}
+
+func (s *MemoryStore) RemoveFromQueue(ctx context.Context, queue string, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range ids {
+		delete(s.queues[queue], id)
+	}
+	if len(s.queues[queue]) == 0 {
+		delete(s.queues, queue)
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListQueues(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Sorted(maps.Keys(s.queues)), nil
+}
@@ -0,0 +1,80 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SeenSet remembers keys for a limited time, such as the items a webhook
+// received recently. Each key is recorded with an owner, so that the
+// owner can claim it again, e.g. when a run is retried, while anyone else
+// sees it as taken.
+//
+// Claim records key in set for ttl on behalf of owner unless an unexpired
+// record exists, and returns the owner of the record, which is owner if
+// the claim succeeded or owner holds the key already.
+//
+// Release forgets key if owner holds it, e.g. when what was claimed did
+// not happen after all.
+type SeenSet interface {
+	Claim(ctx context.Context, set, key, owner string, ttl time.Duration) (string, error)
+	Release(ctx context.Context, set, key, owner string) error
+}
+
+// memorySeenPruneInterval is how often MemoryStore drops expired seen
+// entries, so that a claim does not cost a scan of every set.
+const memorySeenPruneInterval = time.Minute
+
+// seenEntry is a key's record in a SeenSet.
+type seenEntry struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+func decodeSeenEntry(raw []byte) (seenEntry, error) {
+	var entry seenEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return seenEntry{}, fmt.Errorf("invalid seen entry %q: %w", raw, err)
+	}
+	return entry, nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, set, key, owner string, ttl time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen == nil {
+		s.seen = make(map[string]map[string]seenEntry)
+	}
+	entries := s.seen[set]
+	if entries == nil {
+		entries = make(map[string]seenEntry)
+		s.seen[set] = entries
+	}
+	now := time.Now()
+	if now.Sub(s.seenPrunedAt) >= memorySeenPruneInterval {
+		s.seenPrunedAt = now
+		for _, entries := range s.seen {
+			for k, entry := range entries {
+				if !now.Before(entry.Expires) {
+					delete(entries, k)
+				}
+			}
+		}
+	}
+	if entry, ok := entries[key]; ok && now.Before(entry.Expires) {
+		return entry.Owner, nil
+	}
+	entries[key] = seenEntry{Owner: owner, Expires: now.Add(ttl)}
+	return owner, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, set, key, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.seen[set][key]; ok && entry.Owner == owner {
+		delete(s.seen[set], key)
+	}
+	return nil
+}
@@ -0,0 +1,471 @@
+// Package statetest provides the conformance suite every state.Store
+// backend must pass.
+package statetest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/state"
+)
+
+// Run exercises store behaviour shared by all backends. newStore must
+// return an empty store that is independent of any store it returned
+// before.
+func Run(t *testing.T, newStore func(t *testing.T) state.Store) {
+	t.Helper()
+
+	base := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+
+	t.Run("GetMissingReturnsErrNoState", func(t *testing.T) {
+		store := newStore(t)
+		if _, err := store.GetFeedState(context.Background(), "https://example.com/missing.xml"); !errors.Is(err, state.ErrNoState) {
+			t.Fatalf("GetFeedState error = %v, want ErrNoState", err)
+		}
+	})
+
+	t.Run("SetThenGetRoundTrips", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		want := state.NewWarmingState(base, base.Add(time.Minute))
+
+		if err := store.SetFeedState(ctx, "https://example.com/rss.xml", want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.GetFeedState(ctx, "https://example.com/rss.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertStateEqual(t, got, want)
+	})
+
+	t.Run("SetOverwrites", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		if err := store.SetFeedState(ctx, "https://example.com/rss.xml", state.NewWarmingState(base, base)); err != nil {
+			t.Fatal(err)
+		}
+		want := state.NewReadyState(base.Add(time.Hour))
+		if err := store.SetFeedState(ctx, "https://example.com/rss.xml", want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.GetFeedState(ctx, "https://example.com/rss.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertStateEqual(t, got, want)
+	})
+
+	t.Run("CompareAndSetCreatesOnlyWhenMissing", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		first := state.NewWarmingState(base, base)
+
+		if err := store.CompareAndSetFeedState(ctx, "https://example.com/rss.xml", nil, first); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CompareAndSetFeedState(ctx, "https://example.com/rss.xml", nil, state.NewReadyState(base)); !errors.Is(err, state.ErrConflict) {
+			t.Fatalf("CompareAndSetFeedState on existing key with nil expectation error = %v, want ErrConflict", err)
+		}
+		got, err := store.GetFeedState(ctx, "https://example.com/rss.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertStateEqual(t, got, first)
+	})
+
+	t.Run("CompareAndSetRejectsStaleExpectation", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		original := state.NewReadyState(base)
+		concurrent := state.NewReadyState(base.Add(2 * time.Hour))
+
+		if err := store.SetFeedState(ctx, "https://example.com/rss.xml", original); err != nil {
+			t.Fatal(err)
+		}
+		read, err := store.GetFeedState(ctx, "https://example.com/rss.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CompareAndSetFeedState(ctx, "https://example.com/rss.xml", &read, concurrent); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CompareAndSetFeedState(ctx, "https://example.com/rss.xml", &read, state.NewReadyState(base.Add(time.Hour))); !errors.Is(err, state.ErrConflict) {
+			t.Fatalf("CompareAndSetFeedState with stale expectation error = %v, want ErrConflict", err)
+		}
+		got, err := store.GetFeedState(ctx, "https://example.com/rss.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertStateEqual(t, got, concurrent)
+	})
+
+	t.Run("BatchSetThenBatchGetOmitsMissing", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		want := map[string]state.FeedState{
+			"https://example.com/a.xml": state.NewReadyState(base),
+			"https://example.com/b.xml": state.NewWarmingState(base.Add(time.Hour), base),
+		}
+
+		if err := store.SetFeedStates(ctx, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.GetFeedStates(ctx, []string{
+			"https://example.com/a.xml",
+			"https://example.com/missing.xml",
+			"https://example.com/b.xml",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("GetFeedStates returned %d states, want %d", len(got), len(want))
+		}
+		for feedURL, st := range want {
+			assertStateEqual(t, got[feedURL], st)
+		}
+	})
+
+	t.Run("BatchWithNoKeys", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		if err := store.SetFeedStates(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.GetFeedStates(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 {
+			t.Fatalf("GetFeedStates(nil) returned %d states, want 0", len(got))
+		}
+	})
+
+	t.Run("ListReturnsEveryKey", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		keys, err := store.ListFeeds(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 0 {
+			t.Fatalf("ListFeeds on empty store = %v, want none", keys)
+		}
+
+		want := []string{"https://example.com/a.xml", "https://example.com/b.xml", "https://example.com/c.xml"}
+		for _, feedURL := range want {
+			if err := store.SetFeedState(ctx, feedURL, state.NewReadyState(base)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		keys, err = store.ListFeeds(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slices.Sort(keys)
+		if !slices.Equal(keys, want) {
+			t.Fatalf("ListFeeds = %v, want %v", keys, want)
+		}
+	})
+
+	t.Run("LockIsExclusiveUntilReleased", func(t *testing.T) {
+		locker := requireLocker(t, newStore(t))
+		ctx := context.Background()
+
+		unlock, err := locker.TryLock(ctx, "feed:https://example.com/rss.xml", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := locker.TryLock(ctx, "feed:https://example.com/rss.xml", time.Minute); !errors.Is(err, state.ErrLocked) {
+			t.Fatalf("second TryLock error = %v, want ErrLocked", err)
+		}
+		otherUnlock, err := locker.TryLock(ctx, "feed:https://example.com/other.xml", time.Minute)
+		if err != nil {
+			t.Fatalf("TryLock of a different name error = %v", err)
+		}
+		defer otherUnlock(ctx)
+
+		if err := unlock(ctx); err != nil {
+			t.Fatal(err)
+		}
+		relock, err := locker.TryLock(ctx, "feed:https://example.com/rss.xml", time.Minute)
+		if err != nil {
+			t.Fatalf("TryLock after unlock error = %v", err)
+		}
+		relock(ctx)
+	})
+
+	t.Run("ExpiredLockCanBeTakenOver", func(t *testing.T) {
+		locker := requireLocker(t, newStore(t))
+		ctx := context.Background()
+
+		staleUnlock, err := locker.TryLock(ctx, "feed:https://example.com/rss.xml", 50*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var unlock func(context.Context) error
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			unlock, err = locker.TryLock(ctx, "feed:https://example.com/rss.xml", time.Minute)
+			if err == nil || !errors.Is(err, state.ErrLocked) || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("TryLock after expiry error = %v", err)
+		}
+		defer unlock(ctx)
+
+		// The expired holder must not release its successor's lease.
+		if err := staleUnlock(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := locker.TryLock(ctx, "feed:https://example.com/rss.xml", time.Minute); !errors.Is(err, state.ErrLocked) {
+			t.Fatalf("TryLock after stale unlock error = %v, want ErrLocked", err)
+		}
+	})
+
+	t.Run("CompareAndDeleteRejectsStaleExpectation", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		feedURL := "https://example.com/rss.xml"
+
+		if err := store.SetFeedState(ctx, feedURL, state.NewReadyState(base)); err != nil {
+			t.Fatal(err)
+		}
+		read, err := store.GetFeedState(ctx, feedURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		concurrent := state.NewReadyState(base.Add(time.Hour))
+		if err := store.SetFeedState(ctx, feedURL, concurrent); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CompareAndDeleteFeedState(ctx, feedURL, read); !errors.Is(err, state.ErrConflict) {
+			t.Fatalf("CompareAndDeleteFeedState with stale expectation error = %v, want ErrConflict", err)
+		}
+		if _, err := store.GetFeedState(ctx, feedURL); err != nil {
+			t.Fatalf("GetFeedState after rejected delete error = %v", err)
+		}
+
+		read, err = store.GetFeedState(ctx, feedURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.CompareAndDeleteFeedState(ctx, feedURL, read); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetFeedState(ctx, feedURL); !errors.Is(err, state.ErrNoState) {
+			t.Fatalf("GetFeedState after delete error = %v, want ErrNoState", err)
+		}
+		if err := store.CompareAndDeleteFeedState(ctx, feedURL, read); !errors.Is(err, state.ErrConflict) {
+			t.Fatalf("CompareAndDeleteFeedState of missing key error = %v, want ErrConflict", err)
+		}
+	})
+
+	t.Run("DeleteRemovesOnlyThatKey", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		for _, feedURL := range []string{"https://example.com/a.xml", "https://example.com/b.xml"} {
+			if err := store.SetFeedState(ctx, feedURL, state.NewReadyState(base)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.DeleteFeedState(ctx, "https://example.com/a.xml"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.DeleteFeedState(ctx, "https://example.com/missing.xml"); err != nil {
+			t.Fatalf("DeleteFeedState of missing key error = %v, want nil", err)
+		}
+
+		if _, err := store.GetFeedState(ctx, "https://example.com/a.xml"); !errors.Is(err, state.ErrNoState) {
+			t.Fatalf("GetFeedState after delete error = %v, want ErrNoState", err)
+		}
+		if _, err := store.GetFeedState(ctx, "https://example.com/b.xml"); err != nil {
+			t.Fatalf("GetFeedState of remaining key error = %v", err)
+		}
+		keys, err := store.ListFeeds(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(keys, []string{"https://example.com/b.xml"}) {
+			t.Fatalf("ListFeeds after delete = %v", keys)
+		}
+	})
+
+	t.Run("QueueKeepsItemsOrderedUntilRemoved", func(t *testing.T) {
+		store := newStore(t)
+		queue := requireQueue(t, store)
+		ctx := context.Background()
+
+		if items, err := queue.ListQueue(ctx, "digest:missing"); err != nil || len(items) != 0 {
+			t.Fatalf("ListQueue of missing queue = %v, %v; want empty", items, err)
+		}
+		if err := queue.Enqueue(ctx, "digest:a",
+			state.QueuedItem{ID: "b", QueuedAt: base.Add(time.Minute), Data: []byte(`{"n":2}`)},
+			state.QueuedItem{ID: "a", QueuedAt: base, Data: []byte(`{"n":1}`)},
+		); err != nil {
+			t.Fatal(err)
+		}
+		// Enqueueing an ID again replaces the item.
+		if err := queue.Enqueue(ctx, "digest:a", state.QueuedItem{ID: "c", QueuedAt: base.Add(time.Minute), Data: []byte(`{"n":3}`)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := queue.Enqueue(ctx, "digest:a", state.QueuedItem{ID: "a", QueuedAt: base, Data: []byte(`{"n":1}`)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := queue.Enqueue(ctx, "digest:other", state.QueuedItem{ID: "x", QueuedAt: base, Data: []byte(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+
+		items, err := queue.ListQueue(ctx, "digest:a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+		if !slices.Equal(ids, []string{"a", "b", "c"}) {
+			t.Fatalf("queued IDs = %v, want [a b c]", ids)
+		}
+		if string(items[0].Data) != `{"n":1}` || !items[0].QueuedAt.Equal(base) {
+			t.Fatalf("first item = %+v", items[0])
+		}
+
+		if err := queue.RemoveFromQueue(ctx, "digest:a", "a", "c", "missing"); err != nil {
+			t.Fatal(err)
+		}
+		items, err = queue.ListQueue(ctx, "digest:a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(items) != 1 || items[0].ID != "b" {
+			t.Fatalf("items after remove = %+v, want only b", items)
+		}
+		if err := queue.RemoveFromQueue(ctx, "digest:a", "b"); err != nil {
+			t.Fatal(err)
+		}
+		if items, err := queue.ListQueue(ctx, "digest:other"); err != nil || len(items) != 1 {
+			t.Fatalf("other queue = %v, %v; want one item", items, err)
+		}
+		// The emptied queue is gone.
+		if queues, err := queue.ListQueues(ctx); err != nil || !slices.Equal(queues, []string{"digest:other"}) {
+			t.Fatalf("ListQueues = %v, %v; want [digest:other]", queues, err)
+		}
+		if keys, err := store.ListFeeds(ctx); err != nil || len(keys) != 0 {
+			t.Fatalf("ListFeeds with only queues = %v, %v; want none", keys, err)
+		}
+	})
+
+	t.Run("SeenKeysBelongToFirstOwnerUntilExpired", func(t *testing.T) {
+		store := newStore(t)
+		set := requireSeenSet(t, store)
+		ctx := context.Background()
+
+		claim := func(key, owner string, ttl time.Duration) string {
+			t.Helper()
+			got, err := set.Claim(ctx, "dedup:a", key, owner, ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return got
+		}
+		if got := claim("url:https://example.com/1", "feed-a 1", time.Minute); got != "feed-a 1" {
+			t.Fatalf("first claim owner = %q, want feed-a 1", got)
+		}
+		if got := claim("url:https://example.com/1", "feed-a 1", time.Minute); got != "feed-a 1" {
+			t.Fatalf("repeated claim owner = %q, want feed-a 1", got)
+		}
+		if got := claim("url:https://example.com/1", "feed-b 7", time.Minute); got != "feed-a 1" {
+			t.Fatalf("competing claim owner = %q, want feed-a 1", got)
+		}
+		if got, err := set.Claim(ctx, "dedup:other", "url:https://example.com/1", "feed-b 7", time.Minute); err != nil || got != "feed-b 7" {
+			t.Fatalf("claim in other set = %q, %v; want feed-b 7", got, err)
+		}
+
+		claim("url:https://example.com/2", "feed-a 2", 50*time.Millisecond)
+		deadline := time.Now().Add(5 * time.Second)
+		for claim("url:https://example.com/2", "feed-b 8", time.Minute) != "feed-b 8" {
+			if time.Now().After(deadline) {
+				t.Fatal("expired key was not released")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if keys, err := store.ListFeeds(ctx); err != nil || len(keys) != 0 {
+			t.Fatalf("ListFeeds with only seen keys = %v, %v; want none", keys, err)
+		}
+	})
+
+	t.Run("SeenKeysAreReleasedOnlyByTheirOwner", func(t *testing.T) {
+		store := newStore(t)
+		set := requireSeenSet(t, store)
+		ctx := context.Background()
+
+		if _, err := set.Claim(ctx, "dedup:a", "url:https://example.com/1", "feed-a 1", time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		if err := set.Release(ctx, "dedup:a", "url:https://example.com/1", "feed-b 7"); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := set.Claim(ctx, "dedup:a", "url:https://example.com/1", "feed-b 7", time.Minute); err != nil || got != "feed-a 1" {
+			t.Fatalf("claim after release by another owner = %q, %v; want feed-a 1", got, err)
+		}
+		if err := set.Release(ctx, "dedup:a", "url:https://example.com/1", "feed-a 1"); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := set.Claim(ctx, "dedup:a", "url:https://example.com/1", "feed-b 7", time.Minute); err != nil || got != "feed-b 7" {
+			t.Fatalf("claim after release by the owner = %q, %v; want feed-b 7", got, err)
+		}
+		if err := set.Release(ctx, "dedup:missing", "url:https://example.com/1", "feed-a 1"); err != nil {
+			t.Fatalf("release from a missing set: %v", err)
+		}
+	})
+}
+
+func requireSeenSet(t *testing.T, store state.Store) state.SeenSet {
+	t.Helper()
+	set, ok := store.(state.SeenSet)
+	if !ok {
+		t.Fatalf("%T does not implement state.SeenSet", store)
+	}
+	return set
+}
+
+func requireQueue(t *testing.T, store state.Store) state.Queue {
+	t.Helper()
+	queue, ok := store.(state.Queue)
+	if !ok {
+		t.Fatalf("%T does not implement state.Queue", store)
+	}
+	return queue
+}
+
+func requireLocker(t *testing.T, store state.Store) state.Locker {
+	t.Helper()
+	locker, ok := store.(state.Locker)
+	if !ok {
+		t.Fatalf("%T does not implement state.Locker", store)
+	}
+	return locker
+}
+
+func assertStateEqual(t *testing.T, got, want state.FeedState) {
+	t.Helper()
+	if got.Version != want.Version ||
+		got.Status != want.Status ||
+		!got.LastPublishedAt.Equal(want.LastPublishedAt) ||
+		!got.NotifyAfter.Equal(want.NotifyAfter) ||
+		got.WarmupStableObservations != want.WarmupStableObservations {
+		t.Fatalf("state = %+v, want %+v", got, want)
+	}
+}
@@ -1,6 +1,7 @@
 package state
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"sync"
@@ -17,25 +18,79 @@ const (
 // data-integrity failure and must NOT be treated as "first run".
 var ErrNoState = errors.New("no stored state for feed")
 
+// ErrConflict is returned by Store.CompareAndSetFeedState when the stored
+// state no longer matches the expected one.
+var ErrConflict = errors.New("feed state was modified concurrently")
+
+// ErrInvalidState is wrapped by errors for stored states that cannot be
+// decoded.
+var ErrInvalidState = errors.New("invalid stored feed state")
+
 type FeedState struct {
 	Version                  int       `json:"version"`
 	Status                   string    `json:"status"`
 	LastPublishedAt          time.Time `json:"last_published_at"`
 	NotifyAfter              time.Time `json:"notify_after"`
 	WarmupStableObservations int       `json:"warmup_stable_observations"`
+	// OrphanedAt is set while the feed is missing from the configuration.
+	OrphanedAt time.Time `json:"orphaned_at,omitzero"`
+	// ItemHistory holds recent item publish times, oldest first, from
+	// which the adaptive scheduler learns the feed's posting cadence.
+	ItemHistory []time.Time `json:"item_history,omitempty"`
+	// ResolvedURL is the feed URL discovered from the configured HTML page.
+	ResolvedURL string `json:"resolved_url,omitempty"`
+	// MovedTo is where the configured URL permanently redirects.
+	MovedTo string `json:"moved_to,omitempty"`
+	// StaleSince is set while the feed has had no new item for longer than
+	// its stale_after, so that it is alerted on once.
+	StaleSince time.Time `json:"stale_since,omitzero"`
+	// Fingerprints are the items of the feed's last fetched document by
+	// item ID, from which changed items are detected.
+	Fingerprints map[string]ItemFingerprint `json:"fingerprints,omitempty"`
+}
+
+// ItemFingerprint is what an item looked like when it was last seen.
+type ItemFingerprint struct {
+	Hash    string `json:"hash"`              // Of the item's notified content
+	Title   string `json:"title,omitempty"`   // To show how an updated title changed
+	Updates int    `json:"updates,omitempty"` // Update notifications sent for the item
 }
 
 // Store defines the interface for keeping track of processed items.
 // GetFeedState returns ErrNoState if no entry exists; any other
 // non-nil error indicates a backend failure.
+//
+// GetFeedStates omits keys that have no entry from the returned map, but
+// fails the whole batch if any stored entry cannot be decoded, for the same
+// reason GetFeedState does not report such entries as ErrNoState.
+// DeleteFeedState is a no-op for keys that have no entry.
+//
+// CompareAndSetFeedState writes next only if the stored state still equals
+// expected (or, when expected is nil, if no state is stored), and returns
+// ErrConflict otherwise. Writers that derived next from an earlier read use
+// it so that a concurrent writer's progress is never overwritten.
+// CompareAndDeleteFeedState likewise deletes the state only if it still
+// equals expected.
 type Store interface {
-	GetFeedState(feedURL string) (FeedState, error)
-	SetFeedState(feedURL string, state FeedState) error
+	GetFeedState(ctx context.Context, feedURL string) (FeedState, error)
+	SetFeedState(ctx context.Context, feedURL string, state FeedState) error
+	CompareAndSetFeedState(ctx context.Context, feedURL string, expected *FeedState, next FeedState) error
+	GetFeedStates(ctx context.Context, feedURLs []string) (map[string]FeedState, error)
+	SetFeedStates(ctx context.Context, states map[string]FeedState) error
+	ListFeeds(ctx context.Context) ([]string, error)
+	DeleteFeedState(ctx context.Context, feedURL string) error
+	CompareAndDeleteFeedState(ctx context.Context, feedURL string, expected FeedState) error
 }
 
+// CurrentVersion is the FeedState schema version written by this build.
+// Decoded states keep the version they were stored with (0 for legacy
+// RFC3339 timestamps and unversioned JSON) so that old records can be
+// found and upgraded with MigrateFeedState.
+const CurrentVersion = 1
+
 func NewWarmingState(lastPublishedAt, notifyAfter time.Time) FeedState {
 	return FeedState{
-		Version:                  1,
+		Version:                  CurrentVersion,
 		Status:                   StatusWarming,
 		LastPublishedAt:          lastPublishedAt,
 		NotifyAfter:              notifyAfter,
@@ -49,7 +104,7 @@ func NewReadyState(lastPublishedAt time.Time) FeedState {
 
 func NewReadyStateAfter(lastPublishedAt, notifyAfter time.Time) FeedState {
 	return FeedState{
-		Version:                  1,
+		Version:                  CurrentVersion,
 		Status:                   StatusReady,
 		LastPublishedAt:          lastPublishedAt,
 		NotifyAfter:              notifyAfter,
@@ -60,17 +115,8 @@ func NewReadyStateAfter(lastPublishedAt, notifyAfter time.Time) FeedState {
 func DecodeFeedState(raw string) (FeedState, error) {
 	var st FeedState
 	if err := json.Unmarshal([]byte(raw), &st); err == nil {
-		if st.Version == 0 {
-			st.Version = 1
-		}
-		if st.Status == "" {
-			return FeedState{}, errors.New("missing feed state status")
-		}
-		if st.Status != StatusWarming && st.Status != StatusReady {
-			return FeedState{}, errors.New("unknown feed state status")
-		}
-		if st.LastPublishedAt.IsZero() {
-			return FeedState{}, errors.New("missing feed state baseline")
+		if err := ValidateFeedState(st); err != nil {
+			return FeedState{}, err
 		}
 		return st, nil
 	}
@@ -79,13 +125,37 @@ func DecodeFeedState(raw string) (FeedState, error) {
 	if err != nil {
 		return FeedState{}, err
 	}
-	return NewReadyState(t), nil
+	st = NewReadyState(t)
+	st.Version = 0
+	return st, nil
 }
 
-func EncodeFeedState(st FeedState) (string, error) {
-	if st.Version == 0 {
-		st.Version = 1
+// ValidateFeedState reports whether st is usable as a detection baseline.
+func ValidateFeedState(st FeedState) error {
+	if st.Status == "" {
+		return errors.New("missing feed state status")
+	}
+	if st.Status != StatusWarming && st.Status != StatusReady {
+		return errors.New("unknown feed state status")
+	}
+	if st.LastPublishedAt.IsZero() {
+		return errors.New("missing feed state baseline")
+	}
+	return nil
+}
+
+// MigrateFeedState upgrades st to CurrentVersion. It reports false if st
+// is already current.
+func MigrateFeedState(st FeedState) (FeedState, bool) {
+	if st.Version >= CurrentVersion {
+		return st, false
 	}
+	st.Version = CurrentVersion
+	return st, true
+}
+
+func EncodeFeedState(st FeedState) (string, error) {
+	st, _ = MigrateFeedState(st)
 	data, err := json.Marshal(st)
 	if err != nil {
 		return "", err
@@ -93,9 +163,32 @@ func EncodeFeedState(st FeedState) (string, error) {
 	return string(data), nil
 }
 
+// statesEqual compares the stored representation so that new FeedState
+// fields are covered without updating this function.
+func statesEqual(a, b FeedState) bool {
+	ea, errA := EncodeFeedState(a)
+	eb, errB := EncodeFeedState(b)
+	return errA == nil && errB == nil && ea == eb
+}
+
+// casMatches reports whether the current entry satisfies the expectation
+// of a compare-and-set.
+func casMatches(current FeedState, exists bool, expected *FeedState) bool {
+	if expected == nil {
+		return !exists
+	}
+	return exists && statesEqual(current, *expected)
+}
+
 type MemoryStore struct {
-	mu   sync.RWMutex
-	data map[string]FeedState
+	localLocker
+
+	mu     sync.RWMutex
+	data   map[string]FeedState
+	queues map[string]map[string]QueuedItem // by queue name and item ID
+	seen   map[string]map[string]seenEntry  // by set name and key
+	// seenPrunedAt is when expired seen entries were last dropped.
+	seenPrunedAt time.Time
 }
 
 func NewMemoryStore() *MemoryStore {
@@ -104,7 +197,7 @@ func NewMemoryStore() *MemoryStore {
 	}
 }
 
-func (s *MemoryStore) GetFeedState(feedURL string) (FeedState, error) {
+func (s *MemoryStore) GetFeedState(ctx context.Context, feedURL string) (FeedState, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	st, ok := s.data[feedURL]
@@ -114,12 +207,72 @@ func (s *MemoryStore) GetFeedState(feedURL string) (FeedState, error) {
 	return st, nil
 }
 
-func (s *MemoryStore) SetFeedState(feedURL string, st FeedState) error {
+func (s *MemoryStore) SetFeedState(ctx context.Context, feedURL string, st FeedState) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if st.Version == 0 {
-		st.Version = 1
-	}
+	st, _ = MigrateFeedState(st)
 	s.data[feedURL] = st
 	return nil
 }
+
+func (s *MemoryStore) CompareAndSetFeedState(ctx context.Context, feedURL string, expected *FeedState, next FeedState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.data[feedURL]
+	if !casMatches(current, ok, expected) {
+		return ErrConflict
+	}
+	next, _ = MigrateFeedState(next)
+	s.data[feedURL] = next
+	return nil
+}
+
+func (s *MemoryStore) GetFeedStates(ctx context.Context, feedURLs []string) (map[string]FeedState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]FeedState, len(feedURLs))
+	for _, feedURL := range feedURLs {
+		if st, ok := s.data[feedURL]; ok {
+			out[feedURL] = st
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) SetFeedStates(ctx context.Context, states map[string]FeedState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for feedURL, st := range states {
+		st, _ = MigrateFeedState(st)
+		s.data[feedURL] = st
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListFeeds(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]string, 0, len(s.data))
+	for feedURL := range s.data {
+		out = append(out, feedURL)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) DeleteFeedState(ctx context.Context, feedURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, feedURL)
+	return nil
+}
+
+func (s *MemoryStore) CompareAndDeleteFeedState(ctx context.Context, feedURL string, expected FeedState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.data[feedURL]
+	if !casMatches(current, ok, &expected) {
+		return ErrConflict
+	}
+	delete(s.data, feedURL)
+	return nil
+}
@@ -0,0 +1,193 @@
+package state
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ExportFormatVersion is the version of the JSON lines format written by
+// Export. Import accepts any version up to and including this one.
+const ExportFormatVersion = 1
+
+// transferBatchSize bounds how many states are read or written per batch
+// call so that large stores do not produce one huge pipeline.
+const transferBatchSize = 500
+
+// ExportRecord is one line of an export. State keeps the schema version
+// it was stored with; Import upgrades it on write.
+type ExportRecord struct {
+	FormatVersion int       `json:"format_version"`
+	Key           string    `json:"key"`
+	State         FeedState `json:"state"`
+}
+
+// Change describes what Import or Migrate did, or would do in a dry run,
+// to a single key.
+type Change struct {
+	Key    string
+	Action string // "create", "update", "unchanged" or "migrate"
+	Before *FeedState
+	After  FeedState
+}
+
+func (c Change) String() string {
+	if c.Before == nil {
+		return fmt.Sprintf("%s %s: %s", c.Action, c.Key, describeState(c.After))
+	}
+	return fmt.Sprintf("%s %s: %s -> %s", c.Action, c.Key, describeState(*c.Before), describeState(c.After))
+}
+
+func describeState(st FeedState) string {
+	return fmt.Sprintf("v%d %s baseline=%s", st.Version, st.Status, st.LastPublishedAt.Format("2006-01-02T15:04:05Z07:00"))
+}
+
+// Export writes every stored feed state to w as JSON lines, sorted by key.
+func Export(ctx context.Context, store Store, w io.Writer) (int, error) {
+	keys, err := store.ListFeeds(ctx)
+	if err != nil {
+		return 0, err
+	}
+	slices.Sort(keys)
+
+	enc := json.NewEncoder(w)
+	written := 0
+	for batch := range slices.Chunk(keys, transferBatchSize) {
+		states, err := store.GetFeedStates(ctx, batch)
+		if err != nil {
+			return written, err
+		}
+		for _, key := range batch {
+			st, ok := states[key]
+			if !ok {
+				// Deleted between list and get.
+				continue
+			}
+			if err := enc.Encode(ExportRecord{FormatVersion: ExportFormatVersion, Key: key, State: st}); err != nil {
+				return written, fmt.Errorf("failed to write export record: %w", err)
+			}
+			written++
+		}
+	}
+	return written, nil
+}
+
+// Import loads JSON lines produced by Export into store, overwriting
+// existing keys. With dryRun it only reports what would change.
+func Import(ctx context.Context, store Store, r io.Reader, dryRun bool) ([]Change, error) {
+	records, err := readExport(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for batch := range slices.Chunk(records, transferBatchSize) {
+		keys := make([]string, len(batch))
+		for i, rec := range batch {
+			keys[i] = rec.Key
+		}
+		existing, err := store.GetFeedStates(ctx, keys)
+		if err != nil {
+			return changes, err
+		}
+
+		writes := make(map[string]FeedState, len(batch))
+		batchChanges := make([]Change, 0, len(batch))
+		for _, rec := range batch {
+			next, _ := MigrateFeedState(rec.State)
+			change := Change{Key: rec.Key, Action: "create", After: next}
+			if before, ok := existing[rec.Key]; ok {
+				change.Before = &before
+				change.Action = "update"
+				if statesEqual(before, next) {
+					change.Action = "unchanged"
+				}
+			}
+			if change.Action != "unchanged" {
+				writes[rec.Key] = next
+			}
+			batchChanges = append(batchChanges, change)
+		}
+
+		if !dryRun {
+			if err := store.SetFeedStates(ctx, writes); err != nil {
+				return changes, err
+			}
+		}
+		changes = append(changes, batchChanges...)
+	}
+	return changes, nil
+}
+
+// Migrate upgrades every stored state older than CurrentVersion in place.
+// With dryRun it only reports what would change.
+func Migrate(ctx context.Context, store Store, dryRun bool) ([]Change, error) {
+	keys, err := store.ListFeeds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(keys)
+
+	var changes []Change
+	for batch := range slices.Chunk(keys, transferBatchSize) {
+		states, err := store.GetFeedStates(ctx, batch)
+		if err != nil {
+			return changes, err
+		}
+
+		writes := make(map[string]FeedState)
+		batchChanges := make([]Change, 0)
+		for _, key := range batch {
+			before, ok := states[key]
+			if !ok {
+				continue
+			}
+			after, migrated := MigrateFeedState(before)
+			if !migrated {
+				continue
+			}
+			writes[key] = after
+			batchChanges = append(batchChanges, Change{Key: key, Action: "migrate", Before: &before, After: after})
+		}
+
+		if !dryRun {
+			if err := store.SetFeedStates(ctx, writes); err != nil {
+				return changes, err
+			}
+		}
+		changes = append(changes, batchChanges...)
+	}
+	return changes, nil
+}
+
+func readExport(r io.Reader) ([]ExportRecord, error) {
+	var records []ExportRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec ExportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.FormatVersion < 1 || rec.FormatVersion > ExportFormatVersion {
+			return nil, fmt.Errorf("line %d: unsupported export format version %d", line, rec.FormatVersion)
+		}
+		if rec.Key == "" {
+			return nil, fmt.Errorf("line %d: missing key", line)
+		}
+		if err := ValidateFeedState(rec.State); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+	return records, nil
+}
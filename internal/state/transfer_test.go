@@ -0,0 +1,131 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	ts := time.Date(2026, 4, 29, 12, 0, 0, 0, time.UTC)
+
+	src := NewMemoryStore()
+	if err := src.SetFeedStates(ctx, map[string]FeedState{
+		"https://example.com/a.xml": NewReadyState(ts),
+		"https://example.com/b.xml": NewWarmingState(ts.Add(time.Hour), ts),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := Export(ctx, src, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("exported %d records, want 2", n)
+	}
+
+	dst := NewMemoryStore()
+	if err := dst.SetFeedState(ctx, "https://example.com/a.xml", NewReadyState(ts.Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := Import(ctx, dst, bytes.NewReader(buf.Bytes()), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actions(changes); got != "update,create" {
+		t.Fatalf("dry-run actions = %s, want update,create", got)
+	}
+	if _, err := dst.GetFeedState(ctx, "https://example.com/b.xml"); err == nil {
+		t.Fatal("dry-run import wrote state")
+	}
+
+	if _, err := Import(ctx, dst, bytes.NewReader(buf.Bytes()), false); err != nil {
+		t.Fatal(err)
+	}
+	st, err := dst.GetFeedState(ctx, "https://example.com/a.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !st.LastPublishedAt.Equal(ts) {
+		t.Fatalf("imported baseline = %s, want %s", st.LastPublishedAt, ts)
+	}
+
+	changes, err = Import(ctx, dst, bytes.NewReader(buf.Bytes()), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := actions(changes); got != "unchanged,unchanged" {
+		t.Fatalf("re-import actions = %s, want unchanged,unchanged", got)
+	}
+}
+
+func TestImportRejectsUnknownFormatVersion(t *testing.T) {
+	in := `{"format_version":99,"key":"https://example.com/a.xml","state":{"version":1,"status":"ready","last_published_at":"2026-04-29T12:00:00Z"}}`
+	if _, err := Import(context.Background(), NewMemoryStore(), strings.NewReader(in), false); err == nil {
+		t.Fatal("Import returned nil error for unknown format version")
+	}
+}
+
+func TestMigrateUpgradesLegacyRecords(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	store, err := NewValkeyStore(srv.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	srv.Set("feed:https://example.com/legacy.xml", "2026-04-29T12:00:00Z")
+	srv.Set("feed:https://example.com/unversioned.xml", `{"status":"ready","last_published_at":"2026-04-29T12:00:00Z"}`)
+	if err := store.SetFeedState(ctx, "https://example.com/current.xml", NewReadyState(time.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := Migrate(ctx, store, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("dry-run migrate changes = %v, want 2", changes)
+	}
+	if raw, _ := srv.Get("feed:https://example.com/legacy.xml"); raw != "2026-04-29T12:00:00Z" {
+		t.Fatalf("dry-run migrate rewrote legacy record to %q", raw)
+	}
+
+	if _, err := Migrate(ctx, store, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"https://example.com/legacy.xml", "https://example.com/unversioned.xml"} {
+		st, err := store.GetFeedState(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Version != CurrentVersion {
+			t.Fatalf("%s version = %d, want %d", key, st.Version, CurrentVersion)
+		}
+	}
+
+	changes, err = Migrate(ctx, store, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("second migrate changes = %v, want none", changes)
+	}
+}
+
+func actions(changes []Change) string {
+	out := make([]string, len(changes))
+	for i, c := range changes {
+		out[i] = c.Action
+	}
+	return strings.Join(out, ",")
+}
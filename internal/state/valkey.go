@@ -2,12 +2,37 @@ package state
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	valkeyFeedKeyPrefix = "feed:"
+	valkeyLockKeyPrefix = "lock:"
+	// Each queue is a hash of JSON encoded items by ID.
+	valkeyQueueKeyPrefix = "queue:"
+	// Each seen key is a string holding its owner, expiring with the entry.
+	valkeySeenKeyPrefix = "seen:"
+	// valkeyReplicasKey is a sorted set of replica IDs scored by the unix
+	// millisecond time their membership expires.
+	valkeyReplicasKey = "replicas"
+)
+
+// valkeyUnlockScript deletes a lock only if it still holds the caller's
+// token.
+var valkeyUnlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
 type ValkeyStore struct {
 	client *redis.Client
 }
@@ -29,11 +54,8 @@ func NewValkeyStore(addr, password string) (*ValkeyStore, error) {
 	return &ValkeyStore{client: rdb}, nil
 }
 
-func (s *ValkeyStore) GetFeedState(feedURL string) (FeedState, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
-	val, err := s.client.Get(ctx, "feed:"+feedURL).Result()
+func (s *ValkeyStore) GetFeedState(ctx context.Context, feedURL string) (FeedState, error) {
+	val, err := s.client.Get(ctx, valkeyFeedKeyPrefix+feedURL).Result()
 	if err == redis.Nil {
 		return FeedState{}, ErrNoState
 	} else if err != nil {
@@ -42,21 +64,309 @@ func (s *ValkeyStore) GetFeedState(feedURL string) (FeedState, error) {
 
 	st, err := DecodeFeedState(val)
 	if err != nil {
-		return FeedState{}, fmt.Errorf("invalid stored feed state %q: %w", val, err)
+		return FeedState{}, fmt.Errorf("%w %q: %w", ErrInvalidState, val, err)
 	}
 	return st, nil
 }
 
-func (s *ValkeyStore) SetFeedState(feedURL string, st FeedState) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
-
+func (s *ValkeyStore) SetFeedState(ctx context.Context, feedURL string, st FeedState) error {
 	encoded, err := EncodeFeedState(st)
 	if err != nil {
 		return fmt.Errorf("encode feed state failed: %w", err)
 	}
-	if err := s.client.Set(ctx, "feed:"+feedURL, encoded, 0).Err(); err != nil {
+	if err := s.client.Set(ctx, valkeyFeedKeyPrefix+feedURL, encoded, 0).Err(); err != nil {
 		return fmt.Errorf("valkey set failed: %w", err)
 	}
 	return nil
 }
+
+func (s *ValkeyStore) CompareAndSetFeedState(ctx context.Context, feedURL string, expected *FeedState, next FeedState) error {
+	encoded, err := EncodeFeedState(next)
+	if err != nil {
+		return fmt.Errorf("encode feed state failed: %w", err)
+	}
+
+	key := valkeyFeedKeyPrefix + feedURL
+	err = s.client.Watch(ctx, func(tx *redis.Tx) error {
+		var current FeedState
+		val, err := tx.Get(ctx, key).Result()
+		exists := err != redis.Nil
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("valkey get failed: %w", err)
+		}
+		if exists {
+			st, err := DecodeFeedState(val)
+			if err != nil {
+				return fmt.Errorf("%w %q: %w", ErrInvalidState, val, err)
+			}
+			current = st
+		}
+		if !casMatches(current, exists, expected) {
+			return ErrConflict
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, encoded, 0)
+			return nil
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return ErrConflict
+	} else if errors.Is(err, ErrConflict) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("valkey compare-and-set failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ValkeyStore) CompareAndDeleteFeedState(ctx context.Context, feedURL string, expected FeedState) error {
+	key := valkeyFeedKeyPrefix + feedURL
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		val, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return ErrConflict
+		} else if err != nil {
+			return fmt.Errorf("valkey get failed: %w", err)
+		}
+		current, err := DecodeFeedState(val)
+		if err != nil {
+			return fmt.Errorf("%w %q: %w", ErrInvalidState, val, err)
+		}
+		if !casMatches(current, true, &expected) {
+			return ErrConflict
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			return nil
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return ErrConflict
+	} else if errors.Is(err, ErrConflict) {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("valkey compare-and-delete failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ValkeyStore) TryLock(ctx context.Context, name string, ttl time.Duration) (func(context.Context) error, error) {
+	key := valkeyLockKeyPrefix + name
+	token := newLockToken()
+	ok, err := s.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("valkey lock failed: %w", err)
+	}
+	if !ok {
+		return nil, ErrLocked
+	}
+
+	return func(ctx context.Context) error {
+		if err := valkeyUnlockScript.Run(ctx, s.client, []string{key}, token).Err(); err != nil {
+			return fmt.Errorf("valkey unlock failed: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+func (s *ValkeyStore) GetFeedStates(ctx context.Context, feedURLs []string) (map[string]FeedState, error) {
+	out := make(map[string]FeedState, len(feedURLs))
+	if len(feedURLs) == 0 {
+		return out, nil
+	}
+
+	cmds, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, feedURL := range feedURLs {
+			pipe.Get(ctx, valkeyFeedKeyPrefix+feedURL)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("valkey pipelined get failed: %w", err)
+	}
+
+	for i, cmd := range cmds {
+		val, err := cmd.(*redis.StringCmd).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("valkey get failed: %w", err)
+		}
+		st, err := DecodeFeedState(val)
+		if err != nil {
+			return nil, fmt.Errorf("%w for %q %q: %w", ErrInvalidState, feedURLs[i], val, err)
+		}
+		out[feedURLs[i]] = st
+	}
+	return out, nil
+}
+
+func (s *ValkeyStore) SetFeedStates(ctx context.Context, states map[string]FeedState) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	encoded := make(map[string]string, len(states))
+	for feedURL, st := range states {
+		val, err := EncodeFeedState(st)
+		if err != nil {
+			return fmt.Errorf("encode feed state for %q failed: %w", feedURL, err)
+		}
+		encoded[feedURL] = val
+	}
+
+	if _, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for feedURL, val := range encoded {
+			pipe.Set(ctx, valkeyFeedKeyPrefix+feedURL, val, 0)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("valkey pipelined set failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ValkeyStore) ListFeeds(ctx context.Context) ([]string, error) {
+	var out []string
+	iter := s.client.Scan(ctx, 0, valkeyFeedKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		out = append(out, strings.TrimPrefix(iter.Val(), valkeyFeedKeyPrefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("valkey scan failed: %w", err)
+	}
+	return out, nil
+}
+
+func (s *ValkeyStore) DeleteFeedState(ctx context.Context, feedURL string) error {
+	if err := s.client.Del(ctx, valkeyFeedKeyPrefix+feedURL).Err(); err != nil {
+		return fmt.Errorf("valkey del failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ValkeyStore) Heartbeat(ctx context.Context, replicaID string, ttl time.Duration) error {
+	expires := time.Now().Add(ttl).UnixMilli()
+	if err := s.client.ZAdd(ctx, valkeyReplicasKey, redis.Z{Score: float64(expires), Member: replicaID}).Err(); err != nil {
+		return fmt.Errorf("valkey heartbeat failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ValkeyStore) Replicas(ctx context.Context) ([]string, error) {
+	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	cmds, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, valkeyReplicasKey, "-inf", "("+now)
+		pipe.ZRangeByScore(ctx, valkeyReplicasKey, &redis.ZRangeBy{Min: now, Max: "+inf"})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("valkey replicas failed: %w", err)
+	}
+	return cmds[1].(*redis.StringSliceCmd).Val(), nil
+}
+
+func (s *ValkeyStore) Leave(ctx context.Context, replicaID string) error {
+	if err := s.client.ZRem(ctx, valkeyReplicasKey, replicaID).Err(); err != nil {
+		return fmt.Errorf("valkey leave failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ValkeyStore) Enqueue(ctx context.Context, queue string, items ...QueuedItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	fields := make([]any, 0, 2*len(items))
+	for _, item := range items {
+		val, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("encode queued item %q failed: %w", item.ID, err)
+		}
+		fields = append(fields, item.ID, string(val))
+	}
+	if err := s.client.HSet(ctx, valkeyQueueKeyPrefix+queue, fields...).Err(); err != nil {
+		return fmt.Errorf("valkey enqueue failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ValkeyStore) ListQueue(ctx context.Context, queue string) ([]QueuedItem, error) {
+	vals, err := s.client.HGetAll(ctx, valkeyQueueKeyPrefix+queue).Result()
+	if err != nil {
+		return nil, fmt.Errorf("valkey list queue failed: %w", err)
+	}
+	out := make([]QueuedItem, 0, len(vals))
+	var undecodable []string
+	for id, val := range vals {
+		item, err := decodeQueuedItem([]byte(val))
+		if err != nil {
+			undecodable = append(undecodable, id)
+			continue
+		}
+		out = append(out, item)
+	}
+	dropUndecodable(ctx, queue, undecodable, s.RemoveFromQueue)
+	sortQueue(out)
+	return out, nil
+}
+
+func (s *ValkeyStore) RemoveFromQueue(ctx context.Context, queue string, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := s.client.HDel(ctx, valkeyQueueKeyPrefix+queue, ids...).Err(); err != nil {
+		return fmt.Errorf("valkey remove from queue failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ValkeyStore) ListQueues(ctx context.Context) ([]string, error) {
+	var out []string
+	iter := s.client.Scan(ctx, 0, valkeyQueueKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		out = append(out, strings.TrimPrefix(iter.Val(), valkeyQueueKeyPrefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("valkey scan failed: %w", err)
+	}
+	return out, nil
+}
+
+func (s *ValkeyStore) Claim(ctx context.Context, set, key, owner string, ttl time.Duration) (string, error) {
+	k := valkeySeenKeyPrefix + set + ":" + key
+	// The record may expire between the two commands; then claim again.
+	for {
+		ok, err := s.client.SetNX(ctx, k, owner, ttl).Result()
+		if err != nil {
+			return "", fmt.Errorf("valkey claim failed: %w", err)
+		}
+		if ok {
+			return owner, nil
+		}
+		current, err := s.client.Get(ctx, k).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("valkey claim failed: %w", err)
+		}
+		return current, nil
+	}
+}
+
+func (s *ValkeyStore) Release(ctx context.Context, set, key, owner string) error {
+	// A seen key holds its owner like a lock holds its token.
+	if err := valkeyUnlockScript.Run(ctx, s.client, []string{valkeySeenKeyPrefix + set + ":" + key}, owner).Err(); err != nil {
+		return fmt.Errorf("valkey release failed: %w", err)
+	}
+	return nil
+}
+
+func (s *ValkeyStore) Close() error {
+	return s.client.Close()
+}
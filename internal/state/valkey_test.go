@@ -0,0 +1,65 @@
+package state
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestValkeyMembershipExpiresReplicasWithoutHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	store, err := NewValkeyStore(srv.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.Heartbeat(ctx, "live", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Heartbeat(ctx, "stale", 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Heartbeat(ctx, "leaving", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Leave(ctx, "leaving"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	replicas, err := store.Replicas(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(replicas, []string{"live"}) {
+		t.Fatalf("replicas = %v, want [live]", replicas)
+	}
+}
+
+func TestValkeyListQueueRemovesUndecodableItems(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	store, err := NewValkeyStore(srv.Addr(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.Enqueue(ctx, "digest:a", QueuedItem{ID: "good", QueuedAt: time.Now(), Data: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	srv.HSet(valkeyQueueKeyPrefix+"digest:a", "bad", "not json")
+
+	items, err := store.ListQueue(ctx, "digest:a")
+	if err != nil || len(items) != 1 || items[0].ID != "good" {
+		t.Fatalf("ListQueue = %+v, %v; want only the decodable item", items, err)
+	}
+	if srv.HGet(valkeyQueueKeyPrefix+"digest:a", "bad") != "" {
+		t.Fatal("undecodable item was not removed")
+	}
+}
@@ -6,16 +6,103 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
 	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/netpolicy"
+)
+
+var (
+	metricDeliveryAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_webhook_delivery_attempts_total",
+		Help: "Webhook requests sent",
+	}, []string{"webhook", "provider"})
+
+	metricDeliverySuccesses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_webhook_delivery_success_total",
+		Help: "Webhook requests accepted by the receiver, by status code",
+	}, []string{"webhook", "provider", "code"})
+
+	metricDeliveryFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_webhook_delivery_failures_total",
+		Help: "Webhook requests that failed, by status code (\"error\" if no response was received)",
+	}, []string{"webhook", "provider", "code"})
+
+	metricDeliveryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "rss_webhook_delivery_duration_seconds",
+		Help:    "Latency of webhook requests, excluding post_interval waits",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"webhook", "provider", "code"})
 )
 
+var tracer = otel.Tracer("rss-fetcher/internal/webhook")
+
+// PayloadSchemaVersion is sent as schema_version in generic JSON payloads.
+// It is bumped when a field changes meaning or is removed; new optional
+// fields are added without a bump. Version 1 had no schema_version field.
+const PayloadSchemaVersion = 2
+
 type Payload struct {
-	FeedTitle   string    `json:"feed_title"`
-	ItemTitle   string    `json:"item_title"`
-	ItemURL     string    `json:"item_url"`
-	PublishedAt time.Time `json:"published_at"`
+	SchemaVersion int       `json:"schema_version"`
+	FeedTitle     string    `json:"feed_title"`
+	ItemTitle     string    `json:"item_title"`
+	ItemURL       string    `json:"item_url"`
+	PublishedAt   time.Time `json:"published_at"`
+
+	FeedLink     string      `json:"feed_link,omitempty"`
+	FeedImage    string      `json:"feed_image,omitempty"`
+	FeedLanguage string      `json:"feed_language,omitempty"`
+	ItemGUID     string      `json:"item_guid,omitempty"`
+	Authors      []Author    `json:"authors,omitempty"`
+	Categories   []string    `json:"categories,omitempty"`
+	Description  string      `json:"description,omitempty"`
+	Content      string      `json:"content,omitempty"`
+	UpdatedAt    time.Time   `json:"updated_at,omitzero"`
+	Enclosures   []Enclosure `json:"enclosures,omitempty"`
+	// Thumbnail is an image representing the item, derived from media RSS,
+	// image enclosures or iTunes metadata.
+	Thumbnail string `json:"thumbnail,omitempty"`
+	// Event is EventUpdated for an item that changed after it was seen, and
+	// empty for a new item.
+	Event string `json:"event,omitempty"`
+	// PreviousTitle is the title of an updated item before it changed, if
+	// it did.
+	PreviousTitle string `json:"previous_title,omitempty"`
+}
+
+// EventUpdated marks payloads about changed items.
+const EventUpdated = "updated"
+
+// titleLines is the item part of a chat message for payload. Updates are
+// marked, with a diff of the title if it changed.
+func titleLines(payload Payload) string {
+	if payload.Event != EventUpdated {
+		return payload.ItemTitle
+	}
+	if payload.PreviousTitle == "" {
+		return "[Updated] " + payload.ItemTitle
+	}
+	return fmt.Sprintf("[Updated] %s\n- %s\n+ %s", payload.ItemTitle, payload.PreviousTitle, payload.ItemTitle)
+}
+
+type Author struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type Enclosure struct {
+	URL    string `json:"url"`
+	Type   string `json:"type,omitempty"`
+	Length int64  `json:"length,omitempty"` // Size in bytes, 0 if unknown
 }
 
 type Client struct {
@@ -25,11 +112,18 @@ type Client struct {
 func NewClient() *Client {
 	return &Client{
 		client: &http.Client{
-			Timeout: 10 * time.Second,
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   10 * time.Second,
 		},
 	}
 }
 
+// SetNetworkPolicy makes webhook requests dial through p. It must be called
+// before the client is used.
+func (c *Client) SetNetworkPolicy(p *netpolicy.Policy) {
+	p.Apply(c.client.Transport.(*http.Transport))
+}
+
 // DiscordPayload represents the structure for Discord Webhooks
 type DiscordPayload struct {
 	Content string `json:"content"`
@@ -52,14 +146,14 @@ func (c *Client) SendWithRateLimit(ctx context.Context, wh config.Webhook, paylo
 	case "discord":
 		// Format for Discord
 		dp := DiscordPayload{
-			Content: fmt.Sprintf("**%s**\n%s\n%s", payload.FeedTitle, payload.ItemTitle, payload.ItemURL),
+			Content: fmt.Sprintf("**%s**\n%s\n%s", payload.FeedTitle, titleLines(payload), payload.ItemURL),
 		}
 		body, err = json.Marshal(dp)
 	case "misskey":
 		// Format for Misskey - post as a note
 		mp := MisskeyPayload{
 			I:          wh.APIToken,
-			Text:       fmt.Sprintf("%s\n%s\n%s", payload.FeedTitle, payload.ItemTitle, payload.ItemURL),
+			Text:       fmt.Sprintf("%s\n%s\n%s", payload.FeedTitle, titleLines(payload), payload.ItemURL),
 			Visibility: "public",
 		}
 		body, err = json.Marshal(mp)
@@ -67,13 +161,19 @@ func (c *Client) SendWithRateLimit(ctx context.Context, wh config.Webhook, paylo
 		url = wh.URL + "/api/notes/create"
 	default:
 		// Generic JSON
+		payload.SchemaVersion = PayloadSchemaVersion
 		body, err = json.Marshal(payload)
 	}
 
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
+	return c.post(ctx, wh, url, body, attribute.String("rss.item.url", payload.ItemURL))
+}
 
+// post sends body to url, records the delivery and then waits for the
+// webhook's post_interval.
+func (c *Client) post(ctx context.Context, wh config.Webhook, url string, body []byte, attrs ...attribute.KeyValue) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
@@ -81,15 +181,38 @@ func (c *Client) SendWithRateLimit(ctx context.Context, wh config.Webhook, paylo
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "rss-fetcher/1.2")
 
+	label := wh.Label()
+	spanCtx, span := tracer.Start(ctx, "webhook.send", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("rss.webhook.name", label),
+		attribute.String("rss.webhook.provider", wh.Provider),
+	), trace.WithAttributes(attrs...))
+	// Receivers that trace can continue the trace from traceparent.
+	otel.GetTextMapPropagator().Inject(spanCtx, propagation.HeaderCarrier(req.Header))
+
+	metricDeliveryAttempts.WithLabelValues(label, wh.Provider).Inc()
+	start := time.Now()
 	resp, err := c.client.Do(req)
 	if err != nil {
+		metricDeliveryDuration.WithLabelValues(label, wh.Provider, "error").Observe(time.Since(start).Seconds())
+		metricDeliveryFailures.WithLabelValues(label, wh.Provider, "error").Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
 		return fmt.Errorf("failed to send webhook: %w", err)
 	}
 	defer resp.Body.Close()
 
+	code := strconv.Itoa(resp.StatusCode)
+	metricDeliveryDuration.WithLabelValues(label, wh.Provider, code).Observe(time.Since(start).Seconds())
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	if resp.StatusCode >= 400 {
+		metricDeliveryFailures.WithLabelValues(label, wh.Provider, code).Inc()
+		span.SetStatus(codes.Error, resp.Status)
+		span.End()
 		return fmt.Errorf("webhook responded with status: %d", resp.StatusCode)
 	}
+	metricDeliverySuccesses.WithLabelValues(label, wh.Provider, code).Inc()
+	span.End()
 
 	// Rate Limit Wait
 	if wh.PostInterval > 0 {
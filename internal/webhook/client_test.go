@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rss-fetcher/internal/config"
+)
+
+func TestDiscordMessageShowsTitleDiffOfUpdates(t *testing.T) {
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body DiscordPayload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		messages = append(messages, body.Content)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	wh := config.Webhook{Name: "d", URL: server.URL, Provider: "discord"}
+	for _, payload := range []Payload{
+		{FeedTitle: "Feed", ItemTitle: "New", ItemURL: "https://example.com/1"},
+		{FeedTitle: "Feed", ItemTitle: "Edited", ItemURL: "https://example.com/1", Event: EventUpdated},
+		{FeedTitle: "Feed", ItemTitle: "Renamed", ItemURL: "https://example.com/1", Event: EventUpdated, PreviousTitle: "Old"},
+	} {
+		if err := NewClient().SendWithRateLimit(context.Background(), wh, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"**Feed**\nNew\nhttps://example.com/1",
+		"**Feed**\n[Updated] Edited\nhttps://example.com/1",
+		"**Feed**\n[Updated] Renamed\n- Old\n+ Renamed\nhttps://example.com/1",
+	}
+	for i := range want {
+		if i >= len(messages) || messages[i] != want[i] {
+			t.Fatalf("messages = %q, want %q", messages, want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"rss-fetcher/internal/config"
+)
+
+// DefaultDigestTemplate renders a digest when the webhook sets no template.
+const DefaultDigestTemplate = `{{len .Items}} new items
+{{range .Items}}
+- {{.FeedTitle}}: {{if eq .Event "updated"}}[Updated] {{end}}{{.ItemTitle}}
+  {{.ItemURL}}
+{{- end}}`
+
+// providerMaxLength is the longest message text each provider accepts.
+// Generic receivers get the items as JSON and have no limit.
+var providerMaxLength = map[string]int{
+	"discord": 2000,
+	"misskey": 3000, // The default maxNoteTextLength of an instance
+}
+
+// DigestData is the data a digest template is executed with.
+type DigestData struct {
+	Webhook string    // Name of the webhook
+	Items   []Payload // Items in this message, oldest first
+	Total   int       // Items in the whole digest, which may span messages
+}
+
+// DigestPayload is posted to generic webhooks for each digest message.
+type DigestPayload struct {
+	SchemaVersion int       `json:"schema_version"`
+	Type          string    `json:"type"` // Always "digest"
+	Text          string    `json:"text"`
+	Items         []Payload `json:"items"`
+}
+
+// SendDigest posts items as few messages as the provider's size limit
+// allows, each rendered with the webhook's digest template. It returns how
+// many of the leading items were delivered, so that a failed digest can be
+// retried from where it stopped.
+func (c *Client) SendDigest(ctx context.Context, wh config.Webhook, items []Payload) (int, error) {
+	text := DefaultDigestTemplate
+	maxLength := providerMaxLength[wh.Provider]
+	if wh.Digest != nil {
+		if wh.Digest.Template != "" {
+			text = wh.Digest.Template
+		}
+		if wh.Digest.MaxLength > 0 {
+			maxLength = wh.Digest.MaxLength
+		}
+	}
+	tmpl, err := template.New("digest").Parse(text)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse digest template: %w", err)
+	}
+	render := func(chunk []Payload) (string, error) {
+		var b strings.Builder
+		err := tmpl.Execute(&b, DigestData{Webhook: wh.Label(), Items: chunk, Total: len(items)})
+		return b.String(), err
+	}
+
+	sent := 0
+	for sent < len(items) {
+		n, message, err := fit(render, items[sent:], maxLength)
+		if err != nil {
+			return sent, fmt.Errorf("failed to render digest: %w", err)
+		}
+		if err := c.sendDigestMessage(ctx, wh, truncate(message, maxLength), items[sent:sent+n]); err != nil {
+			return sent, err
+		}
+		sent += n
+	}
+	return sent, nil
+}
+
+// fit returns how many leading items render within maxLength characters,
+// and their message. It takes at least one item; a message that is still
+// too long is truncated by the caller.
+func fit(render func([]Payload) (string, error), items []Payload, maxLength int) (int, string, error) {
+	if maxLength <= 0 {
+		message, err := render(items)
+		return len(items), message, err
+	}
+	message, err := render(items[:1])
+	if err != nil {
+		return 0, "", err
+	}
+	n := 1
+	for ; n < len(items); n++ {
+		next, err := render(items[:n+1])
+		if err != nil {
+			return 0, "", err
+		}
+		if utf8.RuneCountInString(next) > maxLength {
+			break
+		}
+		message = next
+	}
+	return n, message, nil
+}
+
+func (c *Client) sendDigestMessage(ctx context.Context, wh config.Webhook, text string, items []Payload) error {
+	var body []byte
+	var err error
+	url := wh.URL
+
+	switch wh.Provider {
+	case "discord":
+		body, err = json.Marshal(DiscordPayload{Content: text})
+	case "misskey":
+		body, err = json.Marshal(MisskeyPayload{I: wh.APIToken, Text: text, Visibility: "public"})
+		url = wh.URL + "/api/notes/create"
+	default:
+		body, err = json.Marshal(DigestPayload{
+			SchemaVersion: PayloadSchemaVersion,
+			Type:          "digest",
+			Text:          text,
+			Items:         items,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal digest: %w", err)
+	}
+	return c.post(ctx, wh, url, body, attribute.Int("rss.digest.items", len(items)))
+}
+
+// truncate shortens s to at most maxLength characters, marking the cut.
+func truncate(s string, maxLength int) string {
+	if maxLength <= 0 || utf8.RuneCountInString(s) <= maxLength {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:maxLength-1]) + "…"
+}
@@ -0,0 +1,103 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"rss-fetcher/internal/config"
+)
+
+func digestItems(n int) []Payload {
+	items := make([]Payload, n)
+	for i := range items {
+		items[i] = Payload{FeedTitle: "Feed", ItemTitle: fmt.Sprintf("Item %d", i), ItemURL: fmt.Sprintf("https://example.com/%d", i)}
+	}
+	return items
+}
+
+func TestSendDigestSplitsToProviderLimit(t *testing.T) {
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body DiscordPayload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		messages = append(messages, body.Content)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	wh := config.Webhook{Name: "d", URL: server.URL, Provider: "discord", Digest: &config.DigestConfig{
+		Template:  "{{range .Items}}{{.ItemTitle}} {{.ItemURL}}\n{{end}}",
+		MaxLength: 100,
+	}}
+	items := digestItems(10)
+	sent, err := NewClient().SendDigest(context.Background(), wh, items)
+	if err != nil || sent != len(items) {
+		t.Fatalf("SendDigest = %d, %v; want %d, nil", sent, err, len(items))
+	}
+	if len(messages) < 2 {
+		t.Fatalf("messages = %d, want the digest split", len(messages))
+	}
+	var all string
+	for _, m := range messages {
+		if utf8.RuneCountInString(m) > 100 {
+			t.Errorf("message of %d characters exceeds max_length", utf8.RuneCountInString(m))
+		}
+		all += m
+	}
+	for _, item := range items {
+		if strings.Count(all, item.ItemURL+"\n") != 1 {
+			t.Errorf("%s not sent exactly once", item.ItemURL)
+		}
+	}
+}
+
+func TestSendDigestReportsPartialDelivery(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls > 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	wh := config.Webhook{URL: server.URL, Provider: "misskey", Digest: &config.DigestConfig{
+		Template:  "{{range .Items}}{{.ItemTitle}}\n{{end}}",
+		MaxLength: 14, // Two "Item n\n" lines
+	}}
+	sent, err := NewClient().SendDigest(context.Background(), wh, digestItems(5))
+	if err == nil || sent != 2 {
+		t.Fatalf("SendDigest = %d, %v; want 2 and an error", sent, err)
+	}
+}
+
+func TestSendDigestPostsGenericItemsInOneMessage(t *testing.T) {
+	var bodies []DigestPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body DigestPayload
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	wh := config.Webhook{Name: "g", URL: server.URL, Provider: "generic", Digest: &config.DigestConfig{}}
+	if _, err := NewClient().SendDigest(context.Background(), wh, digestItems(50)); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 1 || bodies[0].Type != "digest" || len(bodies[0].Items) != 50 || !strings.HasPrefix(bodies[0].Text, "50 new items") {
+		t.Fatalf("bodies = %+v, want one digest of 50 items", bodies)
+	}
+}
@@ -0,0 +1,452 @@
+// Package websub subscribes to WebSub (PubSubHubbub) hubs advertised by
+// feeds and receives the content they push.
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"rss-fetcher/internal/config"
+	"rss-fetcher/internal/netpolicy"
+	"rss-fetcher/internal/state"
+)
+
+var (
+	metricSubscriptions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rss_websub_subscriptions",
+		Help: "The number of feeds with a WebSub subscription requested by this replica",
+	})
+
+	metricNotifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rss_websub_notifications_total",
+		Help: "The total number of content notifications received from WebSub hubs",
+	}, []string{"status"})
+)
+
+const (
+	// maintainInterval is how often subscriptions are checked for renewal.
+	maintainInterval = time.Minute
+	// retryInterval is how long to wait before retrying a failed or
+	// denied subscription request.
+	retryInterval = 15 * time.Minute
+	// requestTimeout bounds one subscription request to a hub.
+	requestTimeout = 30 * time.Second
+	// maxNotificationSize bounds the body of a pushed notification.
+	maxNotificationSize = 10 << 20
+	// pushTimeout bounds processing of one pushed notification, including
+	// waiting for a poll of the feed to finish.
+	pushTimeout = 15 * time.Minute
+	// intentTimeout is how long a hub has to verify a subscription or
+	// unsubscription request.
+	intentTimeout = 10 * time.Minute
+)
+
+// DeliverFunc processes feed content pushed by a hub.
+type DeliverFunc func(ctx context.Context, feedConfig config.Feed, body []byte)
+
+type subscription struct {
+	feed  config.Feed
+	hub   string
+	topic string
+	// renewAt is when the subscription is requested again; zero means as
+	// soon as possible.
+	renewAt time.Time
+}
+
+// Subscriber keeps one subscription per feed that advertises a hub and
+// serves the callback endpoint hubs verify intents on and push content to.
+//
+// Every feed gets its own callback path and hub secret, both derived from
+// the configured secret, so replicas sharing that secret can serve each
+// other's callbacks and an unguessable callback path is proof that the
+// subscription was requested by one of them.
+type Subscriber struct {
+	callbackURL string
+	lease       time.Duration
+	secret      []byte
+	client      *http.Client
+	deliver     DeliverFunc
+	feeds       map[string]config.Feed // by callback ID
+	// intents holds a lease for every request awaiting verification, so
+	// that hubs are only answered for requests one of the replicas made.
+	intents state.Locker
+
+	mu     sync.Mutex
+	subs   map[string]*subscription // by callback ID
+	unsubs []subscription
+	wake   chan struct{}
+	runCtx context.Context
+}
+
+// NewSubscriber returns a Subscriber for the configured feeds. An empty
+// secret is replaced by a random one, which is only suitable for a single
+// replica because pushes signed for other replicas cannot be verified.
+func NewSubscriber(cfg config.WebSubConfig, secret string, feeds []config.Feed, deliver DeliverFunc) (*Subscriber, error) {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate websub secret: %w", err)
+		}
+	}
+
+	s := &Subscriber{
+		callbackURL: strings.TrimSuffix(cfg.CallbackURL, "/"),
+		lease:       cfg.Lease,
+		secret:      key,
+		client: &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   requestTimeout,
+		},
+		deliver: deliver,
+		feeds:   make(map[string]config.Feed, len(feeds)),
+		intents: state.NewLocalLocker(),
+		subs:    make(map[string]*subscription),
+		wake:    make(chan struct{}, 1),
+		runCtx:  context.Background(),
+	}
+	for _, feedConfig := range feeds {
+		s.feeds[s.callbackID(feedConfig.Key())] = feedConfig
+	}
+	return s, nil
+}
+
+// SetNetworkPolicy makes hub requests dial through p. It must be called
+// before Run.
+func (s *Subscriber) SetNetworkPolicy(p *netpolicy.Policy) {
+	p.Apply(s.client.Transport.(*http.Transport))
+}
+
+// SetLocker records pending requests in l, which replicas serving each
+// other's callbacks must share. It must be called before Run.
+func (s *Subscriber) SetLocker(l state.Locker) {
+	s.intents = l
+}
+
+func (s *Subscriber) derive(purpose, feedKey string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(purpose + "\x00" + feedKey))
+	return mac.Sum(nil)
+}
+
+func (s *Subscriber) callbackID(feedKey string) string {
+	return hex.EncodeToString(s.derive("callback", feedKey)[:16])
+}
+
+func (s *Subscriber) hubSecret(feedKey string) string {
+	return hex.EncodeToString(s.derive("hub-secret", feedKey))
+}
+
+// Observe records the hub a feed advertises. A new or changed hub is
+// subscribed to on the next maintenance pass, and a subscription to a hub
+// the feed no longer advertises is cancelled.
+func (s *Subscriber) Observe(feedConfig config.Feed, hub, topic string) {
+	if topic == "" {
+		topic = feedConfig.URL
+	}
+	id := s.callbackID(feedConfig.Key())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.subs[id]
+	if ok && current.hub == hub && current.topic == topic {
+		return
+	}
+	if ok {
+		s.unsubs = append(s.unsubs, *current)
+		delete(s.subs, id)
+	}
+	if hub != "" {
+		s.subs[id] = &subscription{feed: feedConfig, hub: hub, topic: topic}
+		slog.Info("Discovered WebSub hub", "feed", feedConfig.Label(), "hub", hub, "topic", topic)
+	}
+	metricSubscriptions.Set(float64(len(s.subs)))
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run requests and renews subscriptions until ctx is cancelled. Pushed
+// content is processed with contexts derived from ctx. Subscriptions are
+// left in place on shutdown so that they survive a restart.
+func (s *Subscriber) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.runCtx = ctx
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(maintainInterval)
+	defer ticker.Stop()
+
+	for {
+		s.maintain(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *Subscriber) maintain(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	unsubs := s.unsubs
+	s.unsubs = nil
+	var due []subscription
+	for _, sub := range s.subs {
+		if !now.Before(sub.renewAt) {
+			due = append(due, *sub)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, sub := range unsubs {
+		if err := s.request(ctx, sub, "unsubscribe"); err != nil {
+			slog.Warn("Failed to unsubscribe from WebSub hub", "feed", sub.feed.Label(), "hub", sub.hub, "error", err)
+		}
+	}
+
+	for _, sub := range due {
+		// Assume the requested lease until the hub's verification reports
+		// the granted one; the verification may reach another replica.
+		renewAt := now.Add(s.lease * 9 / 10)
+		if err := s.request(ctx, sub, "subscribe"); err != nil {
+			slog.Warn("Failed to subscribe to WebSub hub; polling continues", "feed", sub.feed.Label(), "hub", sub.hub, "error", err)
+			renewAt = now.Add(retryInterval)
+		} else {
+			slog.Info("Requested WebSub subscription", "feed", sub.feed.Label(), "hub", sub.hub, "topic", sub.topic)
+		}
+		s.setRenewAt(sub, renewAt)
+	}
+}
+
+// setRenewAt updates the subscription of sub's feed if it still targets
+// the same hub and topic.
+func (s *Subscriber) setRenewAt(sub subscription, renewAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.subs[s.callbackID(sub.feed.Key())]; ok && current.hub == sub.hub && current.topic == sub.topic {
+		current.renewAt = renewAt
+	}
+}
+
+// intentName names the lease recording a pending request of mode for
+// topic on the callback with id.
+func intentName(id, mode, topic string) string {
+	return "websub:" + mode + ":" + id + ":" + topic
+}
+
+// request asks sub's hub to subscribe or unsubscribe, after recording the
+// intent for the hub's verification.
+func (s *Subscriber) request(ctx context.Context, sub subscription, mode string) error {
+	id := s.callbackID(sub.feed.Key())
+	release, err := s.intents.TryLock(ctx, intentName(id, mode, sub.topic), intentTimeout)
+	switch {
+	case errors.Is(err, state.ErrLocked):
+		// An earlier request of the same intent is still pending.
+		release = nil
+	case err != nil:
+		return fmt.Errorf("failed to record pending request: %w", err)
+	}
+	if err := s.post(ctx, sub, mode); err != nil {
+		if release != nil {
+			release(context.WithoutCancel(ctx))
+		}
+		return err
+	}
+	return nil
+}
+
+// pending reports whether one of the replicas asked for mode on topic and
+// the hub may still verify it. It fails closed.
+func (s *Subscriber) pending(ctx context.Context, id, mode, topic string) bool {
+	release, err := s.intents.TryLock(ctx, intentName(id, mode, topic), time.Second)
+	if err == nil {
+		release(ctx)
+		return false
+	}
+	if !errors.Is(err, state.ErrLocked) {
+		slog.Warn("Failed to look up pending WebSub request", "error", err)
+		return false
+	}
+	return true
+}
+
+func (s *Subscriber) post(ctx context.Context, sub subscription, mode string) error {
+	form := url.Values{
+		"hub.mode":     {mode},
+		"hub.topic":    {sub.topic},
+		"hub.callback": {s.callbackURL + "/" + s.callbackID(sub.feed.Key())},
+	}
+	if mode == "subscribe" {
+		form.Set("hub.lease_seconds", strconv.Itoa(int(s.lease.Seconds())))
+		form.Set("hub.secret", s.hubSecret(sub.feed.Key()))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "rss-fetcher/1.2")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("hub returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// ServeHTTP handles intent verification (GET) and content notifications
+// (POST) on <callback_url>/<callback ID>.
+func (s *Subscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := path.Base(r.URL.Path)
+	feedConfig, ok := s.feeds[id]
+	if !ok {
+		// 410 tells hubs to drop subscriptions for removed feeds.
+		http.Error(w, "unknown subscription", http.StatusGone)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.verify(w, r, id, feedConfig)
+	case http.MethodPost:
+		s.notify(w, r, feedConfig)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Subscriber) verify(w http.ResponseWriter, r *http.Request, id string, feedConfig config.Feed) {
+	q := r.URL.Query()
+	logger := slog.With("feed", feedConfig.Label(), "topic", q.Get("hub.topic"))
+
+	switch mode := q.Get("hub.mode"); mode {
+	case "subscribe", "unsubscribe":
+		challenge := q.Get("hub.challenge")
+		if challenge == "" {
+			http.Error(w, "missing hub.challenge", http.StatusBadRequest)
+			return
+		}
+		// Anyone may ask the hub to unsubscribe our callback; only
+		// confirm what we asked for.
+		if !s.pending(r.Context(), id, mode, q.Get("hub.topic")) {
+			logger.Warn("Rejecting WebSub verification that was not requested", "mode", mode)
+			http.NotFound(w, r)
+			return
+		}
+		if mode == "subscribe" {
+			if seconds, err := strconv.Atoi(q.Get("hub.lease_seconds")); err == nil && seconds > 0 {
+				lease := time.Duration(seconds) * time.Second
+				s.mu.Lock()
+				if sub, ok := s.subs[id]; ok && sub.topic == q.Get("hub.topic") {
+					sub.renewAt = time.Now().Add(lease * 9 / 10)
+				}
+				s.mu.Unlock()
+				logger.Info("Verified WebSub subscription", "lease", lease)
+			}
+		} else {
+			logger.Info("Verified WebSub unsubscription")
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, challenge)
+	case "denied":
+		logger.Warn("WebSub hub denied subscription; polling continues", "reason", q.Get("hub.reason"))
+		s.mu.Lock()
+		if sub, ok := s.subs[id]; ok {
+			sub.renewAt = time.Now().Add(retryInterval)
+		}
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "unknown hub.mode", http.StatusBadRequest)
+	}
+}
+
+func (s *Subscriber) notify(w http.ResponseWriter, r *http.Request, feedConfig config.Feed) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxNotificationSize))
+	if err != nil {
+		metricNotifications.WithLabelValues("invalid").Inc()
+		http.Error(w, "failed to read body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Hubs must get a 2xx even for a bad signature; the content is just
+	// ignored, as the WebSub specification requires.
+	if !validSignature(r.Header.Get("X-Hub-Signature"), s.hubSecret(feedConfig.Key()), body) {
+		slog.Warn("Ignoring WebSub notification with invalid signature", "feed", feedConfig.Label())
+		metricNotifications.WithLabelValues("invalid_signature").Inc()
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	metricNotifications.WithLabelValues("accepted").Inc()
+	w.WriteHeader(http.StatusAccepted)
+
+	s.mu.Lock()
+	ctx := s.runCtx
+	s.mu.Unlock()
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, pushTimeout)
+		defer cancel()
+		s.deliver(ctx, feedConfig, body)
+	}()
+}
+
+// validSignature checks an X-Hub-Signature header of the form
+// "<algorithm>=<hex HMAC of body>".
+func validSignature(header, secret string, body []byte) bool {
+	algorithm, signature, ok := strings.Cut(header, "=")
+	if !ok {
+		return false
+	}
+	var newHash func() hash.Hash
+	switch strings.ToLower(algorithm) {
+	case "sha1":
+		newHash = sha1.New
+	case "sha256":
+		newHash = sha256.New
+	case "sha384":
+		newHash = sha512.New384
+	case "sha512":
+		newHash = sha512.New
+	default:
+		return false
+	}
+	want, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), want)
+}
@@ -0,0 +1,201 @@
+package websub
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"rss-fetcher/internal/config"
+)
+
+// testHub is a minimal WebSub hub: it verifies each subscription request
+// against the callback and remembers the secret to sign pushes with.
+type testHub struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	callback string
+	secret   string
+	verified chan string
+}
+
+func (h *testHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.mu.Lock()
+	h.callback = r.PostForm.Get("hub.callback")
+	h.secret = r.PostForm.Get("hub.secret")
+	h.mu.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+
+	mode, topic := r.PostForm.Get("hub.mode"), r.PostForm.Get("hub.topic")
+	go func() {
+		q := url.Values{
+			"hub.mode":          {mode},
+			"hub.topic":         {topic},
+			"hub.challenge":     {"challenge-123"},
+			"hub.lease_seconds": {"3600"},
+		}
+		resp, err := http.Get(h.callback + "?" + q.Encode())
+		if err != nil {
+			h.t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		h.verified <- string(body)
+	}()
+}
+
+// push delivers content to the subscriber, signed with secret.
+func (h *testHub) push(secret string, body []byte) *http.Response {
+	h.mu.Lock()
+	callback := h.callback
+	h.mu.Unlock()
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	req, err := http.NewRequest(http.MethodPost, callback, bytes.NewReader(body))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/atom+xml")
+	req.Header.Set("X-Hub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestSubscriberSubscribesVerifiesAndReceivesSignedPushes(t *testing.T) {
+	hub := &testHub{t: t, verified: make(chan string, 1)}
+	hubServer := httptest.NewServer(hub)
+	defer hubServer.Close()
+
+	var sub *Subscriber
+	callbackServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub.ServeHTTP(w, r)
+	}))
+	defer callbackServer.Close()
+
+	feedConfig := config.Feed{Name: "example", URL: "https://example.com/feed.xml"}
+	delivered := make(chan []byte, 1)
+	sub, err := NewSubscriber(config.WebSubConfig{
+		CallbackURL: callbackServer.URL + "/websub",
+		Lease:       24 * time.Hour,
+	}, "shared-secret", []config.Feed{feedConfig}, func(ctx context.Context, got config.Feed, body []byte) {
+		if got.URL != feedConfig.URL {
+			t.Errorf("delivered feed = %q, want %q", got.URL, feedConfig.URL)
+		}
+		delivered <- body
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	sub.Observe(feedConfig, hubServer.URL, "https://example.com/feed.xml")
+	sub.maintain(context.Background(), now)
+
+	select {
+	case challenge := <-hub.verified:
+		if challenge != "challenge-123" {
+			t.Fatalf("verification response = %q, want the challenge", challenge)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("hub did not verify the subscription")
+	}
+
+	sub.mu.Lock()
+	renewAt := sub.subs[sub.callbackID(feedConfig.URL)].renewAt
+	sub.mu.Unlock()
+	if renewAt.Before(now) || renewAt.After(now.Add(time.Hour)) {
+		t.Fatalf("renewAt = %s, want within the granted 1h lease", renewAt)
+	}
+
+	if resp := hub.push("wrong-secret", []byte("forged")); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("forged push status = %d, want 202", resp.StatusCode)
+	}
+	if resp := hub.push(hub.secret, []byte("<feed/>")); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("signed push status = %d, want 202", resp.StatusCode)
+	}
+
+	select {
+	case body := <-delivered:
+		if string(body) != "<feed/>" {
+			t.Fatalf("delivered body = %q, want the signed push", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("signed push was not delivered")
+	}
+	select {
+	case body := <-delivered:
+		t.Fatalf("unexpected delivery %q", body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSubscriberRejectsUnknownCallbacks(t *testing.T) {
+	sub, err := NewSubscriber(config.WebSubConfig{
+		CallbackURL: "https://rss-fetcher.example.com/websub",
+		Lease:       time.Hour,
+	}, "", []config.Feed{{URL: "https://example.com/feed.xml"}}, func(context.Context, config.Feed, []byte) {
+		t.Error("unexpected delivery")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	sub.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/websub/unknown?hub.mode=subscribe&hub.challenge=x", nil))
+	if rec.Code != http.StatusGone {
+		t.Fatalf("verification of unknown callback status = %d, want 410", rec.Code)
+	}
+}
+
+func TestSubscriberOnlyConfirmsRequestedIntents(t *testing.T) {
+	// The hub accepts requests without verifying them; the test does.
+	hubServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer hubServer.Close()
+
+	feedConfig := config.Feed{URL: "https://example.com/feed.xml"}
+	sub, err := NewSubscriber(config.WebSubConfig{
+		CallbackURL: "https://rss-fetcher.example.com/websub",
+		Lease:       time.Hour,
+	}, "shared-secret", []config.Feed{feedConfig}, func(context.Context, config.Feed, []byte) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := func(mode string) *httptest.ResponseRecorder {
+		q := url.Values{"hub.mode": {mode}, "hub.topic": {feedConfig.URL}, "hub.challenge": {"challenge-123"}}
+		rec := httptest.NewRecorder()
+		sub.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/websub/"+sub.callbackID(feedConfig.Key())+"?"+q.Encode(), nil))
+		return rec
+	}
+
+	sub.Observe(feedConfig, hubServer.URL, feedConfig.URL)
+	if err := sub.request(context.Background(), subscription{feed: feedConfig, hub: hubServer.URL, topic: feedConfig.URL}, "subscribe"); err != nil {
+		t.Fatal(err)
+	}
+	if rec := verify("subscribe"); rec.Code != http.StatusOK || rec.Body.String() != "challenge-123" {
+		t.Fatalf("requested subscribe: status %d body %q, want the challenge", rec.Code, rec.Body)
+	}
+	if rec := verify("unsubscribe"); rec.Code != http.StatusNotFound || rec.Body.String() == "challenge-123" {
+		t.Fatalf("forged unsubscribe: status %d body %q, want 404 without the challenge", rec.Code, rec.Body)
+	}
+}